@@ -7,6 +7,7 @@ import (
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/SversusN/gophermart/config"
 	agent "github.com/SversusN/gophermart/internal/accrualagent/service"
@@ -15,9 +16,12 @@ import (
 	repository "github.com/SversusN/gophermart/internal/repository"
 	psql "github.com/SversusN/gophermart/internal/repository/psql"
 	"github.com/SversusN/gophermart/internal/service"
+	"github.com/SversusN/gophermart/pkg/keyring"
 	"github.com/SversusN/gophermart/pkg/logger"
 )
 
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	log, err := logger.InitLogger()
 	if err != nil {
@@ -42,17 +46,56 @@ func main() {
 		zp.Fatalf("failed to create db table %v", err)
 	}
 
+	tokenAuth, ephemeral, err := keyring.Load(conf.JWTKeysFile, conf.JWTKeyID, conf.JWTSecret)
+	if err != nil {
+		zp.Fatalf("failed to load JWT keys %v", err)
+	}
+	if ephemeral {
+		zp.Warn("JWT_SECRET and JWT_KEYS_FILE are not set, using a random signing key: tokens will not survive a restart")
+	}
+
 	ctx, stopping := context.WithCancel(context.Background())
 	defer stopping()
 
 	repos := repository.NewRepository(db.DB, log)
-	services := service.NewService(repos, log)
-	handlers := handler.NewHandler(services, log)
+	services := service.NewService(repos, conf, log)
+	handlers := handler.NewHandler(services, tokenAuth, log)
+	handlers.ShopCallbackToken = conf.ShopCallbackToken
+	handlers.StreamHeartbeat = conf.OrderStreamHeartbeat
 	//настройка воркера
 	agentRepo := repository.NewAgentRepository(db.DB, log)
-	newAgent := agent.NewAgent(agentRepo, conf.AccrualSystemAddress, log)
+	newAgent := agent.NewAgent(agentRepo, conf.AccrualSystemAddress, agent.Settings{
+		ClientTimeout: conf.AccrualClientTimeout,
+		Workers:       conf.AccrualWorkers,
+		BatchSize:     conf.AccrualBatchSize,
+		PollLimit:     conf.AccrualPollLimit,
+		PollInterval:  conf.AccrualPollInterval,
+		Lease:         conf.AccrualLease,
+	}, agent.BreakerPolicy{
+		FailureThreshold: conf.AccrualBreakerFailures,
+		OpenTimeout:      conf.AccrualBreakerOpenTimeout,
+		HalfOpenProbes:   conf.AccrualBreakerProbes,
+	}, log)
+	handlers.Accrual = newAgent
 	wg := sync.WaitGroup{}
 	newAgent.Start(ctx, &wg)
+	services.Events.Start(ctx, &wg)
+	service.NewWebhookDispatcher(repos.Webhook, service.WebhookPolicy{
+		MaxAttempts: conf.WebhookMaxAttempts,
+		Backoff:     conf.WebhookBackoff,
+		MaxBackoff:  conf.WebhookMaxBackoff,
+		Timeout:     conf.WebhookTimeout,
+		Guard:       conf.WebhookGuard(),
+	}, conf.WebhookDispatchInterval, log).Start(ctx, &wg)
+	if conf.WithdrawalConfirmation {
+		service.NewHoldSweeper(repos.Withdraw, conf.WithdrawalSweepInterval, log).Start(ctx, &wg)
+	}
+	if conf.PointsLifetimeMonths > 0 {
+		service.NewPointExpirer(repos.Ledger, service.PointsPolicy{
+			LifetimeMonths: conf.PointsLifetimeMonths,
+			ExpiryNotice:   conf.PointsExpiryNotice,
+		}, conf.PointsExpiryInterval, log).Start(ctx, &wg)
+	}
 
 	server := app.NewServer(conf, handlers.CreateRouter())
 
@@ -60,18 +103,45 @@ func main() {
 	termChan := make(chan os.Signal, 1)
 	signal.Notify(termChan, syscall.SIGINT, syscall.SIGTERM)
 
+	// по SIGHUP перечитывается конфигурация; без перезапуска меняются только воркеры, период опроса и аренда агента,
+	// остальное вступает в силу после перезапуска
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-hupChan:
+				reloaded, err := conf.Reload()
+				if err != nil {
+					zp.Errorf("config reload error %v", err)
+					continue
+				}
+				newAgent.Reload(reloaded.AccrualWorkers, reloaded.AccrualPollInterval, reloaded.AccrualLease)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	stopped := make(chan struct{})
 	go func() {
+		defer close(stopped)
 		<-termChan
 		zp.Infof("server shutdown success")
 		stopping()
-		if err = server.Stop(ctx); err != nil {
-			zp.Fatalf("server shutdown error %v", err)
+		// контекст сервиса уже отменён, у остановки сервера свой срок
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Stop(shutdownCtx); err != nil {
+			zp.Errorf("server shutdown error %v", err)
 		}
+		// фоновые задачи дописывают накопленное
 		wg.Wait()
 	}()
 
 	if err = server.Run(); err != nil && err != http.ErrServerClosed {
 		zp.Fatalf("server run error %v", err)
 	}
+	<-stopped
 
 }
@@ -1,33 +1,305 @@
 package config
 
 import (
+	"errors"
 	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
 	"github.com/caarlos0/env/v6"
+
+	"github.com/SversusN/gophermart/internal/model"
+	"github.com/SversusN/gophermart/pkg/hasher"
+	"github.com/SversusN/gophermart/pkg/webhook"
 )
 
+// defaultAccrualLease - аренда заказа агентом, если ACCRUAL_LEASE не задан и настройки опроса не требуют дольше
+const defaultAccrualLease = 30 * time.Second
+
 type Config struct {
+	// ConfigFile - файл со строками KEY=VALUE; переменные окружения и флаги важнее файла.
+	// По SIGHUP файл перечитывается
+	ConfigFile string `env:"CONFIG_FILE"`
+
 	RunAddress           string `env:"RUN_ADDRESS" envDefault:"localhost:8080"`
 	DatabaseURI          string `env:"DATABASE_URI"`
 	AccrualSystemAddress string `env:"ACCRUAL_SYSTEM_ADDRESS" envDefault:"http://localhost:8090"`
+
+	PasswordHashAlgorithm string `env:"PASSWORD_HASH_ALGORITHM" envDefault:"bcrypt"`
+	PasswordMinLength     int    `env:"PASSWORD_MIN_LENGTH" envDefault:"8"`
+	PasswordMaxLength     int    `env:"PASSWORD_MAX_LENGTH" envDefault:"72"`
+	PasswordRequireUpper  bool   `env:"PASSWORD_REQUIRE_UPPER"`
+	PasswordRequireLower  bool   `env:"PASSWORD_REQUIRE_LOWER"`
+	PasswordRequireDigit  bool   `env:"PASSWORD_REQUIRE_DIGIT"`
+	PasswordRequireSymbol bool   `env:"PASSWORD_REQUIRE_SYMBOL"`
+
+	LoginMinLength int    `env:"LOGIN_MIN_LENGTH" envDefault:"3"`
+	LoginMaxLength int    `env:"LOGIN_MAX_LENGTH" envDefault:"64"`
+	LoginPattern   string `env:"LOGIN_PATTERN" envDefault:"^[\\p{L}\\p{N}._@+-]+$"`
+	LoginCaseFold  bool   `env:"LOGIN_CASE_FOLD" envDefault:"true"`
+
+	JWTKeysFile string `env:"JWT_KEYS_FILE"`
+	JWTKeyID    string `env:"JWT_KEY_ID" envDefault:"default"`
+	JWTSecret   string `env:"JWT_SECRET"`
+
+	AccessTokenTTL  time.Duration `env:"ACCESS_TOKEN_TTL" envDefault:"15m"`
+	RefreshTokenTTL time.Duration `env:"REFRESH_TOKEN_TTL" envDefault:"720h"`
+
+	LoginDelayAfter    int           `env:"LOGIN_DELAY_AFTER" envDefault:"3"`
+	LoginBaseDelay     time.Duration `env:"LOGIN_BASE_DELAY" envDefault:"1s"`
+	LoginMaxFailures   int           `env:"LOGIN_MAX_FAILURES" envDefault:"10"`
+	LoginMaxIPFailures int           `env:"LOGIN_MAX_IP_FAILURES" envDefault:"100"`
+	LoginLockout       time.Duration `env:"LOGIN_LOCKOUT" envDefault:"15m"`
+	LoginFailureWindow time.Duration `env:"LOGIN_FAILURE_WINDOW" envDefault:"15m"`
+
+	IdempotencyKeyTTL time.Duration `env:"IDEMPOTENCY_KEY_TTL" envDefault:"24h"`
+
+	WithdrawalCancelWindow time.Duration `env:"WITHDRAWAL_CANCEL_WINDOW" envDefault:"24h"`
+	// WithdrawalConfirmation включает удержание баллов до подтверждения магазином;
+	// выключено - списание подтверждается сразу, как раньше
+	WithdrawalConfirmation  bool          `env:"WITHDRAWAL_CONFIRMATION"`
+	WithdrawalHoldTimeout   time.Duration `env:"WITHDRAWAL_HOLD_TIMEOUT" envDefault:"30m"`
+	WithdrawalSweepInterval time.Duration `env:"WITHDRAWAL_SWEEP_INTERVAL" envDefault:"1m"`
+	ShopCallbackToken       string        `env:"SHOP_CALLBACK_TOKEN"`
+
+	// PointsLifetimeMonths - через сколько месяцев после загрузки заказа сгорают начисленные баллы, 0 - не сгорают
+	PointsLifetimeMonths int           `env:"POINTS_LIFETIME_MONTHS"`
+	PointsExpiryNotice   time.Duration `env:"POINTS_EXPIRY_NOTICE" envDefault:"720h"`
+	PointsExpiryInterval time.Duration `env:"POINTS_EXPIRY_INTERVAL" envDefault:"1h"`
+
+	// OrdersBatchLimit - сколько номеров можно загрузить одним пакетным запросом
+	OrdersBatchLimit int `env:"ORDERS_BATCH_LIMIT" envDefault:"100"`
+
+	// OrderStreamHeartbeat - как часто поток событий заказов шлёт комментарий, чтобы прокси не закрывали соединение
+	OrderStreamHeartbeat time.Duration `env:"ORDER_STREAM_HEARTBEAT" envDefault:"15s"`
+
+	// Доставка вебхуков: пауза между попытками растёт вдвое от WEBHOOK_BACKOFF до WEBHOOK_MAX_BACKOFF
+	WebhookDispatchInterval time.Duration `env:"WEBHOOK_DISPATCH_INTERVAL" envDefault:"5s"`
+	WebhookTimeout          time.Duration `env:"WEBHOOK_TIMEOUT" envDefault:"10s"`
+	WebhookMaxAttempts      int           `env:"WEBHOOK_MAX_ATTEMPTS" envDefault:"10"`
+	WebhookBackoff          time.Duration `env:"WEBHOOK_BACKOFF" envDefault:"30s"`
+	WebhookMaxBackoff       time.Duration `env:"WEBHOOK_MAX_BACKOFF" envDefault:"6h"`
+	// WebhookAllowedNetworks - внутренние сети (CIDR через запятую), куда всё же можно слать вебхуки
+	WebhookAllowedNetworks []string `env:"WEBHOOK_ALLOWED_NETWORKS" envSeparator:","`
+
+	// Предохранитель перед системой начислений: после ACCRUAL_BREAKER_FAILURES ошибок подряд опрос
+	// останавливается на ACCRUAL_BREAKER_OPEN_TIMEOUT, затем цепь замыкают ACCRUAL_BREAKER_PROBES удачных проб
+	AccrualBreakerFailures    int           `env:"ACCRUAL_BREAKER_FAILURES" envDefault:"5"`
+	AccrualBreakerOpenTimeout time.Duration `env:"ACCRUAL_BREAKER_OPEN_TIMEOUT" envDefault:"30s"`
+	AccrualBreakerProbes      int           `env:"ACCRUAL_BREAKER_PROBES" envDefault:"1"`
+
+	// Агент опроса системы начислений. ACCRUAL_WORKERS, ACCRUAL_POLL_INTERVAL и ACCRUAL_LEASE меняются
+	// без перезапуска по SIGHUP. ACCRUAL_LEASE - на сколько заказ берется в аренду; без значения
+	// выводится из остальных настроек, см. AccrualMinLease
+	AccrualClientTimeout time.Duration `env:"ACCRUAL_CLIENT_TIMEOUT" envDefault:"5s"`
+	AccrualWorkers       int           `env:"ACCRUAL_WORKERS" envDefault:"3"`
+	AccrualBatchSize     int           `env:"ACCRUAL_BATCH_SIZE" envDefault:"3"`
+	AccrualPollLimit     int           `env:"ACCRUAL_POLL_LIMIT" envDefault:"10"`
+	AccrualPollInterval  time.Duration `env:"ACCRUAL_POLL_INTERVAL" envDefault:"3s"`
+	AccrualLease         time.Duration `env:"ACCRUAL_LEASE"`
+
+	// TransferDailyLimit - сколько баллов пользователь может перевести за сутки, 0 - без ограничения
+	TransferDailyLimit model.Money `env:"TRANSFER_DAILY_LIMIT" envDefault:"10000"`
+
+	// args - флаги запуска для Reload
+	args []string
 }
 
 func NewConfig() (*Config, error) {
-	conf := &Config{}
+	return load(os.Args[1:], nil)
+}
 
-	if err := env.Parse(conf); err != nil {
+// Reload заново читает конфигурацию с теми же флагами запуска. Срок запроса, размер выборки и пачки
+// работающий агент не меняет, поэтому они остаются прежними, и аренда проверяется по ним
+func (c *Config) Reload() (*Config, error) {
+	return load(c.args, c)
+}
+
+// load собирает конфигурацию: значения по умолчанию, файл, переменные окружения, флаги - каждый следующий важнее.
+// running - действующая конфигурация при перечитывании
+func load(args []string, running *Config) (*Config, error) {
+	conf := &Config{args: args}
+	flags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	flags.StringVar(&conf.ConfigFile, "c", "", "config file")
+	flags.StringVar(&conf.RunAddress, "a", "", "gophermart run address")
+	flags.StringVar(&conf.DatabaseURI, "d", "", "database connection")
+	flags.StringVar(&conf.AccrualSystemAddress, "r", "", "accrual blackbox address")
+	flags.StringVar(&conf.JWTKeysFile, "k", "", "JWT signing keys file")
+	flags.DurationVar(&conf.AccrualClientTimeout, "accrual-client-timeout", 0, "accrual system request timeout")
+	flags.IntVar(&conf.AccrualWorkers, "accrual-workers", 0, "concurrent accrual system requests")
+	flags.IntVar(&conf.AccrualBatchSize, "accrual-batch-size", 0, "accrual responses saved in one transaction")
+	flags.IntVar(&conf.AccrualPollLimit, "accrual-poll-limit", 0, "orders taken from the queue at once")
+	flags.DurationVar(&conf.AccrualPollInterval, "accrual-poll-interval", 0, "accrual queue poll interval")
+	flags.DurationVar(&conf.AccrualLease, "accrual-lease", 0, "how long a polled order stays leased to the agent")
+	if err := flags.Parse(args); err != nil {
 		return nil, err
 	}
+	set := make(map[string]string)
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = f.Value.String()
+	})
 
-	regStringVar(&conf.RunAddress, "a", conf.RunAddress, "gophermart run address")
-	regStringVar(&conf.DatabaseURI, "d", conf.DatabaseURI, "database connection")
-	regStringVar(&conf.AccrualSystemAddress, "r", conf.AccrualSystemAddress, "accrual blackbox address")
-	flag.Parse()
+	file, ok := set["c"]
+	if !ok {
+		file = os.Getenv("CONFIG_FILE")
+	}
+	environment, err := readEnvFile(file)
+	if err != nil {
+		return nil, err
+	}
+	for _, kv := range os.Environ() {
+		if key, value, ok := strings.Cut(kv, "="); ok {
+			environment[key] = value
+		}
+	}
+	*conf = Config{args: args}
+	if err := env.Parse(conf, env.Options{Environment: environment}); err != nil {
+		return nil, err
+	}
+	for name, value := range set {
+		if err := flags.Set(name, value); err != nil {
+			return nil, err
+		}
+	}
+
+	if running != nil {
+		conf.AccrualClientTimeout = running.AccrualClientTimeout
+		conf.AccrualPollLimit = running.AccrualPollLimit
+		conf.AccrualBatchSize = running.AccrualBatchSize
+	}
+	if conf.AccrualLease == 0 {
+		conf.AccrualLease = max(defaultAccrualLease, 2*conf.AccrualMinLease())
+	}
+	if err := conf.validate(); err != nil {
+		return nil, err
+	}
 
 	return conf, nil
 }
 
-func regStringVar(p *string, name string, value string, usage string) {
-	if flag.Lookup(name) == nil {
-		flag.StringVar(p, name, value, usage)
+// readEnvFile читает строки KEY=VALUE; пустые строки и строки с # пропускаются
+func readEnvFile(path string) (map[string]string, error) {
+	environment := make(map[string]string)
+	if path == "" {
+		return environment, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("config file %s line %d: expected KEY=VALUE", path, i+1)
+		}
+		environment[strings.TrimSpace(key)] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return environment, nil
+}
+
+// AccrualMinLease - сколько в худшем случае занимает заказ из аренды: взятые за раз ACCRUAL_POLL_LIMIT заказов
+// опрашиваются по ACCRUAL_WORKERS одновременно, каждый до ACCRUAL_CLIENT_TIMEOUT, а ответ ждет записи
+// до ACCRUAL_POLL_INTERVAL. Аренда короче отдаст заказ другой реплике, и ответ этого агента будет отброшен
+func (c *Config) AccrualMinLease() time.Duration {
+	if c.AccrualWorkers <= 0 {
+		return 0
+	}
+	rounds := (c.AccrualPollLimit + c.AccrualWorkers - 1) / c.AccrualWorkers
+	return time.Duration(rounds)*c.AccrualClientTimeout + c.AccrualPollInterval
+}
+
+// WebhookGuard - ограничение адресов вебхуков; сети уже проверены в validate
+func (c *Config) WebhookGuard() webhook.Guard {
+	networks, _ := webhook.ParseNetworks(c.WebhookAllowedNetworks)
+	return webhook.Guard{Allowed: networks}
+}
+
+func (c *Config) validate() error {
+	if _, err := hasher.New(c.PasswordHashAlgorithm); err != nil {
+		return err
+	}
+	if c.PasswordMaxLength > 0 && c.PasswordMinLength > c.PasswordMaxLength {
+		return errors.New("PASSWORD_MIN_LENGTH must not exceed PASSWORD_MAX_LENGTH")
+	}
+	if c.LoginMaxLength > 0 && c.LoginMinLength > c.LoginMaxLength {
+		return errors.New("LOGIN_MIN_LENGTH must not exceed LOGIN_MAX_LENGTH")
+	}
+	if _, err := regexp.Compile(c.LoginPattern); err != nil {
+		return fmt.Errorf("invalid LOGIN_PATTERN: %w", err)
+	}
+	if c.AccessTokenTTL <= 0 || c.RefreshTokenTTL <= 0 {
+		return errors.New("token TTL must be positive")
+	}
+	if c.RefreshTokenTTL < c.AccessTokenTTL {
+		return errors.New("refresh token TTL must not be shorter than access token TTL")
+	}
+	if c.LoginMaxFailures < 0 || c.LoginMaxIPFailures < 0 || c.LoginDelayAfter < 0 {
+		return errors.New("login failure limits must not be negative")
+	}
+	if c.LoginLockout <= 0 || c.LoginFailureWindow <= 0 || c.LoginBaseDelay < 0 {
+		return errors.New("login lockout and failure window must be positive")
+	}
+	if c.WithdrawalCancelWindow < 0 {
+		return errors.New("WITHDRAWAL_CANCEL_WINDOW must not be negative")
+	}
+	if c.WithdrawalConfirmation && (c.WithdrawalHoldTimeout <= 0 || c.WithdrawalSweepInterval <= 0) {
+		return errors.New("WITHDRAWAL_HOLD_TIMEOUT and WITHDRAWAL_SWEEP_INTERVAL must be positive")
+	}
+	if c.WithdrawalConfirmation && c.ShopCallbackToken == "" {
+		return errors.New("WITHDRAWAL_CONFIRMATION requires SHOP_CALLBACK_TOKEN")
+	}
+	if c.PointsLifetimeMonths < 0 {
+		return errors.New("POINTS_LIFETIME_MONTHS must not be negative")
+	}
+	if c.PointsLifetimeMonths > 0 && (c.PointsExpiryInterval <= 0 || c.PointsExpiryNotice < 0) {
+		return errors.New("POINTS_EXPIRY_INTERVAL must be positive and POINTS_EXPIRY_NOTICE must not be negative")
+	}
+	if c.OrdersBatchLimit <= 0 {
+		return errors.New("ORDERS_BATCH_LIMIT must be positive")
+	}
+	if c.OrderStreamHeartbeat <= 0 {
+		return errors.New("ORDER_STREAM_HEARTBEAT must be positive")
+	}
+	if c.WebhookDispatchInterval <= 0 || c.WebhookTimeout <= 0 || c.WebhookBackoff <= 0 {
+		return errors.New("WEBHOOK_DISPATCH_INTERVAL, WEBHOOK_TIMEOUT and WEBHOOK_BACKOFF must be positive")
+	}
+	if c.WebhookMaxAttempts <= 0 {
+		return errors.New("WEBHOOK_MAX_ATTEMPTS must be positive")
+	}
+	if c.WebhookMaxBackoff < c.WebhookBackoff {
+		return errors.New("WEBHOOK_MAX_BACKOFF must not be shorter than WEBHOOK_BACKOFF")
+	}
+	if _, err := webhook.ParseNetworks(c.WebhookAllowedNetworks); err != nil {
+		return fmt.Errorf("invalid WEBHOOK_ALLOWED_NETWORKS: %w", err)
+	}
+	if c.AccrualBreakerFailures <= 0 || c.AccrualBreakerProbes <= 0 {
+		return errors.New("ACCRUAL_BREAKER_FAILURES and ACCRUAL_BREAKER_PROBES must be positive")
+	}
+	if c.AccrualBreakerOpenTimeout <= 0 {
+		return errors.New("ACCRUAL_BREAKER_OPEN_TIMEOUT must be positive")
+	}
+	if c.AccrualClientTimeout <= 0 || c.AccrualPollInterval <= 0 {
+		return errors.New("ACCRUAL_CLIENT_TIMEOUT and ACCRUAL_POLL_INTERVAL must be positive")
+	}
+	if c.AccrualWorkers <= 0 || c.AccrualBatchSize <= 0 || c.AccrualPollLimit <= 0 {
+		return errors.New("ACCRUAL_WORKERS, ACCRUAL_BATCH_SIZE and ACCRUAL_POLL_LIMIT must be positive")
+	}
+	if c.AccrualLease <= c.AccrualMinLease() {
+		return fmt.Errorf("ACCRUAL_LEASE must be longer than %s: polls of ACCRUAL_POLL_LIMIT orders by ACCRUAL_WORKERS workers "+
+			"within ACCRUAL_CLIENT_TIMEOUT each, plus ACCRUAL_POLL_INTERVAL to save the results", c.AccrualMinLease())
+	}
+	if c.TransferDailyLimit < 0 {
+		return errors.New("TRANSFER_DAILY_LIMIT must not be negative")
+	}
+	if c.IdempotencyKeyTTL <= 0 {
+		return errors.New("IDEMPOTENCY_KEY_TTL must be positive")
 	}
+	return nil
 }
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "gophermart.env")
+	require.NoError(t, os.WriteFile(file, []byte(`
+# агент
+ACCRUAL_WORKERS=8
+ACCRUAL_POLL_INTERVAL="10s"
+ACCRUAL_POLL_LIMIT=50
+`), 0o600))
+	t.Setenv("CONFIG_FILE", file)
+	t.Setenv("ACCRUAL_POLL_LIMIT", "20")
+
+	conf, err := load([]string{"-accrual-poll-interval", "1m", "-a", "localhost:9000"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 8, conf.AccrualWorkers)
+	assert.Equal(t, 20, conf.AccrualPollLimit)
+	assert.Equal(t, time.Minute, conf.AccrualPollInterval)
+	assert.Equal(t, "localhost:9000", conf.RunAddress)
+	assert.Equal(t, 5*time.Second, conf.AccrualClientTimeout)
+	// аренда выводится из настроек опроса: 20 заказов по 8 воркеров - три раунда по 5s и минута до записи
+	assert.Equal(t, 2*(3*5*time.Second+time.Minute), conf.AccrualLease)
+
+	require.NoError(t, os.WriteFile(file, []byte("ACCRUAL_WORKERS=2\n"), 0o600))
+	reloaded, err := conf.Reload()
+	require.NoError(t, err)
+	assert.Equal(t, 2, reloaded.AccrualWorkers)
+	assert.Equal(t, time.Minute, reloaded.AccrualPollInterval)
+	assert.Equal(t, "localhost:9000", reloaded.RunAddress)
+
+	// заданная аренда не может быть короче опроса
+	require.NoError(t, os.WriteFile(file, []byte("ACCRUAL_LEASE=1m\n"), 0o600))
+	_, err = conf.Reload()
+	assert.ErrorContains(t, err, "ACCRUAL_LEASE")
+	require.NoError(t, os.WriteFile(file, []byte("ACCRUAL_LEASE=5m\n"), 0o600))
+	reloaded, err = conf.Reload()
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, reloaded.AccrualLease)
+
+	// срок запроса и размер выборки агент применяет только при запуске: аренда проверяется по действующим
+	require.NoError(t, os.WriteFile(file, []byte("ACCRUAL_CLIENT_TIMEOUT=1s\nACCRUAL_LEASE=70s\n"), 0o600))
+	_, err = conf.Reload()
+	assert.ErrorContains(t, err, "ACCRUAL_LEASE")
+	require.NoError(t, os.WriteFile(file, []byte("ACCRUAL_CLIENT_TIMEOUT=1s\nACCRUAL_POLL_LIMIT=1\n"), 0o600))
+	reloaded, err = conf.Reload()
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Second, reloaded.AccrualClientTimeout)
+	assert.Equal(t, 20, reloaded.AccrualPollLimit)
+	// 20 заказов по 3 воркера по умолчанию - семь раундов по 5s
+	assert.Equal(t, 2*(7*5*time.Second+time.Minute), reloaded.AccrualLease)
+
+	require.NoError(t, os.WriteFile(file, []byte("ACCRUAL_WORKERS=0\n"), 0o600))
+	_, err = conf.Reload()
+	assert.Error(t, err)
+
+	require.NoError(t, os.WriteFile(file, []byte("ACCRUAL_WORKERS\n"), 0o600))
+	_, err = conf.Reload()
+	assert.Error(t, err)
+}
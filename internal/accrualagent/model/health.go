@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// Состояния предохранителя перед системой начислений
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// AccrualHealth - состояние связи с системой начислений
+type AccrualHealth struct {
+	State string `json:"state"`
+	// Failures - неудачные запросы подряд
+	Failures int        `json:"failures"`
+	OpenedAt *time.Time `json:"opened_at,omitempty"`
+	// RetryAt - когда разомкнутый предохранитель пропустит пробные запросы
+	RetryAt *time.Time `json:"retry_at,omitempty"`
+}
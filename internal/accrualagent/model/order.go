@@ -1,13 +1,30 @@
 package model
 
+import (
+	"time"
+
+	"github.com/SversusN/gophermart/internal/model"
+)
+
 type Order struct {
-	Number uint64
-	Status Status
+	Number   uint64
+	Status   Status
+	Attempts int
 }
 
 type OrderAccrual struct {
-	UserID  int     `json:"user_id"`
-	Order   uint64  `json:"order,string"`
-	Status  Status  `json:"status"`
-	Accrual float32 `json:"accrual,omitempty"`
+	UserID  int         `json:"user_id"`
+	Order   uint64      `json:"order,string"`
+	Status  Status      `json:"status"`
+	Accrual model.Money `json:"accrual,omitempty"`
+	// NextAttemptAt - когда опросить заказ снова, если статус ещё не окончательный
+	NextAttemptAt time.Time `json:"-"`
+}
+
+// OrderRetry - неудачный опрос заказа и время следующей попытки
+type OrderRetry struct {
+	Order         uint64
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
 }
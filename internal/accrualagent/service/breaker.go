@@ -0,0 +1,151 @@
+package agent
+
+import (
+	"errors"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/SversusN/gophermart/internal/accrualagent/model"
+)
+
+var errCircuitOpen = errors.New("accrual system circuit is open")
+
+// BreakerPolicy - когда предохранитель перед системой начислений размыкается и как проверяет её восстановление
+type BreakerPolicy struct {
+	// FailureThreshold - сколько неудачных запросов подряд размыкают цепь
+	FailureThreshold int
+	// OpenTimeout - сколько цепь остаётся разомкнутой до пробных запросов
+	OpenTimeout time.Duration
+	// HalfOpenProbes - сколько пробных запросов подряд должны пройти, чтобы цепь замкнулась
+	HalfOpenProbes int
+}
+
+// breaker - предохранитель: после FailureThreshold ошибок подряд запросы не отправляются OpenTimeout,
+// затем пропускается HalfOpenProbes пробных запросов; ошибка пробы снова размыкает цепь
+type breaker struct {
+	mu        sync.Mutex
+	policy    BreakerPolicy
+	state     string
+	failures  int
+	successes int
+	inFlight  int
+	openedAt  time.Time
+	now       func() time.Time
+}
+
+func newBreaker(policy BreakerPolicy) *breaker {
+	if policy.FailureThreshold < 1 {
+		policy.FailureThreshold = 1
+	}
+	if policy.HalfOpenProbes < 1 {
+		policy.HalfOpenProbes = 1
+	}
+	metrics.Set("circuit_state", new(expvar.String))
+	metrics.Get("circuit_state").(*expvar.String).Set(model.CircuitClosed)
+	return &breaker{policy: policy, state: model.CircuitClosed, now: time.Now}
+}
+
+// Allow резервирует запрос; в полуразомкнутом состоянии одновременно идёт не больше HalfOpenProbes проб.
+// Каждый разрешённый запрос завершается вызовом Done
+func (b *breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+	switch b.state {
+	case model.CircuitOpen:
+		return errCircuitOpen
+	case model.CircuitHalfOpen:
+		if b.inFlight >= b.policy.HalfOpenProbes-b.successes {
+			return errCircuitOpen
+		}
+	}
+	b.inFlight++
+	return nil
+}
+
+// Done записывает итог запроса: ok - система начислений ответила, пусть и отказом.
+// Возвращает true, если запрос разомкнул цепь
+func (b *breaker) Done(ok bool) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.inFlight > 0 {
+		b.inFlight--
+	}
+	if ok {
+		b.failures = 0
+		if b.state == model.CircuitHalfOpen {
+			b.successes++
+			if b.successes >= b.policy.HalfOpenProbes {
+				b.setState(model.CircuitClosed)
+			}
+		}
+		return false
+	}
+	b.failures++
+	if b.state == model.CircuitOpen ||
+		b.state == model.CircuitClosed && b.failures < b.policy.FailureThreshold {
+		return false
+	}
+	b.openedAt = b.now()
+	b.setState(model.CircuitOpen)
+	return true
+}
+
+// Capacity - сколько заказов можно взять в работу: ноль, пока цепь разомкнута
+func (b *breaker) Capacity(limit int) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+	switch b.state {
+	case model.CircuitOpen:
+		return 0
+	case model.CircuitHalfOpen:
+		return min(limit, max(b.policy.HalfOpenProbes-b.successes-b.inFlight, 0))
+	}
+	return limit
+}
+
+// Cancel освобождает разрешённый запрос, прерванный остановкой агента: это не ошибка системы начислений
+func (b *breaker) Cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.inFlight > 0 {
+		b.inFlight--
+	}
+}
+
+// RetryAt - когда разомкнутая цепь пропустит пробные запросы
+func (b *breaker) RetryAt() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.openedAt.Add(b.policy.OpenTimeout)
+}
+
+func (b *breaker) Health() model.AccrualHealth {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+	health := model.AccrualHealth{State: b.state, Failures: b.failures}
+	if b.state != model.CircuitClosed {
+		openedAt, retryAt := b.openedAt, b.openedAt.Add(b.policy.OpenTimeout)
+		health.OpenedAt, health.RetryAt = &openedAt, &retryAt
+	}
+	return health
+}
+
+// advance переводит разомкнутую цепь в полуразомкнутую по истечении OpenTimeout; вызывается под мьютексом
+func (b *breaker) advance() {
+	if b.state == model.CircuitOpen && !b.now().Before(b.openedAt.Add(b.policy.OpenTimeout)) {
+		b.setState(model.CircuitHalfOpen)
+	}
+}
+
+func (b *breaker) setState(state string) {
+	b.state = state
+	b.successes = 0
+	if state == model.CircuitClosed {
+		b.failures = 0
+	}
+	metrics.Get("circuit_state").(*expvar.String).Set(state)
+}
@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/SversusN/gophermart/internal/accrualagent/model"
+)
+
+var testBreakerPolicy = BreakerPolicy{FailureThreshold: 3, OpenTimeout: time.Minute, HalfOpenProbes: 2}
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	b := newBreaker(testBreakerPolicy)
+	b.now = func() time.Time { return now }
+
+	// ответы, пусть и отказы, сбрасывают счётчик ошибок
+	for i := 0; i < 2; i++ {
+		require.NoError(t, b.Allow())
+		assert.False(t, b.Done(false))
+	}
+	require.NoError(t, b.Allow())
+	b.Done(true)
+	assert.Equal(t, model.AccrualHealth{State: model.CircuitClosed}, b.Health())
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, b.Allow())
+		assert.False(t, b.Done(false))
+	}
+	require.NoError(t, b.Allow())
+	assert.True(t, b.Done(false))
+	assert.Equal(t, model.CircuitOpen, b.Health().State)
+	assert.ErrorIs(t, b.Allow(), errCircuitOpen)
+	assert.Equal(t, 0, b.Capacity(10))
+	assert.Equal(t, now.Add(time.Minute), b.RetryAt())
+
+	// после паузы - не больше двух проб одновременно, ошибка пробы снова размыкает цепь
+	now = now.Add(time.Minute)
+	assert.Equal(t, model.CircuitHalfOpen, b.Health().State)
+	assert.Equal(t, 2, b.Capacity(10))
+	require.NoError(t, b.Allow())
+	require.NoError(t, b.Allow())
+	assert.ErrorIs(t, b.Allow(), errCircuitOpen)
+	b.Cancel()
+	assert.True(t, b.Done(false))
+	assert.Equal(t, model.CircuitOpen, b.Health().State)
+	assert.Equal(t, now.Add(time.Minute), b.RetryAt())
+
+	now = now.Add(time.Minute)
+	require.NoError(t, b.Allow())
+	b.Done(true)
+	assert.Equal(t, model.CircuitHalfOpen, b.Health().State)
+	assert.Equal(t, 1, b.Capacity(10))
+	require.NoError(t, b.Allow())
+	b.Done(true)
+	assert.Equal(t, model.AccrualHealth{State: model.CircuitClosed}, b.Health())
+	assert.Equal(t, 10, b.Capacity(10))
+}
+
+type breakerRepo struct {
+	mu      sync.Mutex
+	fetches int
+	retries []model.OrderRetry
+}
+
+func (r *breakerRepo) GetOrders(ctx context.Context, owner string, lim int, lease time.Duration) ([]model.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fetches++
+	return nil, nil
+}
+
+func (r *breakerRepo) UpdateOrderAccruals(ctx context.Context, owner string, orderAccruals []model.OrderAccrual) error {
+	return nil
+}
+
+func (r *breakerRepo) RetryOrder(ctx context.Context, owner string, retry model.OrderRetry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.retries = append(r.retries, retry)
+	return nil
+}
+
+func TestAgentStopsPollingWhenCircuitOpen(t *testing.T) {
+	requests := 0
+	accrual := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer accrual.Close()
+
+	repo := &breakerRepo{}
+	a := NewAgent(repo, accrual.URL, testSettings, testBreakerPolicy, zap.NewNop())
+	for i := 1; i <= 4; i++ {
+		require.NoError(t, a.workers.Acquire(context.Background()))
+		a.getOrdersAccrualWorker(context.Background(), model.Order{Number: uint64(i), Attempts: 2})
+	}
+
+	assert.Equal(t, testBreakerPolicy.FailureThreshold, requests)
+	require.Len(t, repo.retries, 4)
+	for _, retry := range repo.retries[:3] {
+		assert.Equal(t, 3, retry.Attempts)
+	}
+	// заказ, не отправленный из-за разомкнутой цепи, не тратит попытку и ждёт пробных запросов
+	assert.Equal(t, 2, repo.retries[3].Attempts)
+	assert.Equal(t, a.breaker.RetryAt(), repo.retries[3].NextAttemptAt)
+	assert.Equal(t, errCircuitOpen.Error(), repo.retries[3].LastError)
+
+	a.runGetOrdersForProcessing(context.Background())
+	assert.Zero(t, repo.fetches)
+	assert.Equal(t, model.CircuitOpen, a.Health().State)
+}
@@ -0,0 +1,123 @@
+package agent
+
+import (
+	"context"
+	"expvar"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultRetryAfter - пауза, если система начислений ответила 429 без понятного Retry-After
+const defaultRetryAfter = 60 * time.Second
+
+// rateLimitPattern - текст ответа 429 системы начислений
+var rateLimitPattern = regexp.MustCompile(`No more than (\d+) requests per minute allowed`)
+
+// metrics - состояние лимита для /api/admin/metrics
+var metrics = expvar.NewMap("accrual_agent")
+
+// limiter - общий для всех воркеров агента token bucket.
+// Пока система начислений не сообщила лимит, запросы не ограничиваются
+type limiter struct {
+	mu          sync.Mutex
+	perMinute   int
+	burst       float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+}
+
+func newLimiter(burst int) *limiter {
+	metrics.Set("rate_limit_per_minute", new(expvar.Int))
+	metrics.Set("paused_until", new(expvar.String))
+	metrics.Add("rate_limited_total", 0)
+	return &limiter{burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Wait ждёт свободный токен или конца паузы после 429
+func (l *limiter) Wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		delay := l.reserve(time.Now())
+		l.mu.Unlock()
+		if delay <= 0 {
+			return nil
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// reserve забирает токен и возвращает ноль или сколько ждать до следующей попытки; вызывается под мьютексом
+func (l *limiter) reserve(now time.Time) time.Duration {
+	if now.Before(l.pausedUntil) {
+		return l.pausedUntil.Sub(now)
+	}
+	if l.perMinute == 0 {
+		return 0
+	}
+	perSecond := float64(l.perMinute) / 60
+	l.tokens += now.Sub(l.last).Seconds() * perSecond
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / perSecond * float64(time.Second))
+}
+
+// Throttle обрабатывает ответ 429: останавливает все запросы до Retry-After
+// и, если в ответе указан лимит, дальше шлёт запросы не чаще него
+func (l *limiter) Throttle(retryAfter, body string) {
+	pause := defaultRetryAfter
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+		pause = time.Duration(seconds) * time.Second
+	}
+	perMinute := 0
+	if match := rateLimitPattern.FindStringSubmatch(body); match != nil {
+		perMinute, _ = strconv.Atoi(match[1])
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if until := now.Add(pause); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+		metrics.Get("paused_until").(*expvar.String).Set(until.Format(time.RFC3339))
+	}
+	if perMinute > 0 {
+		l.perMinute = perMinute
+		metrics.Get("rate_limit_per_minute").(*expvar.Int).Set(int64(perMinute))
+	}
+	// после паузы запросы идут с темпом лимита, а не пачкой
+	l.tokens = 0
+	l.last = l.pausedUntil
+	metrics.Add("rate_limited_total", 1)
+}
+
+// SetBurst меняет запас токенов под новое число воркеров; накопленное сверх нового запаса сгорает
+func (l *limiter) SetBurst(burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.burst = float64(burst)
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
+
+// PerMinute - текущий лимит запросов в минуту, 0 - без ограничения
+func (l *limiter) PerMinute() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.perMinute
+}
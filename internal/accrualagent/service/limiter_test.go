@@ -0,0 +1,106 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/SversusN/gophermart/internal/accrualagent/model"
+)
+
+func TestLimiterThrottle(t *testing.T) {
+	l := newLimiter(1)
+	assert.Equal(t, 0, l.PerMinute())
+	require.NoError(t, l.Wait(context.Background()))
+
+	l.Throttle("1", "No more than 600 requests per minute allowed\n")
+	assert.Equal(t, 600, l.PerMinute())
+	assert.Equal(t, "600", metrics.Get("rate_limit_per_minute").String())
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, l.Wait(context.Background()))
+	}
+	// секунда паузы и ещё три запроса с темпом 10 в секунду
+	assert.GreaterOrEqual(t, time.Since(start), 1200*time.Millisecond)
+}
+
+func TestLimiterWaitCancelled(t *testing.T) {
+	l := newLimiter(1)
+	l.Throttle("", "")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.Wait(ctx), context.DeadlineExceeded)
+	assert.Equal(t, 0, l.PerMinute())
+}
+
+func TestLimiterSetBurst(t *testing.T) {
+	l := newLimiter(5)
+	l.Throttle("0", "No more than 60 requests per minute allowed")
+	l.last = time.Now().Add(-time.Minute)
+
+	// меньше воркеров - меньше запросов подряд после простоя
+	l.SetBurst(2)
+	for i := 0; i < 2; i++ {
+		assert.Zero(t, l.reserve(time.Now()))
+	}
+	assert.Positive(t, l.reserve(time.Now()))
+
+	// больше воркеров - запас снова копится до нового размера
+	l.SetBurst(4)
+	now := time.Now()
+	l.last = now.Add(-time.Minute)
+	for i := 0; i < 4; i++ {
+		assert.Zero(t, l.reserve(now))
+	}
+	assert.Positive(t, l.reserve(now))
+}
+
+func TestRateLimitPausesAllWorkers(t *testing.T) {
+	var mu sync.Mutex
+	var limitedAt time.Time
+	var requests []time.Time
+	accrual := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if limitedAt.IsZero() {
+			limitedAt = time.Now()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte("No more than 60 requests per minute allowed"))
+			return
+		}
+		requests = append(requests, time.Now())
+		w.Write([]byte(`{"order":"1","status":"PROCESSING"}`))
+	}))
+	defer accrual.Close()
+
+	a := NewAgent(nil, accrual.URL, testSettings, testBreakerPolicy, zap.NewNop())
+	var orderAccrual model.OrderAccrual
+	assert.ErrorIs(t, a.getOrderFromAccrual(context.Background(), accrual.URL+"/api/orders/1", &orderAccrual), errRateLimited)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var orderAccrual model.OrderAccrual
+			assert.NoError(t, a.getOrderFromAccrual(context.Background(), accrual.URL+"/api/orders/1", &orderAccrual))
+		}()
+	}
+	wg.Wait()
+
+	require.Len(t, requests, 2)
+	for _, at := range requests {
+		assert.GreaterOrEqual(t, at.Sub(limitedAt), time.Second)
+	}
+	// после паузы - не чаще раза в секунду
+	assert.GreaterOrEqual(t, requests[1].Sub(requests[0]), 900*time.Millisecond)
+}
@@ -0,0 +1,58 @@
+package agent
+
+import (
+	"context"
+	"sync"
+)
+
+// pool ограничивает число одновременных опросов. Лимит меняется на ходу:
+// при уменьшении начатые опросы дорабатывают, а новые ждут, пока занятых станет меньше лимита
+type pool struct {
+	mu      sync.Mutex
+	limit   int
+	active  int
+	changed chan struct{}
+}
+
+func newPool(limit int) *pool {
+	return &pool{limit: limit, changed: make(chan struct{})}
+}
+
+// Acquire ждёт свободное место в пуле
+func (p *pool) Acquire(ctx context.Context) error {
+	for {
+		p.mu.Lock()
+		if p.active < p.limit {
+			p.active++
+			p.mu.Unlock()
+			return nil
+		}
+		changed := p.changed
+		p.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (p *pool) Release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.active--
+	p.notify()
+}
+
+func (p *pool) SetLimit(limit int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.limit = limit
+	p.notify()
+}
+
+// notify будит ожидающих Acquire; вызывается под мьютексом
+func (p *pool) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
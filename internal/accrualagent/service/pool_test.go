@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestPoolResize(t *testing.T) {
+	ctx := context.Background()
+	p := newPool(2)
+	require.NoError(t, p.Acquire(ctx))
+	require.NoError(t, p.Acquire(ctx))
+
+	// уменьшение лимита не трогает занятые места, новые ждут освобождения
+	p.SetLimit(1)
+	acquired := make(chan error, 1)
+	go func() { acquired <- p.Acquire(ctx) }()
+	p.Release()
+	select {
+	case <-acquired:
+		t.Fatal("acquired while the pool is over the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+	p.Release()
+	require.NoError(t, <-acquired)
+
+	// увеличение лимита сразу пропускает ожидающих
+	go func() { acquired <- p.Acquire(ctx) }()
+	p.SetLimit(2)
+	select {
+	case err := <-acquired:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("not acquired after the limit was raised")
+	}
+
+	cancelled, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, p.Acquire(cancelled), context.DeadlineExceeded)
+}
+
+func TestAgentReload(t *testing.T) {
+	a := NewAgent(nil, "", testSettings, testBreakerPolicy, zap.NewNop())
+	a.Reload(5, time.Minute, 3*time.Minute)
+	assert.Equal(t, time.Minute, a.interval())
+	assert.Equal(t, int64(3*time.Minute), a.lease.Load())
+	assert.Equal(t, 5, a.workers.limit)
+	assert.Equal(t, float64(5), a.limiter.burst)
+	// очередь опрашивается сразу, не дожидаясь старого периода
+	assert.Len(t, a.chSignalGetOrdersForProcessing, 1)
+}
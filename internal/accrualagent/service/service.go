@@ -2,31 +2,59 @@ package agent
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"go.uber.org/zap"
+	"io"
 	"net/http"
-	"strings"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/SversusN/gophermart/internal/accrualagent/model"
 )
 
 const (
-	timeoutClient       = 5
-	limitWorkers        = 3
-	bufSizeOrdersRecord = 3
-	limitQuery          = 10
-	timeoutLoadOrdersDB = 3
+	// пауза после неудачного опроса растёт вдвое от retryBaseDelay до retryMaxDelay
+	retryBaseDelay = 5 * time.Second
+	retryMaxDelay  = time.Hour
 )
 
+var (
+	errNotRegistered = errors.New("order is not registered in the accrual system")
+	errRateLimited   = errors.New("accrual system rate limit exceeded")
+)
+
+// Settings - настройки опроса системы начислений
+type Settings struct {
+	// ClientTimeout - срок запроса к системе начислений
+	ClientTimeout time.Duration
+	// Workers - сколько заказов опрашивается одновременно
+	Workers int
+	// BatchSize - сколько ответов записывается одной транзакцией
+	BatchSize int
+	// PollLimit - сколько заказов забирается из очереди за раз
+	PollLimit int
+	// PollInterval - как часто агент проверяет очередь и записывает накопленные ответы
+	PollInterval time.Duration
+	// Lease - на сколько агент забирает заказ: за это время он должен опросить его и записать ответ,
+	// иначе заказ снова попадёт в очередь
+	Lease time.Duration
+}
+
 type AgentInterface interface {
-	GetOrders(ctx context.Context, lim int) ([]model.Order, error)
-	UpdateOrderAccruals(ctx context.Context, orderAccruals []model.OrderAccrual) error
+	GetOrders(ctx context.Context, owner string, lim int, lease time.Duration) ([]model.Order, error)
+	UpdateOrderAccruals(ctx context.Context, owner string, orderAccruals []model.OrderAccrual) error
+	RetryOrder(ctx context.Context, owner string, retry model.OrderRetry) error
 }
 
 type Agent struct {
+	// id отличает агента среди реплик: заказы берутся в аренду на его имя
+	id                             string
 	r                              AgentInterface
 	client                         *http.Client
 	accrualURL                     string
@@ -34,57 +62,124 @@ type Agent struct {
 	chOrdersForProcessing          chan model.Order
 	chOrdersAccrual                chan model.OrderAccrual
 	chSignalGetOrdersForProcessing chan struct{}
-	chLimitWorkers                 chan int
+	workers                        *pool
+	batchSize                      int
+	pollLimit                      int
+	pollInterval                   atomic.Int64
+	lease                          atomic.Int64
+	limiter                        *limiter
+	breaker                        *breaker
 	log                            *zap.Logger
 }
 
-func NewAgent(r AgentInterface, accrualURL string, log *zap.Logger) *Agent {
-	return &Agent{
+func NewAgent(r AgentInterface, accrualURL string, settings Settings, policy BreakerPolicy, log *zap.Logger) *Agent {
+	a := &Agent{
+		id:                             agentID(),
 		r:                              r,
-		client:                         &http.Client{Timeout: time.Second * timeoutClient},
+		client:                         &http.Client{Timeout: settings.ClientTimeout},
 		accrualURL:                     accrualURL,
-		bufOrderForRecord:              make([]model.OrderAccrual, 0, bufSizeOrdersRecord),
+		bufOrderForRecord:              make([]model.OrderAccrual, 0, settings.BatchSize),
 		chOrdersForProcessing:          make(chan model.Order),
 		chOrdersAccrual:                make(chan model.OrderAccrual),
-		chSignalGetOrdersForProcessing: make(chan struct{}),
-		chLimitWorkers:                 make(chan int, limitWorkers),
+		chSignalGetOrdersForProcessing: make(chan struct{}, 1),
+		workers:                        newPool(settings.Workers),
+		batchSize:                      settings.BatchSize,
+		pollLimit:                      settings.PollLimit,
+		limiter:                        newLimiter(settings.Workers),
+		breaker:                        newBreaker(policy),
 		log:                            log,
 	}
+	a.pollInterval.Store(int64(settings.PollInterval))
+	a.lease.Store(int64(settings.Lease))
+	return a
 }
 
+// Reload меняет число воркеров, период опроса и аренду на ходу: начатые опросы не прерываются,
+// новый период действует сразу, новая аренда - со следующей выборки из очереди.
+// Запас токенов лимита запросов следует за числом воркеров
+func (a *Agent) Reload(workers int, pollInterval, lease time.Duration) {
+	a.workers.SetLimit(workers)
+	a.limiter.SetBurst(workers)
+	a.pollInterval.Store(int64(pollInterval))
+	a.lease.Store(int64(lease))
+	a.signalGetOrders()
+	a.log.Info("Agent.Reload: settings applied", zap.Int("workers", workers),
+		zap.Duration("poll_interval", pollInterval), zap.Duration("lease", lease))
+}
+
+func (a *Agent) interval() time.Duration {
+	return time.Duration(a.pollInterval.Load())
+}
+
+// agentID - имя агента: хост и процесс для логов, случайный суффикс на случай нескольких агентов в процессе
+func agentID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "agent"
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+// Start запускает агента; wg освобождается, когда записаны все накопленные ответы
 func (a *Agent) Start(ctx context.Context, wg *sync.WaitGroup) {
 	wg.Add(3)
-	defer wg.Done()
-	go a.GetOrders(ctx)
-	go a.GetOrdersAccrual(ctx)
-	go a.LoadOrdersAccrual(ctx)
+	go func() {
+		defer wg.Done()
+		a.GetOrders(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		a.GetOrdersAccrual(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		a.LoadOrdersAccrual(ctx)
+	}()
 }
 
 func (a *Agent) GetOrders(ctx context.Context) {
 
-	ticker := time.NewTicker(timeoutLoadOrdersDB * time.Second)
+	ticker := time.NewTicker(a.interval())
 	defer ticker.Stop()
 	for {
 		select {
 		case <-a.chSignalGetOrdersForProcessing:
 			a.runGetOrdersForProcessing(ctx)
-			ticker.Reset(timeoutLoadOrdersDB * time.Second)
+			ticker.Reset(a.interval())
 		case <-ticker.C:
 			a.runGetOrdersForProcessing(ctx)
+			ticker.Reset(a.interval())
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
+// Health - состояние связи с системой начислений
+func (a *Agent) Health() model.AccrualHealth {
+	return a.breaker.Health()
+}
+
 func (a *Agent) runGetOrdersForProcessing(ctx context.Context) {
-	orders, err := a.r.GetOrders(ctx, limitQuery)
+	// пока цепь разомкнута, заказы остаются в очереди, а после паузы берутся только на пробу
+	limit := a.breaker.Capacity(a.pollLimit)
+	if limit == 0 {
+		return
+	}
+	orders, err := a.r.GetOrders(ctx, a.id, limit, time.Duration(a.lease.Load()))
 	if err != nil {
 		a.log.Error("Agent.runGetOrdersForProcessing: GetOrdersForProcessing db error")
 	}
 
 	for _, numOrder := range orders {
-		a.chOrdersForProcessing <- numOrder
+		select {
+		case a.chOrdersForProcessing <- numOrder:
+		case <-ctx.Done():
+			// не отданные в работу заказы вернутся в очередь после аренды
+			return
+		}
 	}
 }
 
@@ -92,52 +187,118 @@ func (a *Agent) GetOrdersAccrual(ctx context.Context) {
 	for {
 		select {
 		case order := <-a.chOrdersForProcessing:
-			a.chLimitWorkers <- 1
-			go a.getOrdersAccrualWorker(order)
+			if err := a.workers.Acquire(ctx); err != nil {
+				// заказ вернётся в очередь после аренды
+				return
+			}
+			go a.getOrdersAccrualWorker(ctx, order)
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
-func (a *Agent) getOrdersAccrualWorker(order model.Order) {
+func (a *Agent) getOrdersAccrualWorker(ctx context.Context, order model.Order) {
+	defer a.workers.Release()
+
 	var orderAccrual model.OrderAccrual
 	uri := fmt.Sprintf("%s%s%d", a.accrualURL, "/api/orders/", order.Number)
-	err := a.getOrderFromAccrual(uri, &orderAccrual)
-	if err != nil {
-		<-a.chLimitWorkers
+	err := a.getOrderFromAccrual(ctx, uri, &orderAccrual)
+	// после 429 лимитер держит всех воркеров до Retry-After, затем заказ опрашивается снова
+	for errors.Is(err, errRateLimited) {
+		err = a.getOrderFromAccrual(ctx, uri, &orderAccrual)
+	}
+	switch {
+	case err == nil:
+	case ctx.Err() != nil:
+		// остановка - не ошибка заказа, он вернётся в очередь после аренды
+		return
+	case errors.Is(err, errCircuitOpen):
+		// заказ не опрашивался: попытка не засчитывается, опрос откладывается до пробных запросов
+		a.postpone(ctx, order, order.Attempts, a.breaker.RetryAt(), err)
+		return
+	default:
+		a.retry(ctx, order, err)
 		return
 	}
-	if order.Status != model.StatusUNKNOWN && order.Status != orderAccrual.Status {
-		a.chOrdersAccrual <- orderAccrual
-		<-a.chLimitWorkers
+
+	// ответ записывается и без смены статуса: так сбрасываются неудачные попытки и назначается следующий опрос
+	orderAccrual.NextAttemptAt = time.Now().Add(a.interval())
+	select {
+	case a.chOrdersAccrual <- orderAccrual:
+	case <-ctx.Done():
 	}
 }
 
-func (a *Agent) getOrderFromAccrual(url string, orderAccrual *model.OrderAccrual) error {
-	resp, err := a.client.Get(url)
+// retry откладывает опрос заказа с экспоненциально растущей паузой
+func (a *Agent) retry(ctx context.Context, order model.Order, cause error) {
+	attempts := order.Attempts + 1
+	a.postpone(ctx, order, attempts, time.Now().Add(retryDelay(attempts)), cause)
+}
+
+func (a *Agent) postpone(ctx context.Context, order model.Order, attempts int, next time.Time, cause error) {
+	err := a.r.RetryOrder(context.WithoutCancel(ctx), a.id, model.OrderRetry{
+		Order:         order.Number,
+		Attempts:      attempts,
+		NextAttemptAt: next,
+		LastError:     cause.Error(),
+	})
 	if err != nil {
-		a.log.Error("Agent.getJSONOrderFromAccrual: Get url error")
+		a.log.Error("Agent.postpone: RetryOrder db error", zap.Uint64("order", order.Number))
+	}
+}
+
+func retryDelay(attempts int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempts && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	return delay
+}
+
+func (a *Agent) getOrderFromAccrual(ctx context.Context, url string, orderAccrual *model.OrderAccrual) error {
+	if err := a.limiter.Wait(ctx); err != nil {
 		return err
 	}
-	if resp.StatusCode == http.StatusNoContent {
-		return nil
+	if err := a.breaker.Allow(); err != nil {
+		return err
 	}
-	if resp.StatusCode == http.StatusTooManyRequests {
-		secondsString := resp.Header.Get("Retry-After")
-		timeWait, err := time.ParseDuration(strings.Join([]string{secondsString, "s"}, ""))
-		if err != nil {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		a.breaker.Cancel()
+		return err
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			a.breaker.Cancel()
 			return err
 		}
-		time.Sleep(timeWait)
-		return nil
-	}
-	if resp.StatusCode == http.StatusInternalServerError {
-		a.log.Error("Agent.getJSONOrderFromAccrual: Get url internal server error")
-		return nil
+		a.report(false)
+		a.log.Error("Agent.getJSONOrderFromAccrual: Get url error", zap.Error(err))
+		return err
 	}
-
 	defer resp.Body.Close()
+	// цепь размыкают только отказы самой системы начислений: сетевые ошибки, таймауты и 5xx
+	a.report(resp.StatusCode < http.StatusInternalServerError)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent:
+		return errNotRegistered
+	case http.StatusTooManyRequests:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		a.limiter.Throttle(resp.Header.Get("Retry-After"), string(body))
+		a.log.Warn("Agent.getJSONOrderFromAccrual: accrual system rate limit",
+			zap.String("retry_after", resp.Header.Get("Retry-After")), zap.Int("per_minute", a.limiter.PerMinute()))
+		return errRateLimited
+	default:
+		a.log.Error("Agent.getJSONOrderFromAccrual: unexpected status", zap.Int("status", resp.StatusCode))
+		return fmt.Errorf("accrual system responded with status %d", resp.StatusCode)
+	}
 
 	err = json.NewDecoder(resp.Body).Decode(&orderAccrual)
 
@@ -148,37 +309,56 @@ func (a *Agent) getOrderFromAccrual(url string, orderAccrual *model.OrderAccrual
 	return nil
 }
 
+// report записывает итог запроса в предохранитель
+func (a *Agent) report(ok bool) {
+	if a.breaker.Done(ok) {
+		a.log.Warn("Agent: accrual system circuit is open, polling paused",
+			zap.Time("retry_at", a.breaker.RetryAt()))
+	}
+}
+
 func (a *Agent) LoadOrdersAccrual(ctx context.Context) {
-	ticker := time.NewTicker(timeoutLoadOrdersDB * time.Second)
+	ticker := time.NewTicker(a.interval())
 	defer ticker.Stop()
 	for {
 		select {
 		case order := <-a.chOrdersAccrual:
 			a.bufOrderForRecord = append(a.bufOrderForRecord, order)
-			if len(a.bufOrderForRecord) >= bufSizeOrdersRecord {
+			if len(a.bufOrderForRecord) >= a.batchSize {
 				a.send(ctx)
 			}
-			ticker.Reset(timeoutLoadOrdersDB * time.Second)
+			ticker.Reset(a.interval())
 		case <-ticker.C:
 			if len(a.bufOrderForRecord) > 0 {
 				a.send(ctx)
 			}
+			ticker.Reset(a.interval())
 		case <-ctx.Done():
+			// накопленные ответы записываются и при остановке
+			if len(a.bufOrderForRecord) > 0 {
+				a.send(context.WithoutCancel(ctx))
+			}
 			return
 		}
 	}
 }
 
+// send записывает накопленные ответы; при ошибке заказы не теряются, а опрашиваются снова после аренды
 func (a *Agent) send(ctx context.Context) {
-	ordersUpdate := make([]model.OrderAccrual, len(a.bufOrderForRecord))
-	copy(ordersUpdate, a.bufOrderForRecord)
-	a.bufOrderForRecord = make([]model.OrderAccrual, 0)
-	go func() {
-		err := a.r.UpdateOrderAccruals(ctx, ordersUpdate)
-		if err != nil {
-			a.log.Error("Agent.send: UpdateOrderAccruals db error")
-			return
-		}
-		a.chSignalGetOrdersForProcessing <- struct{}{}
-	}()
+	ordersUpdate := a.bufOrderForRecord
+	a.bufOrderForRecord = make([]model.OrderAccrual, 0, a.batchSize)
+	err := a.r.UpdateOrderAccruals(ctx, a.id, ordersUpdate)
+	if err != nil {
+		a.log.Error("Agent.send: UpdateOrderAccruals db error")
+		return
+	}
+	a.signalGetOrders()
+}
+
+// signalGetOrders просит опросить очередь, не дожидаясь таймера
+func (a *Agent) signalGetOrders() {
+	select {
+	case a.chSignalGetOrdersForProcessing <- struct{}{}:
+	default:
+	}
 }
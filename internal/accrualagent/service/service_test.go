@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	storage "github.com/SversusN/gophermart/internal/repository"
+	psql "github.com/SversusN/gophermart/internal/repository/psql"
+)
+
+var testSettings = Settings{
+	ClientTimeout: 5 * time.Second,
+	Workers:       3,
+	BatchSize:     3,
+	PollLimit:     10,
+	PollInterval:  3 * time.Second,
+	Lease:         30 * time.Second,
+}
+
+// TestAgentsShareOrders запускает несколько агентов на одной базе и проверяет, что каждый заказ
+// опрошен ровно один раз. Нужна база с правами на миграции: TEST_DATABASE_URI=postgres://... go test ./internal/accrualagent/...
+func TestAgentsShareOrders(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URI")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URI is not set")
+	}
+	const agents, orders = 3, 60
+
+	db, err := psql.NewPsql(dsn)
+	require.NoError(t, err)
+	defer db.DB.Close()
+	require.NoError(t, db.Init(dsn))
+
+	ctx := context.Background()
+	var userID int
+	err = db.DB.QueryRowContext(ctx, "INSERT INTO public.users(login, password) VALUES ($1, '') RETURNING id",
+		fmt.Sprintf("agent-test-%d", time.Now().UnixNano())).Scan(&userID)
+	require.NoError(t, err)
+	first := uint64(time.Now().UnixNano() / 1000)
+	for i := uint64(0); i < orders; i++ {
+		_, err = db.DB.ExecContext(ctx, "INSERT INTO public.accruals(order_num, user_id, status) VALUES ($1, $2, 'NEW')", first+i, userID)
+		require.NoError(t, err)
+	}
+
+	var mu sync.Mutex
+	polled := make(map[uint64]int)
+	accrual := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		number, err := strconv.ParseUint(path.Base(r.URL.Path), 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		polled[number]++
+		mu.Unlock()
+		// пока один агент ждёт ответа, другие успевают выбрать следующую пачку
+		time.Sleep(20 * time.Millisecond)
+		fmt.Fprintf(w, `{"order":"%d","status":"PROCESSED","accrual":1}`, number)
+	}))
+	defer accrual.Close()
+
+	agentCtx, stop := context.WithCancel(ctx)
+	wg := sync.WaitGroup{}
+	repo := storage.NewAgentRepository(db.DB, zap.NewNop())
+	for i := 0; i < agents; i++ {
+		NewAgent(repo, accrual.URL, testSettings, testBreakerPolicy, zap.NewNop()).Start(agentCtx, &wg)
+	}
+
+	require.Eventually(t, func() bool {
+		var processed int
+		err := db.DB.QueryRowContext(ctx,
+			"SELECT COUNT(*) FROM public.accruals WHERE order_num BETWEEN $1 AND $2 AND status = 'PROCESSED'",
+			first, first+orders-1).Scan(&processed)
+		return err == nil && processed == orders
+	}, 30*time.Second, 100*time.Millisecond)
+	stop()
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	// в общей базе агенты могут опросить и чужие заказы, проверяются только свои
+	for number := first; number < first+orders; number++ {
+		assert.Equal(t, 1, polled[number], "order %d polled %d times", number, polled[number])
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, retryBaseDelay, retryDelay(1))
+	assert.Equal(t, 2*retryBaseDelay, retryDelay(2))
+	assert.Equal(t, 8*retryBaseDelay, retryDelay(4))
+	assert.Equal(t, retryMaxDelay, retryDelay(100))
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/jwtauth/v5"
+
+	"github.com/SversusN/gophermart/internal/model"
+	errs "github.com/SversusN/gophermart/pkg/errors"
+)
+
+// changePassword POST /api/user/password - смена пароля, все выданные токены отзываются
+func (h *Handler) changePassword(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromToken(w, r, "changePassword")
+	if err != nil {
+		return
+	}
+
+	var request struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	defer r.Body.Close()
+	if err = json.NewDecoder(r.Body).Decode(&request); err != nil || request.CurrentPassword == "" || request.NewPassword == "" {
+		http.Error(w, errs.BadData, http.StatusBadRequest)
+		return
+	}
+
+	err = h.Service.Auth.ChangePassword(r.Context(), userID, request.CurrentPassword, request.NewPassword)
+	var validationErr errs.ValidationError
+	if errors.As(err, &validationErr) {
+		h.writeValidationError(w, validationErr)
+		return
+	} else if errors.As(err, &errs.AuthenticationError{}) {
+		http.Error(w, "invalid current password", http.StatusForbidden)
+		return
+	} else if err != nil {
+		h.log.Error("Handler.changePassword: ChangePassword service error")
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+		return
+	}
+
+	// старые сессии отозваны, клиенту выдается новая пара токенов с прежней ролью
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	role, _ := claims["role"].(string)
+	h.writeToken(w, r, &model.User{ID: userID, Role: role}, "changePassword")
+}
+
+// deleteUser DELETE /api/user[?force=true] - обезличивание аккаунта
+func (h *Handler) deleteUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromToken(w, r, "deleteUser")
+	if err != nil {
+		return
+	}
+
+	force := false
+	if value := r.URL.Query().Get("force"); value != "" {
+		force, err = strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, errs.BadData, http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = h.Service.Auth.DeleteUser(r.Context(), userID, force)
+	if errors.As(err, &errs.PositiveBalanceError{}) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if errors.As(err, &errs.AuthenticationError{}) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		h.log.Error("Handler.deleteUser: DeleteUser service error")
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
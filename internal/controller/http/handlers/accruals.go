@@ -2,10 +2,18 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 
+	"github.com/go-chi/chi/v5"
+
+	"github.com/SversusN/gophermart/internal/model"
 	errs "github.com/SversusN/gophermart/pkg/errors"
 	"github.com/SversusN/gophermart/pkg/util"
 )
@@ -67,6 +75,73 @@ func (h *Handler) loadOrders(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// loadOrdersBatch POST /api/user/orders/batch - загрузка нескольких заказов: JSON-массив номеров
+// (строками или числами) либо text/plain с номером на каждой строке. Результат - по каждому номеру.
+func (h *Handler) loadOrdersBatch(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromToken(w, r, "handler.loadOrdersBatch")
+	if err != nil {
+		return
+	}
+	defer r.Body.Close()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.log.Error("Handler.loadOrdersBatch: body read error")
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+		return
+	}
+
+	var numbers []string
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		var items []json.RawMessage
+		if err = json.Unmarshal(body, &items); err != nil {
+			http.Error(w, "expected a JSON array of order numbers", http.StatusBadRequest)
+			return
+		}
+		for _, item := range items {
+			var number string
+			if json.Unmarshal(item, &number) != nil {
+				number = string(item)
+			}
+			numbers = append(numbers, number)
+		}
+	case "text/plain":
+		for _, line := range strings.Split(string(body), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				numbers = append(numbers, line)
+			}
+		}
+	default:
+		http.Error(w, "expected application/json or text/plain", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	results, err := h.Service.Accrual.LoadOrders(r.Context(), userID, numbers)
+	var validationErr errs.ValidationError
+	if errors.As(err, &validationErr) {
+		h.writeValidationError(w, validationErr)
+		return
+	}
+	if err != nil {
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+		return
+	}
+
+	// как и для одного заказа: 202, если принято хоть что-то новое
+	status := http.StatusOK
+	for _, result := range results {
+		if result.Result == model.OrderAccepted {
+			status = http.StatusAccepted
+			break
+		}
+	}
+	h.writeJSON(w, status, results, "loadOrdersBatch")
+}
+
+// getUploadedOrders GET /api/user/orders - заказы пользователя от старых к новым, с order=desc - наоборот.
+// Параметры: limit, after (курсор из X-Next-Cursor), status через запятую, from и to по времени загрузки, order.
+// Без параметров возвращается весь список; ссылка на следующую страницу - в заголовке Link.
 func (h *Handler) getUploadedOrders(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "application/json")
 
@@ -75,11 +150,34 @@ func (h *Handler) getUploadedOrders(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	orders, err := h.Service.Accrual.GetUploadedOrders(r.Context(), userID)
+	query := r.URL.Query()
+	filter, violations := orderFilter(query)
+	filter.UserID = userID
+	if len(violations) > 0 {
+		h.writeValidationError(w, errs.ValidationError{Violations: violations})
+		return
+	}
+
+	page, err := h.Service.Accrual.GetOrders(r.Context(), filter, query.Get("after"))
+	var validationErr errs.ValidationError
+	if errors.As(err, &validationErr) {
+		h.writeValidationError(w, validationErr)
+		return
+	}
 	if err != nil {
 		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
 		return
 	}
+	orders := page.Orders
+
+	if page.NextCursor != "" {
+		next := *r.URL
+		nextQuery := next.Query()
+		nextQuery.Set("after", page.NextCursor)
+		next.RawQuery = nextQuery.Encode()
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+	}
 
 	if len(orders) == 0 {
 		w.WriteHeader(http.StatusNoContent)
@@ -95,3 +193,55 @@ func (h *Handler) getUploadedOrders(w http.ResponseWriter, r *http.Request) {
 
 	w.Write(output)
 }
+
+// getOrder GET /api/user/orders/{number} - заказ пользователя с историей статусов
+func (h *Handler) getOrder(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromToken(w, r, "handler.getOrder")
+	if err != nil {
+		return
+	}
+	number, err := strconv.ParseUint(chi.URLParam(r, "number"), 10, 64)
+	if err != nil {
+		http.Error(w, errs.CheckError{}.Error(), http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.Service.Accrual.GetOrder(r.Context(), userID, number)
+	switch err.(type) {
+	case nil:
+		h.writeJSON(w, http.StatusOK, order, "getOrder")
+	case errs.OrderNotFoundError:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+	}
+}
+
+func orderFilter(query url.Values) (model.OrderFilter, []errs.Violation) {
+	var filter model.OrderFilter
+	var violations []errs.Violation
+
+	if limit := query.Get("limit"); limit != "" {
+		var err error
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit <= 0 {
+			violations = append(violations, errs.Violation{Field: "limit", Rule: "range", Message: "limit must be a positive number"})
+		}
+	}
+	for _, value := range listParam(query, "status") {
+		status, err := model.GetStatus(value)
+		if err != nil {
+			violations = append(violations, errs.Violation{Field: "status", Rule: "one_of", Message: "unknown order status " + value})
+			continue
+		}
+		filter.Statuses = append(filter.Statuses, status)
+	}
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		filter.Descending = true
+	default:
+		violations = append(violations, errs.Violation{Field: "order", Rule: "one_of", Message: "order must be asc or desc"})
+	}
+	filter.From, filter.To, violations = dateRange(query, violations)
+	return filter, violations
+}
@@ -0,0 +1,251 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/SversusN/gophermart/internal/model"
+	errs "github.com/SversusN/gophermart/pkg/errors"
+)
+
+// adminFindUser GET /api/admin/users?login= - поиск пользователя по логину
+func (h *Handler) adminFindUser(w http.ResponseWriter, r *http.Request) {
+	login := h.Service.Auth.NormalizeLogin(r.URL.Query().Get("login"))
+	if login == "" {
+		http.Error(w, errs.BadData, http.StatusBadRequest)
+		return
+	}
+	info, err := h.Service.Admin.GetUserByLogin(r.Context(), login)
+	h.writeUserInfo(w, info, err)
+}
+
+// adminGetUser GET /api/admin/users/{id} - карточка пользователя с балансом
+func (h *Handler) adminGetUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.userIDFromPath(w, r)
+	if err != nil {
+		return
+	}
+	info, err := h.Service.Admin.GetUser(r.Context(), userID)
+	h.writeUserInfo(w, info, err)
+}
+
+func (h *Handler) writeUserInfo(w http.ResponseWriter, info *model.UserInfo, err error) {
+	if errors.As(err, &errs.UserNotFoundError{}) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, info, "writeUserInfo")
+}
+
+// adminGetOrders GET /api/admin/users/{id}/orders - заказы любого пользователя
+func (h *Handler) adminGetOrders(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.userIDFromPath(w, r)
+	if err != nil {
+		return
+	}
+	orders, err := h.Service.Accrual.GetUploadedOrders(r.Context(), userID)
+	if err != nil {
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+		return
+	}
+	if len(orders) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, orders, "adminGetOrders")
+}
+
+// adminGetWithdrawals GET /api/admin/users/{id}/withdrawals - списания любого пользователя
+func (h *Handler) adminGetWithdrawals(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.userIDFromPath(w, r)
+	if err != nil {
+		return
+	}
+	orders, err := h.Service.Withdraw.GetWithdrawalOfPoints(r.Context(), userID)
+	if err != nil {
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+		return
+	}
+	if len(orders) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, orders, "adminGetWithdrawals")
+}
+
+// adminAdjustBalance POST /api/admin/users/{id}/balance/adjustments - ручная корректировка баланса
+func (h *Handler) adminAdjustBalance(w http.ResponseWriter, r *http.Request) {
+	adminID, err := h.getUserIDFromToken(w, r, "adminAdjustBalance")
+	if err != nil {
+		return
+	}
+	userID, err := h.userIDFromPath(w, r)
+	if err != nil {
+		return
+	}
+
+	var adjustment model.BalanceAdjustment
+	defer r.Body.Close()
+	if err = json.NewDecoder(r.Body).Decode(&adjustment); err != nil {
+		http.Error(w, errs.BadData, http.StatusBadRequest)
+		return
+	}
+	adjustment.UserID, adjustment.AdminID = userID, adminID
+
+	err = h.Service.Admin.AdjustBalance(r.Context(), &adjustment)
+	var validationErr errs.ValidationError
+	if errors.As(err, &validationErr) {
+		h.writeValidationError(w, validationErr)
+		return
+	}
+	switch err.(type) {
+	case nil:
+		h.writeJSON(w, http.StatusCreated, adjustment, "adminAdjustBalance")
+	case errs.UserNotFoundError:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errs.ShowMeTheMoney:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+	}
+}
+
+// adminRequeueOrder POST /api/admin/orders/{number}/requeue - повторная отправка заказа агенту начислений
+func (h *Handler) adminRequeueOrder(w http.ResponseWriter, r *http.Request) {
+	adminID, err := h.getUserIDFromToken(w, r, "adminRequeueOrder")
+	if err != nil {
+		return
+	}
+	number, err := strconv.ParseUint(chi.URLParam(r, "number"), 10, 64)
+	if err != nil {
+		http.Error(w, errs.CheckError{}.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.Service.Admin.RequeueOrder(r.Context(), number, adminID)
+	switch err.(type) {
+	case nil:
+		w.WriteHeader(http.StatusAccepted)
+	case errs.OrderNotFoundError:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errs.OrderAlreadyProcessedError:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+	}
+}
+
+// adminGetLockouts GET /api/admin/lockouts - действующие блокировки входа
+func (h *Handler) adminGetLockouts(w http.ResponseWriter, r *http.Request) {
+	lockouts, err := h.Service.Guard.GetActiveLockouts(r.Context())
+	if err != nil {
+		h.log.Error("Handler.adminGetLockouts: GetActiveLockouts service error")
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+		return
+	}
+	if len(lockouts) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, lockouts, "adminGetLockouts")
+}
+
+// adminUnlockLogin DELETE /api/admin/lockouts/{login} - снятие блокировки входа
+func (h *Handler) adminUnlockLogin(w http.ResponseWriter, r *http.Request) {
+	adminID, err := h.getUserIDFromToken(w, r, "adminUnlockLogin")
+	if err != nil {
+		return
+	}
+	login := h.Service.Auth.NormalizeLogin(chi.URLParam(r, "login"))
+	if err = h.Service.Guard.Unlock(r.Context(), login, adminID); err != nil {
+		h.log.Error("Handler.adminUnlockLogin: Unlock service error")
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminUnlockIP DELETE /api/admin/lockouts/ip/{ip} - снятие блокировки входа с IP
+func (h *Handler) adminUnlockIP(w http.ResponseWriter, r *http.Request) {
+	adminID, err := h.getUserIDFromToken(w, r, "adminUnlockIP")
+	if err != nil {
+		return
+	}
+	ip := net.ParseIP(chi.URLParam(r, "ip"))
+	if ip == nil {
+		http.Error(w, errs.BadData, http.StatusBadRequest)
+		return
+	}
+	if err = h.Service.Guard.UnlockIP(r.Context(), ip.String(), adminID); err != nil {
+		h.log.Error("Handler.adminUnlockIP: UnlockIP service error")
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) userIDFromPath(w http.ResponseWriter, r *http.Request) (int, error) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, errs.BadData, http.StatusBadRequest)
+		return 0, err
+	}
+	return userID, nil
+}
+
+func (h *Handler) writeJSON(w http.ResponseWriter, status int, value interface{}, nameFunc string) {
+	output, err := json.Marshal(value)
+	if err != nil {
+		h.log.Error("Handler." + nameFunc + ": json marshal error")
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(output)
+}
+
+// adminReconcile GET /api/admin/ledger/reconciliation - расхождения журнала с колонками баланса в users
+func (h *Handler) adminReconcile(w http.ResponseWriter, r *http.Request) {
+	drifts, err := h.Service.Ledger.Reconcile(r.Context())
+	if err != nil {
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+		return
+	}
+	if drifts == nil {
+		drifts = []model.BalanceDrift{}
+	}
+	h.writeJSON(w, http.StatusOK, drifts, "adminReconcile")
+}
+
+// adminRefundWithdrawal POST /api/admin/withdrawals/{order}/refund - возврат списания поддержкой, без окна отмены
+func (h *Handler) adminRefundWithdrawal(w http.ResponseWriter, r *http.Request) {
+	adminID, err := h.getUserIDFromToken(w, r, "adminRefundWithdrawal")
+	if err != nil {
+		return
+	}
+	order, err := strconv.ParseUint(chi.URLParam(r, "order"), 10, 64)
+	if err != nil {
+		http.Error(w, errs.CheckError{}.Error(), http.StatusBadRequest)
+		return
+	}
+	var request struct {
+		Reason string `json:"reason"`
+	}
+	defer r.Body.Close()
+	if err = json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, errs.BadData, http.StatusBadRequest)
+		return
+	}
+
+	err = h.Service.Withdraw.RefundWithdrawal(r.Context(), order, adminID, request.Reason)
+	h.writeRefundResult(w, err)
+}
@@ -1,13 +1,18 @@
 package handler
 
 import (
+	"encoding/json"
 	"errors"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 
 	"github.com/SversusN/gophermart/internal/model"
 	errs "github.com/SversusN/gophermart/pkg/errors"
 )
 
+// registration POST /api/user/register; пустые логин и пароль возвращаются списком нарушений, как и другие правила
 func (h *Handler) registration(w http.ResponseWriter, r *http.Request) {
 	var user model.User
 	err := h.readUserData(w, r, &user, "registration")
@@ -17,7 +22,11 @@ func (h *Handler) registration(w http.ResponseWriter, r *http.Request) {
 
 	err = h.Service.Auth.CreateUser(r.Context(), &user)
 
-	if errors.As(err, &errs.ConflictLoginError{}) {
+	var validationErr errs.ValidationError
+	if errors.As(err, &validationErr) {
+		h.writeValidationError(w, validationErr)
+		return
+	} else if errors.As(err, &errs.ConflictLoginError{}) {
 		http.Error(w, err.Error(), http.StatusConflict)
 		return
 	} else if err != nil {
@@ -26,7 +35,7 @@ func (h *Handler) registration(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.writeToken(w, &user, "registration")
+	h.writeToken(w, r, &user, "registration")
 }
 
 func (h *Handler) authentication(w http.ResponseWriter, r *http.Request) {
@@ -35,10 +44,30 @@ func (h *Handler) authentication(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		return
 	}
+	if user.Login == "" || user.Password == "" {
+		http.Error(w, "empty login or password", http.StatusBadRequest)
+		return
+	}
+
+	login, ip := h.Service.Auth.NormalizeLogin(user.Login), clientIP(r)
+	err = h.Service.Guard.Check(r.Context(), login, ip)
+	var tooMany errs.TooManyAttemptsError
+	if errors.As(err, &tooMany) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(tooMany.RetryAfter.Seconds()))))
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	} else if err != nil {
+		h.log.Error("Handler.authentication: Guard.Check service error")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
 
 	err = h.Service.Auth.AuthenticationUser(r.Context(), &user)
 
 	if errors.As(err, &errs.AuthenticationError{}) {
+		if guardErr := h.Service.Guard.Fail(r.Context(), login, ip); guardErr != nil {
+			h.log.Error("Handler.authentication: Guard.Fail service error")
+		}
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	} else if err != nil {
@@ -46,5 +75,29 @@ func (h *Handler) authentication(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
-	h.writeToken(w, &user, "Authentication")
+	if err = h.Service.Guard.Succeed(r.Context(), login); err != nil {
+		h.log.Error("Handler.authentication: Guard.Succeed service error")
+	}
+	h.writeToken(w, r, &user, "Authentication")
+}
+
+func (h *Handler) writeValidationError(w http.ResponseWriter, validationErr errs.ValidationError) {
+	output, err := json.Marshal(validationErr)
+	if err != nil {
+		h.log.Error("Handler.writeValidationError: json marshal error")
+		http.Error(w, errs.BadData, http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write(output)
+}
+
+// clientIP - адрес клиента без порта; заголовкам прокси не доверяем
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
@@ -2,10 +2,13 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	errs "github.com/SversusN/gophermart/pkg/errors"
 	"github.com/SversusN/gophermart/pkg/util"
+	"github.com/go-chi/chi/v5"
 	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/SversusN/gophermart/internal/model"
 )
@@ -19,9 +22,11 @@ func (h *Handler) getBalance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	accruals, withdraws := h.Service.Withdraw.GetBalance(r.Context(), userID)
-
-	balance := model.Balance{Current: accruals - withdraws, Withdrawn: withdraws}
+	balance, err := h.Service.Ledger.GetBalance(r.Context(), userID)
+	if err != nil {
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+		return
+	}
 
 	output, err := json.Marshal(balance)
 	if err != nil {
@@ -105,3 +110,74 @@ func (h *Handler) getWithdrawalOfPoints(w http.ResponseWriter, r *http.Request)
 	}
 	w.Write(output)
 }
+
+// cancelWithdrawal POST /api/user/withdrawals/{order}/cancel - отмена списания с возвратом баллов
+func (h *Handler) cancelWithdrawal(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromToken(w, r, "handler.cancelWithdrawal")
+	if err != nil {
+		return
+	}
+	order, err := strconv.ParseUint(chi.URLParam(r, "order"), 10, 64)
+	if err != nil {
+		http.Error(w, errs.CheckError{}.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.Service.Withdraw.CancelWithdrawal(r.Context(), userID, order)
+	h.writeRefundResult(w, err)
+}
+
+func (h *Handler) writeRefundResult(w http.ResponseWriter, err error) {
+	var validationErr errs.ValidationError
+	if errors.As(err, &validationErr) {
+		h.writeValidationError(w, validationErr)
+		return
+	}
+	switch err.(type) {
+	case nil:
+		w.WriteHeader(http.StatusOK)
+	case errs.WithdrawalNotFoundError:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errs.WithdrawalAlreadyRefundedError, errs.WithdrawalStatusError:
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errs.CancellationWindowExpiredError:
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+	}
+}
+
+// shopConfirmWithdrawal POST /api/shop/withdrawals/{order}/confirm - магазин подтверждает заказ,
+// удержанные баллы окончательно списываются
+func (h *Handler) shopConfirmWithdrawal(w http.ResponseWriter, r *http.Request) {
+	order, err := strconv.ParseUint(chi.URLParam(r, "order"), 10, 64)
+	if err != nil {
+		http.Error(w, errs.CheckError{}.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.Service.Withdraw.ConfirmWithdrawal(r.Context(), order)
+	h.writeRefundResult(w, err)
+}
+
+// shopRejectWithdrawal POST /api/shop/withdrawals/{order}/reject - магазин отклоняет заказ,
+// удержание снимается; тело с причиной необязательно
+func (h *Handler) shopRejectWithdrawal(w http.ResponseWriter, r *http.Request) {
+	order, err := strconv.ParseUint(chi.URLParam(r, "order"), 10, 64)
+	if err != nil {
+		http.Error(w, errs.CheckError{}.Error(), http.StatusBadRequest)
+		return
+	}
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err = json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, errs.CheckError{}.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = h.Service.Withdraw.RejectWithdrawal(r.Context(), order, input.Reason)
+	h.writeRefundResult(w, err)
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/SversusN/gophermart/internal/model"
+	storage "github.com/SversusN/gophermart/internal/repository"
+	psql "github.com/SversusN/gophermart/internal/repository/psql"
+	"github.com/SversusN/gophermart/internal/service"
+	"github.com/SversusN/gophermart/pkg/keyring"
+)
+
+// testDBHandler собирает обработчики поверх настоящей базы. Нужна отдельная база:
+// TEST_DATABASE_URI=postgres://... go test ./internal/controller/http/handlers/...
+func testDBHandler(t *testing.T) http.Handler {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URI")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URI is not set")
+	}
+	db, err := psql.NewPsql(dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.DB.Close() })
+	require.NoError(t, db.Init(dsn))
+
+	conf := testConfig()
+	conf.PasswordHashAlgorithm = "bcrypt"
+	conf.OrdersBatchLimit = 100
+	services := service.NewService(storage.NewRepository(db.DB, zap.NewNop()), conf, zap.NewNop())
+	tokenAuth, _ := keyring.Ephemeral()
+	return NewHandler(services, tokenAuth, zap.NewNop()).CreateRouter()
+}
+
+// postJSON отправляет запрос и разбирает пару токенов из успешного ответа
+func postJSON(t *testing.T, r http.Handler, target, body string) (int, model.TokenPair) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var tokens model.TokenPair
+	if w.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tokens))
+	}
+	return w.Code, tokens
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	r := testDBHandler(t)
+	credentials := fmt.Sprintf(`{"login":"reuse%d","password":"Passw0rd!"}`, time.Now().UnixNano())
+	code, issued := postJSON(t, r, "/api/user/register", credentials)
+	require.Equal(t, http.StatusOK, code)
+
+	refresh := fmt.Sprintf(`{"refresh_token":%q}`, issued.RefreshToken)
+	code, rotated := postJSON(t, r, "/api/user/token/refresh", refresh)
+	require.Equal(t, http.StatusOK, code)
+
+	// повтор уже обменянного токена отзывает всю сессию
+	code, _ = postJSON(t, r, "/api/user/token/refresh", refresh)
+	require.Equal(t, http.StatusUnauthorized, code)
+	code, _ = postJSON(t, r, "/api/user/token/refresh", fmt.Sprintf(`{"refresh_token":%q}`, rotated.RefreshToken))
+	require.Equal(t, http.StatusUnauthorized, code)
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SversusN/gophermart/internal/model"
+	errs "github.com/SversusN/gophermart/pkg/errors"
+)
+
+const (
+	defaultStreamHeartbeat = 15 * time.Second
+	// streamRetry - через сколько миллисекунд браузер переподключается после обрыва
+	streamRetry = 3000
+)
+
+// streamOrders GET /api/user/orders/stream - смена статусов заказов пользователя через Server-Sent Events.
+// С заголовком Last-Event-ID сначала отдаются все события, пропущенные после обрыва, в том числе
+// переходы с меньшим id, зафиксированные позже события Last-Event-ID
+func (h *Handler) streamOrders(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromToken(w, r, "handler.streamOrders")
+	if err != nil {
+		return
+	}
+	var lastEventID int64
+	if header := r.Header.Get("Last-Event-ID"); header != "" {
+		lastEventID, err = strconv.ParseInt(header, 10, 64)
+		if err != nil || lastEventID < 0 {
+			http.Error(w, errs.BadData, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// подписка раньше чтения истории, чтобы не потерять событие между ними
+	events, unsubscribe := h.Service.Events.Subscribe(userID)
+	defer unsubscribe()
+
+	var backlog []model.OrderEvent
+	more := lastEventID > 0
+	if more {
+		backlog, more, err = h.Service.Events.Replay(r.Context(), userID, lastEventID, 0)
+		if err != nil {
+			http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	stream := http.NewResponseController(w)
+	// поток живёт дольше таймаута записи сервера; тестовый ResponseRecorder дедлайнов не поддерживает
+	stream.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry)
+
+	replayed := make(map[int64]struct{}, len(backlog))
+	lastSent := lastEventID
+	for {
+		for _, event := range backlog {
+			replayed[event.ID] = struct{}{}
+			if !h.writeEvent(w, event) {
+				return
+			}
+			lastSent = event.ID
+		}
+		if err = stream.Flush(); err != nil {
+			return
+		}
+		if !more {
+			break
+		}
+		backlog, more, err = h.Service.Events.Replay(r.Context(), userID, lastEventID, lastSent)
+		if err != nil {
+			// клиент переподключится и дочитает остальное по Last-Event-ID
+			return
+		}
+	}
+	if lastSent < lastEventID {
+		// последним ушёл переход с меньшим id: возвращаем браузеру прежний Last-Event-ID,
+		// иначе следующее переподключение повторит уже полученное. Сообщение без data событием не считается
+		if _, err = fmt.Fprintf(w, "id: %d\n\n", lastEventID); err != nil {
+			return
+		}
+		if err = stream.Flush(); err != nil {
+			return
+		}
+	}
+
+	heartbeat := h.StreamHeartbeat
+	if heartbeat <= 0 {
+		heartbeat = defaultStreamHeartbeat
+	}
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				// отключены хабом, клиент дочитает пропущенное по Last-Event-ID
+				return
+			}
+			if _, ok = replayed[event.ID]; ok {
+				continue
+			}
+			if !h.writeEvent(w, event) {
+				return
+			}
+		case <-ticker.C:
+			if _, err = fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		if err = stream.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (h *Handler) writeEvent(w http.ResponseWriter, event model.OrderEvent) bool {
+	data, err := json.Marshal(event)
+	if err != nil {
+		h.log.Error("Handler.streamOrders: json marshal error")
+		return false
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: order\ndata: %s\n\n", event.ID, data)
+	return err == nil
+}
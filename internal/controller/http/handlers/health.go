@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	agentmodel "github.com/SversusN/gophermart/internal/accrualagent/model"
+	errs "github.com/SversusN/gophermart/pkg/errors"
+)
+
+type HealthChecker interface {
+	Health() agentmodel.AccrualHealth
+}
+
+// health отвечает 200, пока сервис работает: при разомкнутой цепи заказы принимаются,
+// но не опрашиваются, поэтому статус - degraded
+func (h *Handler) health(w http.ResponseWriter, r *http.Request) {
+	response := struct {
+		Status  string                    `json:"status"`
+		Accrual *agentmodel.AccrualHealth `json:"accrual,omitempty"`
+	}{Status: "ok"}
+	if h.Accrual != nil {
+		accrual := h.Accrual.Health()
+		response.Accrual = &accrual
+		if accrual.State == agentmodel.CircuitOpen {
+			response.Status = "degraded"
+		}
+	}
+	output, err := json.Marshal(response)
+	if err != nil {
+		h.log.Error("Handler.health: json marshal error")
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(output)
+}
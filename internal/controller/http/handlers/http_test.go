@@ -1,13 +1,18 @@
 package handler
 
 import (
+	"bufio"
+	"context"
 	"crypto/sha1"
+	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -15,12 +20,19 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/SversusN/gophermart/config"
+	agentmodel "github.com/SversusN/gophermart/internal/accrualagent/model"
 	"github.com/SversusN/gophermart/internal/controller/http/handlers/mock"
 	"github.com/SversusN/gophermart/internal/model"
 	storage "github.com/SversusN/gophermart/internal/repository"
+	"github.com/SversusN/gophermart/internal/repository/memory"
 	"github.com/SversusN/gophermart/internal/service"
+	"github.com/SversusN/gophermart/pkg/cursor"
 	errs "github.com/SversusN/gophermart/pkg/errors"
+	"github.com/SversusN/gophermart/pkg/hasher"
+	"github.com/SversusN/gophermart/pkg/keyring"
 	"github.com/SversusN/gophermart/pkg/logger"
+	"github.com/SversusN/gophermart/pkg/webhook"
 )
 
 func parceUint(value string) uint64 {
@@ -32,15 +44,54 @@ func parceUint(value string) uint64 {
 }
 
 const (
-	secretKey = "be55d1079e6c6167118ac91318fe"
+	secretKey     = "be55d1079e6c6167118ac91318fe"
+	testSessionID = "test-session"
 )
 
+func testConfig() *config.Config {
+	return &config.Config{
+		AccessTokenTTL:     time.Minute,
+		RefreshTokenTTL:    time.Hour,
+		LoginMaxFailures:   10,
+		LoginMaxIPFailures: 100,
+		LoginLockout:       time.Minute,
+		LoginFailureWindow: time.Minute,
+
+		WithdrawalCancelWindow: 24 * time.Hour,
+	}
+}
+
+// generatePasswordHash - хеш в старом формате (SHA-1 без соли)
 func generatePasswordHash(password string) string {
 	hash := sha1.New()
 	hash.Write([]byte(password))
 	return fmt.Sprintf("%x", hash.Sum([]byte(secretKey)))
 }
 
+func bcryptHash(password string) string {
+	hash, _ := hasher.NewBcrypt(0).Hash(password)
+	return hash
+}
+
+// userMatcher проверяет, что в хранилище уходит хеш пароля, а не сам пароль
+type userMatcher struct {
+	login    string
+	password string
+}
+
+func (m userMatcher) Matches(x interface{}) bool {
+	user, ok := x.(*model.User)
+	if !ok || user.Login != m.login {
+		return false
+	}
+	ok, err := hasher.MustNew(hasher.Bcrypt).Verify(m.password, user.Password)
+	return err == nil && ok
+}
+
+func (m userMatcher) String() string {
+	return fmt.Sprintf("user %q with hashed password %q", m.login, m.password)
+}
+
 func TestRegisterUser(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -48,11 +99,18 @@ func TestRegisterUser(t *testing.T) {
 	auth := http_mocks.NewMockAuthRepoInterface(ctrl)
 	acc := http_mocks.NewMockAccrualOrderInterface(ctrl)
 	withdraw := http_mocks.NewMockWithdrawOrderRepoInterface(ctrl)
+	tokens := http_mocks.NewMockTokenRepoInterface(ctrl)
+	tokens.EXPECT().CreateSession(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	tokens.EXPECT().IsSessionRevoked(gomock.Any(), testSessionID).Return(false, nil).AnyTimes()
 	var rep = storage.Repository{Auth: auth,
+		Token:    tokens,
+		Attempts: memory.NewLoginAttempts(),
+		Lockout:  http_mocks.NewMockLockoutRepoInterface(ctrl),
 		Accrual:  acc,
 		Withdraw: withdraw}
-	services := service.NewService(&rep, log)
-	h := NewHandler(services, log)
+	services := service.NewService(&rep, testConfig(), log)
+	tokenAuth, _ := keyring.Ephemeral()
+	h := NewHandler(services, tokenAuth, log)
 	r := h.CreateRouter()
 
 	type want struct {
@@ -133,10 +191,10 @@ func TestRegisterUser(t *testing.T) {
 
 			if tt.storageRes != nil {
 				auth.EXPECT().
-					CreateUser(gomock.Any(), &model.User{ID: 0, Login: "user", Password: generatePasswordHash("1")}).Times(1).
+					CreateUser(gomock.Any(), userMatcher{login: "user", password: "1"}).Times(1).
 					Return(tt.storageRes.userID, tt.storageRes.err)
 			} else {
-				auth.EXPECT().CreateUser(gomock.Any(), &model.User{ID: 0, Password: generatePasswordHash("1")}).Times(0)
+				auth.EXPECT().CreateUser(gomock.Any(), gomock.Any()).Times(0)
 			}
 			r.ServeHTTP(w, req)
 
@@ -155,11 +213,18 @@ func TestLogin(t *testing.T) {
 	auth := http_mocks.NewMockAuthRepoInterface(ctrl)
 	acc := http_mocks.NewMockAccrualOrderInterface(ctrl)
 	withdraw := http_mocks.NewMockWithdrawOrderRepoInterface(ctrl)
+	tokens := http_mocks.NewMockTokenRepoInterface(ctrl)
+	tokens.EXPECT().CreateSession(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	tokens.EXPECT().IsSessionRevoked(gomock.Any(), testSessionID).Return(false, nil).AnyTimes()
 	var rep = storage.Repository{Auth: auth,
+		Token:    tokens,
+		Attempts: memory.NewLoginAttempts(),
+		Lockout:  http_mocks.NewMockLockoutRepoInterface(ctrl),
 		Accrual:  acc,
 		Withdraw: withdraw}
-	services := service.NewService(&rep, log)
-	h := NewHandler(services, log)
+	services := service.NewService(&rep, testConfig(), log)
+	tokenAuth, _ := keyring.Ephemeral()
+	h := NewHandler(services, tokenAuth, log)
 	r := h.CreateRouter()
 
 	type want struct {
@@ -170,8 +235,9 @@ func TestLogin(t *testing.T) {
 		contentType string
 	}
 	type storageRes struct {
-		userID int
+		user   *model.User
 		err    error
+		rehash bool
 	}
 
 	tests := []struct {
@@ -190,8 +256,23 @@ func TestLogin(t *testing.T) {
 				statusCode: http.StatusOK,
 			},
 			storageRes: &storageRes{
-				userID: 0,
+				user: &model.User{ID: 1, Login: "user", Password: bcryptHash("1")},
+				err:  nil,
+			},
+		},
+		{
+			name: "Legacy SHA-1 hash is upgraded",
+			request: request{
+				body:        `{"login":"user","password":"1"}`,
+				contentType: "application/json",
+			},
+			want: want{
+				statusCode: http.StatusOK,
+			},
+			storageRes: &storageRes{
+				user:   &model.User{ID: 1, Login: "user", Password: generatePasswordHash("1")},
 				err:    nil,
+				rehash: true,
 			},
 		},
 		{
@@ -215,8 +296,22 @@ func TestLogin(t *testing.T) {
 				statusCode: http.StatusUnauthorized,
 			},
 			storageRes: &storageRes{
-				userID: 0,
-				err:    errs.AuthenticationError{},
+				user: &model.User{ID: 1, Login: "user", Password: bcryptHash("1")},
+				err:  nil,
+			},
+		},
+		{
+			name: "Unknown login",
+			request: request{
+				body:        `{"login":"user","password":"1"}`,
+				contentType: "application/json",
+			},
+			want: want{
+				statusCode: http.StatusUnauthorized,
+			},
+			storageRes: &storageRes{
+				user: nil,
+				err:  errs.AuthenticationError{},
 			},
 		},
 	}
@@ -226,14 +321,20 @@ func TestLogin(t *testing.T) {
 			req := httptest.NewRequest(http.MethodPost, "/api/user/login", strings.NewReader(tt.request.body))
 			req.Header.Set("Content-Type", tt.request.contentType)
 			w := httptest.NewRecorder()
-			if tt.name == "BAD password" {
-				auth.EXPECT().GetUserID(gomock.Any(), &model.User{ID: tt.storageRes.userID, Login: "user", Password: generatePasswordHash("123")}).
-					Return(0, errs.AuthenticationError{})
-			} else if tt.storageRes != nil {
-				auth.EXPECT().GetUserID(gomock.Any(), &model.User{ID: tt.storageRes.userID, Login: "user", Password: generatePasswordHash("1")}).
-					Return(tt.storageRes.userID, nil).Times(1)
+			if tt.storageRes != nil {
+				auth.EXPECT().GetUserByLogin(gomock.Any(), "user").
+					Return(tt.storageRes.user, tt.storageRes.err).Times(1)
 			} else {
-				auth.EXPECT().GetUserID(gomock.Any(), &model.User{ID: 0, Login: "user", Password: generatePasswordHash("1")}).Times(0)
+				auth.EXPECT().GetUserByLogin(gomock.Any(), gomock.Any()).Times(0)
+			}
+			if tt.storageRes != nil && tt.storageRes.rehash {
+				auth.EXPECT().UpdatePassword(gomock.Any(), tt.storageRes.user.ID, gomock.Any()).
+					DoAndReturn(func(_ context.Context, _ int, hash string) error {
+						ok, err := hasher.NewBcrypt(0).Verify("1", hash)
+						assert.NoError(t, err)
+						assert.True(t, ok)
+						return nil
+					}).Times(1)
 			}
 
 			r.ServeHTTP(w, req)
@@ -253,11 +354,18 @@ func TestCreateOrder(t *testing.T) {
 	auth := http_mocks.NewMockAuthRepoInterface(ctrl)
 	acc := http_mocks.NewMockAccrualOrderInterface(ctrl)
 	withdraw := http_mocks.NewMockWithdrawOrderRepoInterface(ctrl)
+	tokens := http_mocks.NewMockTokenRepoInterface(ctrl)
+	tokens.EXPECT().CreateSession(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	tokens.EXPECT().IsSessionRevoked(gomock.Any(), testSessionID).Return(false, nil).AnyTimes()
 	var rep = storage.Repository{Auth: auth,
+		Token:    tokens,
+		Attempts: memory.NewLoginAttempts(),
+		Lockout:  http_mocks.NewMockLockoutRepoInterface(ctrl),
 		Accrual:  acc,
 		Withdraw: withdraw}
-	services := service.NewService(&rep, log)
-	h := NewHandler(services, log)
+	services := service.NewService(&rep, testConfig(), log)
+	tokenAuth, _ := keyring.Ephemeral()
+	h := NewHandler(services, tokenAuth, log)
 	r := h.CreateRouter()
 
 	type want struct {
@@ -355,7 +463,7 @@ func TestCreateOrder(t *testing.T) {
 			req := httptest.NewRequest(http.MethodPost, "/api/user/orders", strings.NewReader(tt.request.orderNum))
 			if tt.request.isAuth {
 				req.Header.Set("Content-Type", tt.request.contentType)
-				token, _ := services.Auth.GenerateToken(&model.User{ID: 1, Login: "user", Password: "1"}, h.TokenAuth)
+				token, _ := services.Token.GenerateToken(&model.User{ID: 1, Login: "user", Password: "1"}, testSessionID, h.TokenAuth)
 				req.Header.Set("Authorization", "Bearer "+token)
 			}
 			w := httptest.NewRecorder()
@@ -392,11 +500,18 @@ func TestGetOrders(t *testing.T) {
 	auth := http_mocks.NewMockAuthRepoInterface(ctrl)
 	acc := http_mocks.NewMockAccrualOrderInterface(ctrl)
 	withdraw := http_mocks.NewMockWithdrawOrderRepoInterface(ctrl)
+	tokens := http_mocks.NewMockTokenRepoInterface(ctrl)
+	tokens.EXPECT().CreateSession(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	tokens.EXPECT().IsSessionRevoked(gomock.Any(), testSessionID).Return(false, nil).AnyTimes()
 	var rep = storage.Repository{Auth: auth,
+		Token:    tokens,
+		Attempts: memory.NewLoginAttempts(),
+		Lockout:  http_mocks.NewMockLockoutRepoInterface(ctrl),
 		Accrual:  acc,
 		Withdraw: withdraw}
-	services := service.NewService(&rep, log)
-	h := NewHandler(services, log)
+	services := service.NewService(&rep, testConfig(), log)
+	tokenAuth, _ := keyring.Ephemeral()
+	h := NewHandler(services, tokenAuth, log)
 	r := h.CreateRouter()
 
 	type want struct {
@@ -463,7 +578,7 @@ func TestGetOrders(t *testing.T) {
 						UserID:     1,
 						Number:     parceUint("9278923470"),
 						Status:     model.StatusPROCESSED,
-						Accrual:    500,
+						Accrual:    500 * model.Point,
 						UploadedAt: time.Date(2024, 01, 01, 01, 01, 01, 0, time.Local),
 					},
 					{
@@ -494,7 +609,7 @@ func TestGetOrders(t *testing.T) {
 			req := httptest.NewRequest(http.MethodGet, "/api/user/orders", nil)
 
 			if tt.request.isAuth {
-				token, _ := services.Auth.GenerateToken(&model.User{ID: 1, Login: "user", Password: "1"}, h.TokenAuth)
+				token, _ := services.Token.GenerateToken(&model.User{ID: 1, Login: "user", Password: "1"}, testSessionID, h.TokenAuth)
 				req.Header.Set("Authorization", "Bearer "+token)
 			}
 			w := httptest.NewRecorder()
@@ -531,11 +646,18 @@ func TestWithdraw(t *testing.T) {
 	auth := http_mocks.NewMockAuthRepoInterface(ctrl)
 	acc := http_mocks.NewMockAccrualOrderInterface(ctrl)
 	withdraw := http_mocks.NewMockWithdrawOrderRepoInterface(ctrl)
+	tokens := http_mocks.NewMockTokenRepoInterface(ctrl)
+	tokens.EXPECT().CreateSession(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	tokens.EXPECT().IsSessionRevoked(gomock.Any(), testSessionID).Return(false, nil).AnyTimes()
 	var rep = storage.Repository{Auth: auth,
+		Token:    tokens,
+		Attempts: memory.NewLoginAttempts(),
+		Lockout:  http_mocks.NewMockLockoutRepoInterface(ctrl),
 		Accrual:  acc,
 		Withdraw: withdraw}
-	services := service.NewService(&rep, log)
-	h := NewHandler(services, log)
+	services := service.NewService(&rep, testConfig(), log)
+	tokenAuth, _ := keyring.Ephemeral()
+	h := NewHandler(services, tokenAuth, log)
 	r := h.CreateRouter()
 
 	type want struct {
@@ -643,7 +765,7 @@ func TestWithdraw(t *testing.T) {
 			req := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", strings.NewReader(tt.request.body))
 			req.Header.Set("Content-Type", tt.request.contentType)
 			if tt.request.isAuth {
-				token, _ := services.Auth.GenerateToken(&model.User{ID: 1, Login: "user", Password: "1"}, h.TokenAuth)
+				token, _ := services.Token.GenerateToken(&model.User{ID: 1, Login: "user", Password: "1"}, testSessionID, h.TokenAuth)
 				req.Header.Set("Authorization", "Bearer "+token)
 			}
 
@@ -654,7 +776,7 @@ func TestWithdraw(t *testing.T) {
 					DeductPoints(gomock.Any(), &model.WithdrawOrder{
 						UserID: 1,
 						Order:  parceUint(tt.repReq.Number),
-						Sum:    float32(tt.repReq.Sum),
+						Sum:    model.MoneyFromFloat(tt.repReq.Sum),
 					}).
 					Return(tt.repRes.err).
 					Times(1)
@@ -677,11 +799,18 @@ func TestGetWithdraws(t *testing.T) {
 	auth := http_mocks.NewMockAuthRepoInterface(ctrl)
 	acc := http_mocks.NewMockAccrualOrderInterface(ctrl)
 	withdraw := http_mocks.NewMockWithdrawOrderRepoInterface(ctrl)
+	tokens := http_mocks.NewMockTokenRepoInterface(ctrl)
+	tokens.EXPECT().CreateSession(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	tokens.EXPECT().IsSessionRevoked(gomock.Any(), testSessionID).Return(false, nil).AnyTimes()
 	var rep = storage.Repository{Auth: auth,
+		Token:    tokens,
+		Attempts: memory.NewLoginAttempts(),
+		Lockout:  http_mocks.NewMockLockoutRepoInterface(ctrl),
 		Accrual:  acc,
 		Withdraw: withdraw}
-	services := service.NewService(&rep, log)
-	h := NewHandler(services, log)
+	services := service.NewService(&rep, testConfig(), log)
+	tokenAuth, _ := keyring.Ephemeral()
+	h := NewHandler(services, tokenAuth, log)
 	r := h.CreateRouter()
 
 	type want struct {
@@ -724,7 +853,7 @@ func TestGetWithdraws(t *testing.T) {
 				withdraws: []model.WithdrawOrder{
 					{UserID: 1,
 						Order:       parceUint("2377225624"),
-						Sum:         500.00,
+						Sum:         500 * model.Point,
 						ProcessedAt: time.Date(2024, 11, 9, 16, 9, 57, 0, time.Local),
 					},
 				},
@@ -762,7 +891,7 @@ func TestGetWithdraws(t *testing.T) {
 			req := httptest.NewRequest(http.MethodGet, "/api/user/withdrawals", nil)
 
 			if tt.request.isAuth {
-				token, _ := services.Auth.GenerateToken(&model.User{ID: 1, Login: "user", Password: "1"}, h.TokenAuth)
+				token, _ := services.Token.GenerateToken(&model.User{ID: 1, Login: "user", Password: "1"}, testSessionID, h.TokenAuth)
 				req.Header.Set("Authorization", "Bearer "+token)
 			}
 
@@ -789,3 +918,2166 @@ func TestGetWithdraws(t *testing.T) {
 		})
 	}
 }
+
+func TestTokens(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	log, _ := logger.InitLogger()
+	auth := http_mocks.NewMockAuthRepoInterface(ctrl)
+	acc := http_mocks.NewMockAccrualOrderInterface(ctrl)
+	withdraw := http_mocks.NewMockWithdrawOrderRepoInterface(ctrl)
+	tokens := http_mocks.NewMockTokenRepoInterface(ctrl)
+	var rep = storage.Repository{Auth: auth,
+		Token:    tokens,
+		Attempts: memory.NewLoginAttempts(),
+		Lockout:  http_mocks.NewMockLockoutRepoInterface(ctrl),
+		Accrual:  acc,
+		Withdraw: withdraw}
+	services := service.NewService(&rep, testConfig(), log)
+	tokenAuth, _ := keyring.Ephemeral()
+	h := NewHandler(services, tokenAuth, log)
+	r := h.CreateRouter()
+
+	user := &model.User{ID: 1}
+	valid, _ := services.Token.GenerateToken(user, testSessionID, h.TokenAuth)
+	revoked, _ := services.Token.GenerateToken(user, "revoked-session", h.TokenAuth)
+	_, expired, _ := h.TokenAuth.Encode(map[string]interface{}{"user_id": 1, "sid": testSessionID, "exp": time.Now().Add(-time.Minute).Unix()})
+	_, endless, _ := h.TokenAuth.Encode(map[string]interface{}{"user_id": 1, "sid": testSessionID})
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		token      string
+		body       string
+		prepare    func()
+		statusCode int
+	}{
+		{
+			name:   "Revoked session",
+			method: http.MethodPost, target: "/api/user/logout", token: revoked,
+			prepare: func() {
+				tokens.EXPECT().IsSessionRevoked(gomock.Any(), "revoked-session").Return(true, nil)
+			},
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:   "Expired token",
+			method: http.MethodPost, target: "/api/user/logout", token: expired,
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:   "Token without exp",
+			method: http.MethodPost, target: "/api/user/logout", token: endless,
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:   "Logout",
+			method: http.MethodPost, target: "/api/user/logout", token: valid,
+			prepare: func() {
+				tokens.EXPECT().IsSessionRevoked(gomock.Any(), testSessionID).Return(false, nil)
+				tokens.EXPECT().RevokeSession(gomock.Any(), testSessionID).Return(nil)
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:   "Refresh",
+			method: http.MethodPost, target: "/api/user/token/refresh", body: `{"refresh_token":"abc"}`,
+			prepare: func() {
+				tokens.EXPECT().RotateRefreshToken(gomock.Any(), "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", gomock.Any(), gomock.Any()).
+					Return(&model.Session{ID: testSessionID, UserID: 1}, nil)
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:   "Refresh token reuse",
+			method: http.MethodPost, target: "/api/user/token/refresh", body: `{"refresh_token":"abc"}`,
+			prepare: func() {
+				tokens.EXPECT().RotateRefreshToken(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(nil, errs.RefreshTokenReusedError{SessionID: testSessionID})
+			},
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:   "Refresh without token",
+			method: http.MethodPost, target: "/api/user/token/refresh", body: `{}`,
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			if tt.prepare != nil {
+				tt.prepare()
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+			if tt.target == "/api/user/token/refresh" && tt.statusCode == http.StatusOK {
+				assert.NotEmpty(t, resp.Header.Get("Authorization"))
+			}
+		})
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	log, _ := logger.InitLogger()
+	auth := http_mocks.NewMockAuthRepoInterface(ctrl)
+	lockouts := http_mocks.NewMockLockoutRepoInterface(ctrl)
+	var rep = storage.Repository{Auth: auth,
+		Token:    http_mocks.NewMockTokenRepoInterface(ctrl),
+		Attempts: memory.NewLoginAttempts(),
+		Lockout:  lockouts,
+		Accrual:  http_mocks.NewMockAccrualOrderInterface(ctrl),
+		Withdraw: http_mocks.NewMockWithdrawOrderRepoInterface(ctrl)}
+	conf := testConfig()
+	conf.LoginMaxFailures = 3
+	services := service.NewService(&rep, conf, log)
+	tokenAuth, _ := keyring.Ephemeral()
+	h := NewHandler(services, tokenAuth, log)
+	r := h.CreateRouter()
+
+	auth.EXPECT().GetUserByLogin(gomock.Any(), "user").
+		Return(&model.User{ID: 1, Login: "user", Password: bcryptHash("1")}, nil).Times(3)
+	lockouts.EXPECT().RecordLockout(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, lockout *model.Lockout) error {
+			assert.Equal(t, "user", lockout.Login)
+			assert.Equal(t, 3, lockout.Failures)
+			return nil
+		}).Times(1)
+
+	login := func() *http.Response {
+		req := httptest.NewRequest(http.MethodPost, "/api/user/login", strings.NewReader(`{"login":"user","password":"wrong"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	for i := 0; i < 3; i++ {
+		resp := login()
+		resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	}
+
+	resp := login()
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "60", resp.Header.Get("Retry-After"))
+}
+
+func TestRegisterPolicy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	log, _ := logger.InitLogger()
+	auth := http_mocks.NewMockAuthRepoInterface(ctrl)
+	tokens := http_mocks.NewMockTokenRepoInterface(ctrl)
+	tokens.EXPECT().CreateSession(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	var rep = storage.Repository{Auth: auth,
+		Token:    tokens,
+		Attempts: memory.NewLoginAttempts(),
+		Lockout:  http_mocks.NewMockLockoutRepoInterface(ctrl),
+		Accrual:  http_mocks.NewMockAccrualOrderInterface(ctrl),
+		Withdraw: http_mocks.NewMockWithdrawOrderRepoInterface(ctrl)}
+	conf := testConfig()
+	conf.PasswordMinLength = 8
+	conf.PasswordMaxLength = 72
+	conf.PasswordRequireDigit = true
+	conf.LoginPattern = `^[a-z0-9._@+-]+$`
+	conf.LoginCaseFold = true
+	services := service.NewService(&rep, conf, log)
+	tokenAuth, _ := keyring.Ephemeral()
+	h := NewHandler(services, tokenAuth, log)
+	r := h.CreateRouter()
+
+	tests := []struct {
+		name       string
+		body       string
+		login      string
+		statusCode int
+		violations []string
+	}{
+		{
+			name:       "Every violated rule is reported",
+			body:       `{"login":"bad login","password":"short"}`,
+			statusCode: http.StatusBadRequest,
+			violations: []string{"login/charset", "password/min_length", "password/digit"},
+		},
+		{
+			name:       "Empty credentials are violations",
+			body:       `{"login":"  ","password":""}`,
+			statusCode: http.StatusBadRequest,
+			violations: []string{"login/required", "password/required", "password/digit"},
+		},
+		{
+			name:       "Login is trimmed and case-folded",
+			body:       `{"login":"  User.Name ","password":"password1"}`,
+			login:      "user.name",
+			statusCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/user/register", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			if tt.login != "" {
+				auth.EXPECT().CreateUser(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, user *model.User) (int, error) {
+						assert.Equal(t, tt.login, user.Login)
+						return 1, nil
+					})
+			}
+			r.ServeHTTP(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+
+			if tt.violations != nil {
+				var body errs.ValidationError
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+				var got []string
+				for _, v := range body.Violations {
+					got = append(got, v.Field+"/"+v.Rule)
+				}
+				assert.Equal(t, tt.violations, got)
+			}
+		})
+	}
+}
+
+func TestAccount(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	log, _ := logger.InitLogger()
+	auth := http_mocks.NewMockAuthRepoInterface(ctrl)
+	tokens := http_mocks.NewMockTokenRepoInterface(ctrl)
+	var rep = storage.Repository{Auth: auth,
+		Token:    tokens,
+		Attempts: memory.NewLoginAttempts(),
+		Lockout:  http_mocks.NewMockLockoutRepoInterface(ctrl),
+		Accrual:  http_mocks.NewMockAccrualOrderInterface(ctrl),
+		Withdraw: http_mocks.NewMockWithdrawOrderRepoInterface(ctrl)}
+	conf := testConfig()
+	conf.PasswordMinLength = 8
+	services := service.NewService(&rep, conf, log)
+	tokenAuth, _ := keyring.Ephemeral()
+	h := NewHandler(services, tokenAuth, log)
+	r := h.CreateRouter()
+
+	token, _ := services.Token.GenerateToken(&model.User{ID: 1}, testSessionID, h.TokenAuth)
+	tokens.EXPECT().IsSessionRevoked(gomock.Any(), testSessionID).Return(false, nil).AnyTimes()
+	tokens.EXPECT().CreateSession(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	stored := &model.User{ID: 1, Login: "user", Password: bcryptHash("current")}
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		prepare    func()
+		statusCode int
+	}{
+		{
+			name:   "Change password",
+			method: http.MethodPost, target: "/api/user/password", body: `{"current_password":"current","new_password":"newpassword"}`,
+			prepare: func() {
+				auth.EXPECT().GetUserByID(gomock.Any(), 1).Return(stored, nil)
+				auth.EXPECT().ChangePassword(gomock.Any(), 1, gomock.Any()).
+					DoAndReturn(func(_ context.Context, _ int, hash string) error {
+						ok, err := hasher.MustNew(hasher.Bcrypt).Verify("newpassword", hash)
+						assert.NoError(t, err)
+						assert.True(t, ok)
+						return nil
+					})
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:   "Change password with wrong current password",
+			method: http.MethodPost, target: "/api/user/password", body: `{"current_password":"wrong","new_password":"newpassword"}`,
+			prepare: func() {
+				auth.EXPECT().GetUserByID(gomock.Any(), 1).Return(stored, nil)
+			},
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:   "Change password violates policy",
+			method: http.MethodPost, target: "/api/user/password", body: `{"current_password":"current","new_password":"short"}`,
+			prepare: func() {
+				auth.EXPECT().GetUserByID(gomock.Any(), 1).Return(stored, nil)
+			},
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:   "Change password without new password",
+			method: http.MethodPost, target: "/api/user/password", body: `{"current_password":"current"}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:   "Delete user",
+			method: http.MethodDelete, target: "/api/user",
+			prepare: func() {
+				auth.EXPECT().DeleteUser(gomock.Any(), 1, false).Return(nil)
+			},
+			statusCode: http.StatusNoContent,
+		},
+		{
+			name:   "Delete user with positive balance",
+			method: http.MethodDelete, target: "/api/user",
+			prepare: func() {
+				auth.EXPECT().DeleteUser(gomock.Any(), 1, false).Return(errs.PositiveBalanceError{Balance: "10"})
+			},
+			statusCode: http.StatusConflict,
+		},
+		{
+			name:   "Force delete user",
+			method: http.MethodDelete, target: "/api/user?force=true",
+			prepare: func() {
+				auth.EXPECT().DeleteUser(gomock.Any(), 1, true).Return(nil)
+			},
+			statusCode: http.StatusNoContent,
+		},
+		{
+			name:   "Delete user with bad force flag",
+			method: http.MethodDelete, target: "/api/user?force=maybe",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			if tt.prepare != nil {
+				tt.prepare()
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+		})
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	log, _ := logger.InitLogger()
+	admin := http_mocks.NewMockAdminRepoInterface(ctrl)
+	acc := http_mocks.NewMockAccrualOrderInterface(ctrl)
+	lockouts := http_mocks.NewMockLockoutRepoInterface(ctrl)
+	tokens := http_mocks.NewMockTokenRepoInterface(ctrl)
+	ledger := http_mocks.NewMockLedgerRepoInterface(ctrl)
+	var rep = storage.Repository{Auth: http_mocks.NewMockAuthRepoInterface(ctrl),
+		Token:    tokens,
+		Attempts: memory.NewLoginAttempts(),
+		Lockout:  lockouts,
+		Admin:    admin,
+		Ledger:   ledger,
+		Accrual:  acc,
+		Withdraw: http_mocks.NewMockWithdrawOrderRepoInterface(ctrl)}
+	services := service.NewService(&rep, testConfig(), log)
+	tokenAuth, _ := keyring.Ephemeral()
+	h := NewHandler(services, tokenAuth, log)
+	r := h.CreateRouter()
+
+	tokens.EXPECT().IsSessionRevoked(gomock.Any(), testSessionID).Return(false, nil).AnyTimes()
+	adminToken, _ := services.Token.GenerateToken(&model.User{ID: 1, Role: model.RoleAdmin}, testSessionID, h.TokenAuth)
+	userToken, _ := services.Token.GenerateToken(&model.User{ID: 2}, testSessionID, h.TokenAuth)
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		token      string
+		body       string
+		prepare    func()
+		statusCode int
+		want       string
+	}{
+		{
+			name:   "Regular user is forbidden",
+			method: http.MethodGet, target: "/api/admin/users/2", token: userToken,
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:   "Get user",
+			method: http.MethodGet, target: "/api/admin/users/2", token: adminToken,
+			prepare: func() {
+				admin.EXPECT().GetUserInfo(gomock.Any(), 2).
+					Return(&model.UserInfo{ID: 2, Login: "user", Role: model.RoleUser, Current: 500 * model.Point, Withdrawn: 42 * model.Point}, nil)
+			},
+			statusCode: http.StatusOK,
+			want:       `{"id":2,"login":"user","role":"user","current":500,"withdrawn":42}`,
+		},
+		{
+			name:   "Find user by login",
+			method: http.MethodGet, target: "/api/admin/users?login=user", token: adminToken,
+			prepare: func() {
+				admin.EXPECT().GetUserInfoByLogin(gomock.Any(), "user").Return(nil, errs.UserNotFoundError{})
+			},
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:   "Get user orders",
+			method: http.MethodGet, target: "/api/admin/users/2/orders", token: adminToken,
+			prepare: func() {
+				acc.EXPECT().GetUploadedOrders(gomock.Any(), 2).Return(nil, nil)
+			},
+			statusCode: http.StatusNoContent,
+		},
+		{
+			name:   "Adjust balance",
+			method: http.MethodPost, target: "/api/admin/users/2/balance/adjustments", token: adminToken,
+			body: `{"amount":-10.5,"reason":"duplicate accrual"}`,
+			prepare: func() {
+				admin.EXPECT().AdjustBalance(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, adjustment *model.BalanceAdjustment) error {
+						assert.Equal(t, 2, adjustment.UserID)
+						assert.Equal(t, 1, adjustment.AdminID)
+						assert.Equal(t, model.MustParseMoney("-10.5"), adjustment.Amount)
+						return nil
+					})
+			},
+			statusCode: http.StatusCreated,
+		},
+		{
+			name:   "Adjust balance without reason",
+			method: http.MethodPost, target: "/api/admin/users/2/balance/adjustments", token: adminToken,
+			body:       `{"amount":10,"reason":"  "}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:   "Adjust balance below zero",
+			method: http.MethodPost, target: "/api/admin/users/2/balance/adjustments", token: adminToken,
+			body: `{"amount":-1000,"reason":"fraud"}`,
+			prepare: func() {
+				admin.EXPECT().AdjustBalance(gomock.Any(), gomock.Any()).Return(errs.ShowMeTheMoney{})
+			},
+			statusCode: http.StatusConflict,
+		},
+		{
+			name:   "Requeue order",
+			method: http.MethodPost, target: "/api/admin/orders/12345678903/requeue", token: adminToken,
+			prepare: func() {
+				admin.EXPECT().RequeueOrder(gomock.Any(), uint64(12345678903)).Return(nil)
+			},
+			statusCode: http.StatusAccepted,
+		},
+		{
+			name:   "Requeue processed order",
+			method: http.MethodPost, target: "/api/admin/orders/12345678903/requeue", token: adminToken,
+			prepare: func() {
+				admin.EXPECT().RequeueOrder(gomock.Any(), uint64(12345678903)).Return(errs.OrderAlreadyProcessedError{})
+			},
+			statusCode: http.StatusConflict,
+		},
+		{
+			name:   "Reconciliation",
+			method: http.MethodGet, target: "/api/admin/ledger/reconciliation", token: adminToken,
+			prepare: func() {
+				ledger.EXPECT().Reconcile(gomock.Any()).
+					Return([]model.BalanceDrift{{UserID: 2, LedgerCurrent: 500 * model.Point, LegacyCurrent: 0, LedgerWithdrawn: 42 * model.Point, LegacyWithdrawn: 42 * model.Point, LotsRemaining: 500 * model.Point}}, nil)
+			},
+			statusCode: http.StatusOK,
+			want:       `[{"user_id":2,"ledger_current":500,"legacy_current":0,"ledger_withdrawn":42,"legacy_withdrawn":42,"lots_remaining":500}]`,
+		},
+		{
+			name:   "Reconciliation without drift",
+			method: http.MethodGet, target: "/api/admin/ledger/reconciliation", token: adminToken,
+			prepare: func() {
+				ledger.EXPECT().Reconcile(gomock.Any()).Return(nil, nil)
+			},
+			statusCode: http.StatusOK,
+			want:       `[]`,
+		},
+		{
+			name:   "Unlock login",
+			method: http.MethodDelete, target: "/api/admin/lockouts/User", token: adminToken,
+			prepare: func() {
+				lockouts.EXPECT().MarkUnlocked(gomock.Any(), "User", 1).Return(nil)
+			},
+			statusCode: http.StatusNoContent,
+		},
+		{
+			name:   "Unlock IP",
+			method: http.MethodDelete, target: "/api/admin/lockouts/ip/10.0.0.1", token: adminToken,
+			prepare: func() {
+				lockouts.EXPECT().MarkIPUnlocked(gomock.Any(), "10.0.0.1", 1).Return(nil)
+			},
+			statusCode: http.StatusNoContent,
+		},
+		{
+			name:   "Unlock malformed IP",
+			method: http.MethodDelete, target: "/api/admin/lockouts/ip/not-an-ip", token: adminToken,
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			if tt.prepare != nil {
+				tt.prepare()
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+			if tt.want != "" {
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				assert.JSONEq(t, tt.want, string(body))
+			}
+		})
+	}
+}
+
+func TestGetBalance(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	log, _ := logger.InitLogger()
+	ledger := http_mocks.NewMockLedgerRepoInterface(ctrl)
+	tokens := http_mocks.NewMockTokenRepoInterface(ctrl)
+	var rep = storage.Repository{Auth: http_mocks.NewMockAuthRepoInterface(ctrl),
+		Token:    tokens,
+		Attempts: memory.NewLoginAttempts(),
+		Lockout:  http_mocks.NewMockLockoutRepoInterface(ctrl),
+		Ledger:   ledger,
+		Accrual:  http_mocks.NewMockAccrualOrderInterface(ctrl),
+		Withdraw: http_mocks.NewMockWithdrawOrderRepoInterface(ctrl)}
+	services := service.NewService(&rep, testConfig(), log)
+	tokenAuth, _ := keyring.Ephemeral()
+	h := NewHandler(services, tokenAuth, log)
+	r := h.CreateRouter()
+
+	tokens.EXPECT().IsSessionRevoked(gomock.Any(), testSessionID).Return(false, nil).AnyTimes()
+	token, _ := services.Token.GenerateToken(&model.User{ID: 1}, testSessionID, h.TokenAuth)
+
+	tests := []struct {
+		name       string
+		prepare    func()
+		statusCode int
+		want       string
+	}{
+		{
+			name: "Balance from ledger",
+			prepare: func() {
+				ledger.EXPECT().GetBalance(gomock.Any(), 1).Return(&model.Balance{UserID: 1, Current: model.MustParseMoney("500.5"), Withdrawn: 42 * model.Point}, nil)
+			},
+			statusCode: http.StatusOK,
+			want:       `{"current":500.5,"withdrawn":42}`,
+		},
+		{
+			name: "Ledger error",
+			prepare: func() {
+				ledger.EXPECT().GetBalance(gomock.Any(), 1).Return(nil, fmt.Errorf("connection refused"))
+			},
+			statusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/user/balance", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			tt.prepare()
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+			if tt.want != "" {
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				assert.JSONEq(t, tt.want, string(body))
+			}
+		})
+	}
+}
+
+func TestWithdrawIdempotency(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	log, _ := logger.InitLogger()
+	withdraw := http_mocks.NewMockWithdrawOrderRepoInterface(ctrl)
+	keys := http_mocks.NewMockIdempotencyRepoInterface(ctrl)
+	tokens := http_mocks.NewMockTokenRepoInterface(ctrl)
+	var rep = storage.Repository{Auth: http_mocks.NewMockAuthRepoInterface(ctrl),
+		Token:       tokens,
+		Attempts:    memory.NewLoginAttempts(),
+		Lockout:     http_mocks.NewMockLockoutRepoInterface(ctrl),
+		Idempotency: keys,
+		Accrual:     http_mocks.NewMockAccrualOrderInterface(ctrl),
+		Withdraw:    withdraw}
+	services := service.NewService(&rep, testConfig(), log)
+	tokenAuth, _ := keyring.Ephemeral()
+	h := NewHandler(services, tokenAuth, log)
+	r := h.CreateRouter()
+
+	tokens.EXPECT().IsSessionRevoked(gomock.Any(), testSessionID).Return(false, nil).AnyTimes()
+	keys.EXPECT().DeleteExpired(gomock.Any()).Return(int64(0), nil).AnyTimes()
+	token, _ := services.Token.GenerateToken(&model.User{ID: 1}, testSessionID, h.TokenAuth)
+
+	const body = `{"order":"12345678903","sum":100}`
+	var hash string
+
+	tests := []struct {
+		name       string
+		key        string
+		body       string
+		prepare    func()
+		statusCode int
+		replayed   bool
+	}{
+		{
+			name: "Without key",
+			body: body,
+			prepare: func() {
+				withdraw.EXPECT().DeductPoints(gomock.Any(), gomock.Any()).Return(nil)
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			name: "First request",
+			key:  "key-1", body: body,
+			prepare: func() {
+				keys.EXPECT().Reserve(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, record *model.IdempotencyRecord) (*model.IdempotencyRecord, error) {
+						assert.Equal(t, 1, record.UserID)
+						assert.Equal(t, "key-1", record.Key)
+						hash = record.RequestHash
+						return nil, nil
+					})
+				withdraw.EXPECT().DeductPoints(gomock.Any(), gomock.Any()).Return(errs.ShowMeTheMoney{})
+				keys.EXPECT().Complete(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, record *model.IdempotencyRecord) error {
+						assert.Equal(t, http.StatusPaymentRequired, record.StatusCode)
+						assert.Contains(t, string(record.Body), errs.ShowMeTheMoney{}.Error())
+						return nil
+					})
+			},
+			statusCode: http.StatusPaymentRequired,
+		},
+		{
+			name: "Replay",
+			key:  "key-1", body: body,
+			prepare: func() {
+				keys.EXPECT().Reserve(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, record *model.IdempotencyRecord) (*model.IdempotencyRecord, error) {
+						return &model.IdempotencyRecord{RequestHash: hash, StatusCode: http.StatusPaymentRequired}, nil
+					})
+			},
+			statusCode: http.StatusPaymentRequired,
+			replayed:   true,
+		},
+		{
+			name: "Same key with a different body",
+			key:  "key-1", body: `{"order":"12345678903","sum":200}`,
+			prepare: func() {
+				keys.EXPECT().Reserve(gomock.Any(), gomock.Any()).
+					Return(&model.IdempotencyRecord{RequestHash: hash, StatusCode: http.StatusPaymentRequired}, nil)
+			},
+			statusCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "Request in progress",
+			key:  "key-2", body: body,
+			prepare: func() {
+				keys.EXPECT().Reserve(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, record *model.IdempotencyRecord) (*model.IdempotencyRecord, error) {
+						return &model.IdempotencyRecord{RequestHash: record.RequestHash}, nil
+					})
+			},
+			statusCode: http.StatusConflict,
+		},
+		{
+			name: "Server error releases the key",
+			key:  "key-3", body: body,
+			prepare: func() {
+				keys.EXPECT().Reserve(gomock.Any(), gomock.Any()).Return(nil, nil)
+				withdraw.EXPECT().DeductPoints(gomock.Any(), gomock.Any()).Return(fmt.Errorf("connection refused"))
+				keys.EXPECT().Release(gomock.Any(), 1, "key-3").Return(nil)
+			},
+			statusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+token)
+			if tt.key != "" {
+				req.Header.Set("Idempotency-Key", tt.key)
+			}
+			tt.prepare()
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+			if tt.replayed {
+				assert.Equal(t, "true", resp.Header.Get("Idempotent-Replayed"))
+			}
+		})
+	}
+}
+
+func TestCancelWithdrawal(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	log, _ := logger.InitLogger()
+	withdraw := http_mocks.NewMockWithdrawOrderRepoInterface(ctrl)
+	tokens := http_mocks.NewMockTokenRepoInterface(ctrl)
+	var rep = storage.Repository{Auth: http_mocks.NewMockAuthRepoInterface(ctrl),
+		Token:    tokens,
+		Attempts: memory.NewLoginAttempts(),
+		Lockout:  http_mocks.NewMockLockoutRepoInterface(ctrl),
+		Accrual:  http_mocks.NewMockAccrualOrderInterface(ctrl),
+		Withdraw: withdraw}
+	services := service.NewService(&rep, testConfig(), log)
+	tokenAuth, _ := keyring.Ephemeral()
+	h := NewHandler(services, tokenAuth, log)
+	r := h.CreateRouter()
+
+	tokens.EXPECT().IsSessionRevoked(gomock.Any(), testSessionID).Return(false, nil).AnyTimes()
+	userToken, _ := services.Token.GenerateToken(&model.User{ID: 1}, testSessionID, h.TokenAuth)
+	adminToken, _ := services.Token.GenerateToken(&model.User{ID: 7, Role: model.RoleAdmin}, testSessionID, h.TokenAuth)
+	refundedAt := time.Date(2024, 11, 10, 16, 9, 57, 0, time.Local)
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		token      string
+		body       string
+		prepare    func()
+		statusCode int
+		want       string
+	}{
+		{
+			name:   "Cancel withdrawal",
+			method: http.MethodPost, target: "/api/user/withdrawals/2377225624/cancel", token: userToken,
+			prepare: func() {
+				withdraw.EXPECT().RefundWithdrawal(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, refund *model.WithdrawalRefund) error {
+						assert.Equal(t, uint64(2377225624), refund.Order)
+						assert.Equal(t, 1, refund.UserID)
+						assert.Equal(t, 1, refund.RefundedBy)
+						assert.WithinDuration(t, time.Now().Add(-24*time.Hour), refund.NotBefore, time.Minute)
+						return nil
+					})
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:   "Cancel unknown withdrawal",
+			method: http.MethodPost, target: "/api/user/withdrawals/2377225624/cancel", token: userToken,
+			prepare: func() {
+				withdraw.EXPECT().RefundWithdrawal(gomock.Any(), gomock.Any()).Return(errs.WithdrawalNotFoundError{})
+			},
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:   "Cancel refunded withdrawal",
+			method: http.MethodPost, target: "/api/user/withdrawals/2377225624/cancel", token: userToken,
+			prepare: func() {
+				withdraw.EXPECT().RefundWithdrawal(gomock.Any(), gomock.Any()).Return(errs.WithdrawalAlreadyRefundedError{})
+			},
+			statusCode: http.StatusConflict,
+		},
+		{
+			name:   "Cancel after the window",
+			method: http.MethodPost, target: "/api/user/withdrawals/2377225624/cancel", token: userToken,
+			prepare: func() {
+				withdraw.EXPECT().RefundWithdrawal(gomock.Any(), gomock.Any()).Return(errs.CancellationWindowExpiredError{})
+			},
+			statusCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "Cancel with bad order number",
+			method: http.MethodPost, target: "/api/user/withdrawals/abc/cancel", token: userToken,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:   "Admin refund",
+			method: http.MethodPost, target: "/api/admin/withdrawals/2377225624/refund", token: adminToken,
+			body: `{"reason":"shop order cancelled"}`,
+			prepare: func() {
+				withdraw.EXPECT().RefundWithdrawal(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, refund *model.WithdrawalRefund) error {
+						assert.Equal(t, 0, refund.UserID)
+						assert.Equal(t, 7, refund.RefundedBy)
+						assert.Equal(t, "shop order cancelled", refund.Reason)
+						assert.True(t, refund.NotBefore.IsZero())
+						return nil
+					})
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:   "Admin refund without reason",
+			method: http.MethodPost, target: "/api/admin/withdrawals/2377225624/refund", token: adminToken,
+			body:       `{}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:   "Refund by regular user",
+			method: http.MethodPost, target: "/api/admin/withdrawals/2377225624/refund", token: userToken,
+			body:       `{"reason":"please"}`,
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:   "Refunded withdrawal in the list",
+			method: http.MethodGet, target: "/api/user/withdrawals", token: userToken,
+			prepare: func() {
+				withdraw.EXPECT().GetWithdrawalOfPoints(gomock.Any(), 1).Return([]model.WithdrawOrder{{
+					Order:       2377225624,
+					Sum:         500 * model.Point,
+					Status:      model.WithdrawalRefunded,
+					ProcessedAt: time.Date(2024, 11, 9, 16, 9, 57, 0, time.Local),
+					RefundedAt:  &refundedAt,
+				}}, nil)
+			},
+			statusCode: http.StatusOK,
+			want: `[{"order":"2377225624","sum":500,"status":"REFUNDED",
+				"processed_at":"2024-11-09T16:09:57+03:00","refunded_at":"2024-11-10T16:09:57+03:00"}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			if tt.prepare != nil {
+				tt.prepare()
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+			if tt.want != "" {
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				assert.JSONEq(t, tt.want, string(body))
+			}
+		})
+	}
+}
+
+func TestWithdrawalHold(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	log, _ := logger.InitLogger()
+	withdraw := http_mocks.NewMockWithdrawOrderRepoInterface(ctrl)
+	tokens := http_mocks.NewMockTokenRepoInterface(ctrl)
+	var rep = storage.Repository{Auth: http_mocks.NewMockAuthRepoInterface(ctrl),
+		Token:    tokens,
+		Attempts: memory.NewLoginAttempts(),
+		Lockout:  http_mocks.NewMockLockoutRepoInterface(ctrl),
+		Accrual:  http_mocks.NewMockAccrualOrderInterface(ctrl),
+		Withdraw: withdraw}
+	conf := testConfig()
+	conf.WithdrawalConfirmation = true
+	conf.WithdrawalHoldTimeout = 30 * time.Minute
+	services := service.NewService(&rep, conf, log)
+	tokenAuth, _ := keyring.Ephemeral()
+	h := NewHandler(services, tokenAuth, log)
+	h.ShopCallbackToken = "shop-secret"
+	r := h.CreateRouter()
+
+	tokens.EXPECT().IsSessionRevoked(gomock.Any(), testSessionID).Return(false, nil).AnyTimes()
+	userToken, _ := services.Token.GenerateToken(&model.User{ID: 1}, testSessionID, h.TokenAuth)
+
+	tests := []struct {
+		name       string
+		target     string
+		token      string
+		callback   string
+		body       string
+		prepare    func()
+		statusCode int
+	}{
+		{
+			name:   "Withdraw is put on hold",
+			target: "/api/user/balance/withdraw", token: userToken,
+			body: `{"order":"12345678903","sum":100}`,
+			prepare: func() {
+				withdraw.EXPECT().DeductPoints(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, order *model.WithdrawOrder) error {
+						assert.Equal(t, model.WithdrawalPending, order.Status)
+						require.NotNil(t, order.HoldExpiresAt)
+						assert.WithinDuration(t, time.Now().Add(30*time.Minute), *order.HoldExpiresAt, time.Minute)
+						return nil
+					})
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Confirm without callback token",
+			target:     "/api/shop/withdrawals/12345678903/confirm",
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "Confirm with wrong callback token",
+			target:     "/api/shop/withdrawals/12345678903/confirm",
+			callback:   "guess",
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "Shop confirms withdrawal",
+			target:   "/api/shop/withdrawals/12345678903/confirm",
+			callback: "shop-secret",
+			prepare: func() {
+				withdraw.EXPECT().ResolveWithdrawal(gomock.Any(), uint64(12345678903), model.WithdrawalConfirmed, "").Return(nil)
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:     "Confirm already rejected withdrawal",
+			target:   "/api/shop/withdrawals/12345678903/confirm",
+			callback: "shop-secret",
+			prepare: func() {
+				withdraw.EXPECT().ResolveWithdrawal(gomock.Any(), uint64(12345678903), model.WithdrawalConfirmed, "").
+					Return(errs.WithdrawalStatusError{Status: model.WithdrawalRejected})
+			},
+			statusCode: http.StatusConflict,
+		},
+		{
+			name:     "Shop rejects withdrawal",
+			target:   "/api/shop/withdrawals/12345678903/reject",
+			callback: "shop-secret",
+			body:     `{"reason":" out of stock "}`,
+			prepare: func() {
+				withdraw.EXPECT().ResolveWithdrawal(gomock.Any(), uint64(12345678903), model.WithdrawalRejected, "out of stock").Return(nil)
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:     "Reject unknown withdrawal",
+			target:   "/api/shop/withdrawals/12345678903/reject",
+			callback: "shop-secret",
+			prepare: func() {
+				withdraw.EXPECT().ResolveWithdrawal(gomock.Any(), uint64(12345678903), model.WithdrawalRejected, "").
+					Return(errs.WithdrawalNotFoundError{})
+			},
+			statusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			if tt.callback != "" {
+				req.Header.Set("X-Callback-Token", tt.callback)
+			}
+			if tt.prepare != nil {
+				tt.prepare()
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+		})
+	}
+}
+
+func TestExpiringPoints(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	log, _ := logger.InitLogger()
+	ledger := http_mocks.NewMockLedgerRepoInterface(ctrl)
+	tokens := http_mocks.NewMockTokenRepoInterface(ctrl)
+	var rep = storage.Repository{Auth: http_mocks.NewMockAuthRepoInterface(ctrl),
+		Token:    tokens,
+		Attempts: memory.NewLoginAttempts(),
+		Lockout:  http_mocks.NewMockLockoutRepoInterface(ctrl),
+		Ledger:   ledger,
+		Accrual:  http_mocks.NewMockAccrualOrderInterface(ctrl),
+		Withdraw: http_mocks.NewMockWithdrawOrderRepoInterface(ctrl)}
+	conf := testConfig()
+	conf.PointsLifetimeMonths = 12
+	conf.PointsExpiryNotice = 30 * 24 * time.Hour
+	services := service.NewService(&rep, conf, log)
+	tokenAuth, _ := keyring.Ephemeral()
+	h := NewHandler(services, tokenAuth, log)
+	r := h.CreateRouter()
+
+	tokens.EXPECT().IsSessionRevoked(gomock.Any(), testSessionID).Return(false, nil).AnyTimes()
+	token, _ := services.Token.GenerateToken(&model.User{ID: 1}, testSessionID, h.TokenAuth)
+
+	soon := time.Now().AddDate(-1, 0, 10).Truncate(time.Second)
+	later := time.Now().AddDate(-1, 0, 40)
+	ledger.EXPECT().GetBalance(gomock.Any(), 1).Return(&model.Balance{UserID: 1, Current: 300 * model.Point}, nil)
+	ledger.EXPECT().GetExpiringLots(gomock.Any(), 1, gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ int, earnedBefore time.Time) ([]model.PointLot, error) {
+			assert.True(t, earnedBefore.After(soon))
+			return []model.PointLot{
+				{ID: 1, UserID: 1, Remaining: 100 * model.Point, EarnedAt: soon},
+				{ID: 2, UserID: 1, Remaining: 200 * model.Point, EarnedAt: later},
+			}, nil
+		})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/balance", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var balance model.Balance
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&balance))
+	assert.Equal(t, 300*model.Point, balance.Current)
+	require.Len(t, balance.ExpiringSoon, 1)
+	assert.Equal(t, 100*model.Point, balance.ExpiringSoon[0].Amount)
+	assert.True(t, soon.AddDate(1, 0, 0).Equal(balance.ExpiringSoon[0].ExpiresAt))
+}
+
+func TestTransfer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	log, _ := logger.InitLogger()
+	transfers := http_mocks.NewMockTransferRepoInterface(ctrl)
+	tokens := http_mocks.NewMockTokenRepoInterface(ctrl)
+	var rep = storage.Repository{Auth: http_mocks.NewMockAuthRepoInterface(ctrl),
+		Token:    tokens,
+		Attempts: memory.NewLoginAttempts(),
+		Lockout:  http_mocks.NewMockLockoutRepoInterface(ctrl),
+		Accrual:  http_mocks.NewMockAccrualOrderInterface(ctrl),
+		Withdraw: http_mocks.NewMockWithdrawOrderRepoInterface(ctrl),
+		Transfer: transfers}
+	conf := testConfig()
+	conf.LoginCaseFold = true
+	conf.TransferDailyLimit = 1000 * model.Point
+	services := service.NewService(&rep, conf, log)
+	tokenAuth, _ := keyring.Ephemeral()
+	h := NewHandler(services, tokenAuth, log)
+	r := h.CreateRouter()
+
+	tokens.EXPECT().IsSessionRevoked(gomock.Any(), testSessionID).Return(false, nil).AnyTimes()
+	token, _ := services.Token.GenerateToken(&model.User{ID: 1}, testSessionID, h.TokenAuth)
+	createdAt := time.Date(2024, 11, 10, 16, 9, 57, 0, time.Local)
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		prepare    func()
+		statusCode int
+		want       string
+	}{
+		{
+			name:   "Transfer points",
+			method: http.MethodPost, target: "/api/user/balance/transfer",
+			body: `{"recipient":"Friend","sum":150.5}`,
+			prepare: func() {
+				transfers.EXPECT().CreateTransfer(gomock.Any(), gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, transfer *model.Transfer, limit model.TransferLimit) error {
+						assert.Equal(t, 1, transfer.SenderID)
+						assert.Equal(t, "friend", transfer.RecipientLogin)
+						assert.Equal(t, model.MustParseMoney("150.5"), transfer.Sum)
+						assert.Equal(t, 1000*model.Point, limit.Amount)
+						assert.WithinDuration(t, time.Now(), limit.Since, 24*time.Hour)
+						assert.Zero(t, limit.Since.Hour())
+						transfer.ID, transfer.RecipientID, transfer.CreatedAt = 5, 2, createdAt
+						transfer.Direction, transfer.Counterparty = model.TransferOutgoing, transfer.RecipientLogin
+						return nil
+					})
+			},
+			statusCode: http.StatusOK,
+			want:       `{"id":5,"direction":"outgoing","counterparty":"friend","sum":150.5,"created_at":"2024-11-10T16:09:57+03:00"}`,
+		},
+		{
+			name:   "Transfer without recipient and sum",
+			method: http.MethodPost, target: "/api/user/balance/transfer",
+			body:       `{"recipient":" ","sum":0}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:   "Transfer to unknown user",
+			method: http.MethodPost, target: "/api/user/balance/transfer",
+			body: `{"recipient":"nobody","sum":10}`,
+			prepare: func() {
+				transfers.EXPECT().CreateTransfer(gomock.Any(), gomock.Any(), gomock.Any()).Return(errs.UserNotFoundError{})
+			},
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:   "Transfer to yourself",
+			method: http.MethodPost, target: "/api/user/balance/transfer",
+			body: `{"recipient":"me","sum":10}`,
+			prepare: func() {
+				transfers.EXPECT().CreateTransfer(gomock.Any(), gomock.Any(), gomock.Any()).Return(errs.SelfTransferError{})
+			},
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:   "Transfer without points",
+			method: http.MethodPost, target: "/api/user/balance/transfer",
+			body: `{"recipient":"friend","sum":10}`,
+			prepare: func() {
+				transfers.EXPECT().CreateTransfer(gomock.Any(), gomock.Any(), gomock.Any()).Return(errs.ShowMeTheMoney{})
+			},
+			statusCode: http.StatusPaymentRequired,
+		},
+		{
+			name:   "Transfer over the daily limit",
+			method: http.MethodPost, target: "/api/user/balance/transfer",
+			body: `{"recipient":"friend","sum":10}`,
+			prepare: func() {
+				transfers.EXPECT().CreateTransfer(gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(errs.TransferLimitExceededError{Remaining: "5"})
+			},
+			statusCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "Transfer history",
+			method: http.MethodGet, target: "/api/user/transfers",
+			prepare: func() {
+				transfers.EXPECT().GetTransfers(gomock.Any(), 1).Return([]model.Transfer{
+					{ID: 6, Direction: model.TransferIncoming, Counterparty: "friend", Sum: 20 * model.Point, CreatedAt: createdAt},
+					{ID: 5, Direction: model.TransferOutgoing, Counterparty: "friend", Sum: 150 * model.Point, CreatedAt: createdAt},
+				}, nil)
+			},
+			statusCode: http.StatusOK,
+			want: `[{"id":6,"direction":"incoming","counterparty":"friend","sum":20,"created_at":"2024-11-10T16:09:57+03:00"},
+				{"id":5,"direction":"outgoing","counterparty":"friend","sum":150,"created_at":"2024-11-10T16:09:57+03:00"}]`,
+		},
+		{
+			name:   "Empty transfer history",
+			method: http.MethodGet, target: "/api/user/transfers",
+			prepare: func() {
+				transfers.EXPECT().GetTransfers(gomock.Any(), 1).Return(nil, nil)
+			},
+			statusCode: http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			if tt.prepare != nil {
+				tt.prepare()
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+			if tt.want != "" {
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				assert.JSONEq(t, tt.want, string(body))
+			}
+		})
+	}
+}
+
+func TestTransactions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	log, _ := logger.InitLogger()
+	ledger := http_mocks.NewMockLedgerRepoInterface(ctrl)
+	tokens := http_mocks.NewMockTokenRepoInterface(ctrl)
+	var rep = storage.Repository{Auth: http_mocks.NewMockAuthRepoInterface(ctrl),
+		Token:    tokens,
+		Attempts: memory.NewLoginAttempts(),
+		Lockout:  http_mocks.NewMockLockoutRepoInterface(ctrl),
+		Ledger:   ledger,
+		Accrual:  http_mocks.NewMockAccrualOrderInterface(ctrl),
+		Withdraw: http_mocks.NewMockWithdrawOrderRepoInterface(ctrl)}
+	services := service.NewService(&rep, testConfig(), log)
+	tokenAuth, _ := keyring.Ephemeral()
+	h := NewHandler(services, tokenAuth, log)
+	r := h.CreateRouter()
+
+	tokens.EXPECT().IsSessionRevoked(gomock.Any(), testSessionID).Return(false, nil).AnyTimes()
+	token, _ := services.Token.GenerateToken(&model.User{ID: 1}, testSessionID, h.TokenAuth)
+	at := time.Date(2024, 11, 10, 16, 9, 57, 0, time.Local)
+	history := []model.Transaction{
+		{ID: 9, Type: model.LedgerWithdrawal, Order: 2377225624, Amount: -100 * model.Point, Balance: 400 * model.Point, CreatedAt: at},
+		{ID: 7, Type: model.LedgerAccrual, Order: 12345678903, Amount: 500 * model.Point, Balance: 500 * model.Point, CreatedAt: at},
+		{ID: 3, Type: model.LedgerAdjustment, Amount: -10 * model.Point, Balance: 0, CreatedAt: at},
+	}
+
+	tests := []struct {
+		name       string
+		target     string
+		prepare    func()
+		statusCode int
+		want       string
+	}{
+		{
+			name:   "First page",
+			target: "/api/user/transactions?limit=2",
+			prepare: func() {
+				ledger.EXPECT().GetTransactions(gomock.Any(), model.TransactionFilter{UserID: 1, Limit: 3}).Return(history, nil)
+			},
+			statusCode: http.StatusOK,
+			want: `{"transactions":[
+				{"id":9,"type":"withdrawal","order":"2377225624","amount":-100,"balance":400,"created_at":"2024-11-10T16:09:57+03:00"},
+				{"id":7,"type":"accrual","order":"12345678903","amount":500,"balance":500,"created_at":"2024-11-10T16:09:57+03:00"}],
+				"next_cursor":"Nw"}`,
+		},
+		{
+			name:   "Last page",
+			target: "/api/user/transactions?limit=2&cursor=Nw",
+			prepare: func() {
+				ledger.EXPECT().GetTransactions(gomock.Any(), model.TransactionFilter{UserID: 1, BeforeID: 7, Limit: 3}).Return(history[2:], nil)
+			},
+			statusCode: http.StatusOK,
+			want: `{"transactions":[
+				{"id":3,"type":"adjustment","amount":-10,"balance":0,"created_at":"2024-11-10T16:09:57+03:00"}]}`,
+		},
+		{
+			name:   "Filters",
+			target: "/api/user/transactions?from=2024-11-01&to=2024-11-10&type=accrual,refund&type=transfer",
+			prepare: func() {
+				ledger.EXPECT().GetTransactions(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, filter model.TransactionFilter) ([]model.Transaction, error) {
+						assert.Equal(t, time.Date(2024, 11, 1, 0, 0, 0, 0, time.Local), filter.From)
+						assert.Equal(t, time.Date(2024, 11, 11, 0, 0, 0, 0, time.Local), filter.To)
+						assert.Equal(t, []string{"accrual", "refund", "transfer"}, filter.Types)
+						assert.Equal(t, service.DefaultTransactionsLimit+1, filter.Limit)
+						return nil, nil
+					})
+			},
+			statusCode: http.StatusOK,
+			want:       `{"transactions":[]}`,
+		},
+		{
+			name:       "Unknown type",
+			target:     "/api/user/transactions?type=bonus",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Bad cursor",
+			target:     "/api/user/transactions?cursor=%21%21",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Limit too large",
+			target:     "/api/user/transactions?limit=1000",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Bad date",
+			target:     "/api/user/transactions?from=yesterday",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			if tt.prepare != nil {
+				tt.prepare()
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+			if tt.want != "" {
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				assert.JSONEq(t, tt.want, string(body))
+			}
+		})
+	}
+}
+
+func TestGetOrdersPage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	log, _ := logger.InitLogger()
+	acc := http_mocks.NewMockAccrualOrderInterface(ctrl)
+	tokens := http_mocks.NewMockTokenRepoInterface(ctrl)
+	var rep = storage.Repository{Auth: http_mocks.NewMockAuthRepoInterface(ctrl),
+		Token:    tokens,
+		Attempts: memory.NewLoginAttempts(),
+		Lockout:  http_mocks.NewMockLockoutRepoInterface(ctrl),
+		Accrual:  acc,
+		Withdraw: http_mocks.NewMockWithdrawOrderRepoInterface(ctrl)}
+	services := service.NewService(&rep, testConfig(), log)
+	tokenAuth, _ := keyring.Ephemeral()
+	h := NewHandler(services, tokenAuth, log)
+	r := h.CreateRouter()
+
+	tokens.EXPECT().IsSessionRevoked(gomock.Any(), testSessionID).Return(false, nil).AnyTimes()
+	token, _ := services.Token.GenerateToken(&model.User{ID: 1}, testSessionID, h.TokenAuth)
+	newer := time.Date(2024, 11, 10, 16, 9, 57, 0, time.Local)
+	older := newer.Add(-time.Hour)
+	orders := []model.AccrualOrder{
+		{Number: 12345678903, Status: model.StatusPROCESSED, Accrual: 500 * model.Point, UploadedAt: newer},
+		{Number: 2377225624, Status: model.StatusPROCESSING, UploadedAt: older},
+		{Number: 49927398716, Status: model.StatusNEW, UploadedAt: older},
+	}
+	next := cursor.Encode(model.OrderCursor{UploadedAt: older, Number: 2377225624})
+
+	tests := []struct {
+		name       string
+		target     string
+		prepare    func()
+		statusCode int
+		want       string
+		link       string
+	}{
+		{
+			name:   "First page",
+			target: "/api/user/orders?limit=2&status=NEW,PROCESSING&status=PROCESSED",
+			prepare: func() {
+				acc.EXPECT().GetOrders(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, filter model.OrderFilter) ([]model.AccrualOrder, error) {
+						assert.Equal(t, 1, filter.UserID)
+						assert.Equal(t, 3, filter.Limit)
+						assert.Nil(t, filter.After)
+						assert.False(t, filter.Descending)
+						assert.Equal(t, []model.Status{model.StatusNEW, model.StatusPROCESSING, model.StatusPROCESSED}, filter.Statuses)
+						return orders, nil
+					})
+			},
+			statusCode: http.StatusOK,
+			want: `[{"user_id":0,"number":"12345678903","status":"PROCESSED","accrual":500,"uploaded_at":"2024-11-10T16:09:57+03:00"},
+				{"user_id":0,"number":"2377225624","status":"PROCESSING","uploaded_at":"2024-11-10T15:09:57+03:00"}]`,
+			link: `</api/user/orders?after=` + next + `&limit=2&status=NEW%2CPROCESSING&status=PROCESSED>; rel="next"`,
+		},
+		{
+			name:   "Next page",
+			target: "/api/user/orders?limit=2&after=" + next,
+			prepare: func() {
+				acc.EXPECT().GetOrders(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, filter model.OrderFilter) ([]model.AccrualOrder, error) {
+						require.NotNil(t, filter.After)
+						assert.True(t, older.Equal(filter.After.UploadedAt))
+						assert.Equal(t, uint64(2377225624), filter.After.Number)
+						return orders[2:], nil
+					})
+			},
+			statusCode: http.StatusOK,
+			want:       `[{"user_id":0,"number":"49927398716","status":"NEW","uploaded_at":"2024-11-10T15:09:57+03:00"}]`,
+		},
+		{
+			name:   "Upload date range",
+			target: "/api/user/orders?from=2024-11-01&to=2024-11-10T00:00:00Z",
+			prepare: func() {
+				acc.EXPECT().GetOrders(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, filter model.OrderFilter) ([]model.AccrualOrder, error) {
+						assert.Zero(t, filter.Limit)
+						assert.Equal(t, time.Date(2024, 11, 1, 0, 0, 0, 0, time.Local), filter.From)
+						assert.True(t, time.Date(2024, 11, 10, 0, 0, 0, 0, time.UTC).Equal(filter.To))
+						return nil, nil
+					})
+			},
+			statusCode: http.StatusNoContent,
+		},
+		{
+			name:   "Newest first",
+			target: "/api/user/orders?order=desc&limit=2&after=" + cursor.Encode(model.OrderCursor{UploadedAt: newer, Number: 12345678903, Descending: true}),
+			prepare: func() {
+				acc.EXPECT().GetOrders(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, filter model.OrderFilter) ([]model.AccrualOrder, error) {
+						assert.True(t, filter.Descending)
+						require.NotNil(t, filter.After)
+						assert.Equal(t, uint64(12345678903), filter.After.Number)
+						return orders[1:2], nil
+					})
+			},
+			statusCode: http.StatusOK,
+			want:       `[{"user_id":0,"number":"2377225624","status":"PROCESSING","uploaded_at":"2024-11-10T15:09:57+03:00"}]`,
+		},
+		{
+			name:       "Cursor from the other order",
+			target:     "/api/user/orders?order=desc&limit=2&after=" + next,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Unknown order",
+			target:     "/api/user/orders?order=random",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Unknown status",
+			target:     "/api/user/orders?status=DONE",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Bad cursor",
+			target:     "/api/user/orders?after=garbage",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			if tt.prepare != nil {
+				tt.prepare()
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+			assert.Equal(t, tt.link, resp.Header.Get("Link"))
+			if tt.link != "" {
+				assert.Equal(t, next, resp.Header.Get("X-Next-Cursor"))
+			}
+			if tt.want != "" {
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				assert.JSONEq(t, tt.want, string(body))
+			}
+		})
+	}
+}
+
+func TestLoadOrdersBatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	log, _ := logger.InitLogger()
+	acc := http_mocks.NewMockAccrualOrderInterface(ctrl)
+	tokens := http_mocks.NewMockTokenRepoInterface(ctrl)
+	var rep = storage.Repository{Auth: http_mocks.NewMockAuthRepoInterface(ctrl),
+		Token:    tokens,
+		Attempts: memory.NewLoginAttempts(),
+		Lockout:  http_mocks.NewMockLockoutRepoInterface(ctrl),
+		Accrual:  acc,
+		Withdraw: http_mocks.NewMockWithdrawOrderRepoInterface(ctrl)}
+	conf := testConfig()
+	conf.OrdersBatchLimit = 3
+	services := service.NewService(&rep, conf, log)
+	tokenAuth, _ := keyring.Ephemeral()
+	h := NewHandler(services, tokenAuth, log)
+	r := h.CreateRouter()
+
+	tokens.EXPECT().IsSessionRevoked(gomock.Any(), testSessionID).Return(false, nil).AnyTimes()
+	token, _ := services.Token.GenerateToken(&model.User{ID: 1}, testSessionID, h.TokenAuth)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		prepare     func()
+		statusCode  int
+		want        string
+	}{
+		{
+			name:        "JSON array",
+			contentType: "application/json",
+			body:        `["12345678903", 2377225624, "12345"]`,
+			prepare: func() {
+				acc.EXPECT().SaveOrders(gomock.Any(), 1, []uint64{12345678903, 2377225624}).
+					Return([]string{model.OrderAccepted, model.OrderOwnedByAnother}, nil)
+			},
+			statusCode: http.StatusAccepted,
+			want: `[{"number":"12345678903","result":"accepted"},{"number":"2377225624","result":"owned_by_another_user"},
+				{"number":"12345","result":"invalid"}]`,
+		},
+		{
+			name:        "Newline separated list",
+			contentType: "text/plain; charset=utf-8",
+			body:        "12345678903\r\n\n49927398716\n",
+			prepare: func() {
+				acc.EXPECT().SaveOrders(gomock.Any(), 1, []uint64{12345678903, 49927398716}).
+					Return([]string{model.OrderAlreadyUploaded, model.OrderAlreadyUploaded}, nil)
+			},
+			statusCode: http.StatusOK,
+			want:       `[{"number":"12345678903","result":"already_uploaded"},{"number":"49927398716","result":"already_uploaded"}]`,
+		},
+		{
+			name:        "Only invalid numbers",
+			contentType: "text/plain",
+			body:        "abc\n-1",
+			statusCode:  http.StatusOK,
+			want:        `[{"number":"abc","result":"invalid"},{"number":"-1","result":"invalid"}]`,
+		},
+		{
+			name:        "Too many numbers",
+			contentType: "application/json",
+			body:        `["12345678903","2377225624","49927398716","79927398713"]`,
+			statusCode:  http.StatusBadRequest,
+		},
+		{
+			name:        "Empty list",
+			contentType: "application/json",
+			body:        `[]`,
+			statusCode:  http.StatusBadRequest,
+		},
+		{
+			name:        "Not an array",
+			contentType: "application/json",
+			body:        `{"orders":[]}`,
+			statusCode:  http.StatusBadRequest,
+		},
+		{
+			name:        "Unsupported content type",
+			contentType: "application/xml",
+			body:        `<orders/>`,
+			statusCode:  http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/user/orders/batch", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			req.Header.Set("Content-Type", tt.contentType)
+			if tt.prepare != nil {
+				tt.prepare()
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+			if tt.want != "" {
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				assert.JSONEq(t, tt.want, string(body))
+			}
+		})
+	}
+}
+
+func TestGetOrder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	log, _ := logger.InitLogger()
+	acc := http_mocks.NewMockAccrualOrderInterface(ctrl)
+	tokens := http_mocks.NewMockTokenRepoInterface(ctrl)
+	var rep = storage.Repository{Auth: http_mocks.NewMockAuthRepoInterface(ctrl),
+		Token:    tokens,
+		Attempts: memory.NewLoginAttempts(),
+		Lockout:  http_mocks.NewMockLockoutRepoInterface(ctrl),
+		Accrual:  acc,
+		Withdraw: http_mocks.NewMockWithdrawOrderRepoInterface(ctrl)}
+	services := service.NewService(&rep, testConfig(), log)
+	tokenAuth, _ := keyring.Ephemeral()
+	h := NewHandler(services, tokenAuth, log)
+	r := h.CreateRouter()
+
+	tokens.EXPECT().IsSessionRevoked(gomock.Any(), testSessionID).Return(false, nil).AnyTimes()
+	token, _ := services.Token.GenerateToken(&model.User{ID: 1}, testSessionID, h.TokenAuth)
+	uploaded := time.Date(2024, 11, 10, 16, 9, 57, 0, time.Local)
+
+	tests := []struct {
+		name       string
+		target     string
+		prepare    func()
+		statusCode int
+		want       string
+	}{
+		{
+			name:   "Order with history",
+			target: "/api/user/orders/12345678903",
+			prepare: func() {
+				acc.EXPECT().GetOrder(gomock.Any(), 1, uint64(12345678903)).Return(&model.OrderDetail{
+					AccrualOrder: model.AccrualOrder{UserID: 1, Number: 12345678903, Status: model.StatusPROCESSED,
+						Accrual: 500 * model.Point, UploadedAt: uploaded},
+					History: []model.OrderStatusChange{
+						{Status: model.StatusNEW, ChangedAt: uploaded},
+						{Status: model.StatusPROCESSING, ChangedAt: uploaded.Add(time.Minute)},
+						{Status: model.StatusPROCESSED, Accrual: 500 * model.Point, ChangedAt: uploaded.Add(2 * time.Minute)},
+					},
+				}, nil)
+			},
+			statusCode: http.StatusOK,
+			want: `{"user_id":1,"number":"12345678903","status":"PROCESSED","accrual":500,"uploaded_at":"2024-11-10T16:09:57+03:00",
+				"history":[{"status":"NEW","changed_at":"2024-11-10T16:09:57+03:00"},
+				{"status":"PROCESSING","changed_at":"2024-11-10T16:10:57+03:00"},
+				{"status":"PROCESSED","accrual":500,"changed_at":"2024-11-10T16:11:57+03:00"}]}`,
+		},
+		{
+			name:   "Not found",
+			target: "/api/user/orders/2377225624",
+			prepare: func() {
+				acc.EXPECT().GetOrder(gomock.Any(), 1, uint64(2377225624)).Return(nil, errs.OrderNotFoundError{})
+			},
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "Bad number",
+			target:     "/api/user/orders/abc",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			if tt.prepare != nil {
+				tt.prepare()
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+			if tt.want != "" {
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				assert.JSONEq(t, tt.want, string(body))
+			}
+		})
+	}
+}
+
+func TestStreamOrders(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	log, _ := logger.InitLogger()
+	events := http_mocks.NewMockOrderEventRepoInterface(ctrl)
+	tokens := http_mocks.NewMockTokenRepoInterface(ctrl)
+	var rep = storage.Repository{Auth: http_mocks.NewMockAuthRepoInterface(ctrl),
+		Token:    tokens,
+		Attempts: memory.NewLoginAttempts(),
+		Lockout:  http_mocks.NewMockLockoutRepoInterface(ctrl),
+		Events:   events}
+	services := service.NewService(&rep, testConfig(), log)
+	tokenAuth, _ := keyring.Ephemeral()
+	h := NewHandler(services, tokenAuth, log)
+	h.StreamHeartbeat = 50 * time.Millisecond
+	server := httptest.NewServer(h.CreateRouter())
+	defer server.Close()
+
+	tokens.EXPECT().IsSessionRevoked(gomock.Any(), testSessionID).Return(false, nil).AnyTimes()
+	token, _ := services.Token.GenerateToken(&model.User{ID: 1}, testSessionID, h.TokenAuth)
+	changed := time.Date(2024, 11, 10, 16, 9, 57, 0, time.Local)
+
+	publish := make(chan func(model.OrderEvent), 1)
+	events.EXPECT().Listen(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, handle func(model.OrderEvent)) error {
+			publish <- handle
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := sync.WaitGroup{}
+	services.Events.Start(ctx, &wg)
+	defer wg.Wait()
+	defer cancel()
+	handle := <-publish
+
+	t.Run("Bad Last-Event-ID", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/user/orders/stream", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Last-Event-ID", "abc")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Replay, live events and heartbeat", func(t *testing.T) {
+		missed := model.OrderEvent{ID: 6, UserID: 1, Number: 12345678903, Status: model.StatusPROCESSING, ChangedAt: changed}
+		events.EXPECT().GetOrderEvents(gomock.Any(), 1, int64(5), int64(0), gomock.Any()).Return([]model.OrderEvent{missed}, nil)
+
+		reqCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		req, _ := http.NewRequestWithContext(reqCtx, http.MethodGet, server.URL+"/api/user/orders/stream", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Last-Event-ID", "5")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		next := sseBlocks(t, resp.Body)
+		assert.Equal(t, "retry: 3000\n", next())
+		assert.Equal(t, "id: 6\nevent: order\n"+
+			`data: {"id":6,"user_id":1,"number":"12345678903","status":"PROCESSING","changed_at":"2024-11-10T16:09:57+03:00"}`+"\n", next())
+
+		handle(model.OrderEvent{ID: 7, UserID: 2, Number: 2377225624, Status: model.StatusNEW, ChangedAt: changed})
+		handle(missed)
+		handle(model.OrderEvent{ID: 8, UserID: 1, Number: 12345678903, Status: model.StatusPROCESSED,
+			Accrual: 500 * model.Point, ChangedAt: changed.Add(time.Minute)})
+
+		block := next()
+		for strings.HasPrefix(block, ": heartbeat") {
+			block = next()
+		}
+		assert.Equal(t, "id: 8\nevent: order\n"+
+			`data: {"id":8,"user_id":1,"number":"12345678903","status":"PROCESSED","accrual":500,"changed_at":"2024-11-10T16:10:57+03:00"}`+"\n", block)
+		assert.Equal(t, ": heartbeat\n", next())
+	})
+
+	t.Run("Replay in pages", func(t *testing.T) {
+		// история длиннее страницы; первой идёт переход 90, зафиксированный позже события 100
+		order := func(id int64) model.OrderEvent {
+			return model.OrderEvent{ID: id, UserID: 1, Number: 12345678903, Status: model.StatusNEW, ChangedAt: changed}
+		}
+		var pages [][]model.OrderEvent
+		events.EXPECT().GetOrderEvents(gomock.Any(), 1, int64(100), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ int, _, afterID int64, limit int) ([]model.OrderEvent, error) {
+				var page []model.OrderEvent
+				if len(pages) == 0 {
+					assert.Zero(t, afterID)
+					page = append(page, order(90))
+					for id := int64(101); len(page) < limit; id++ {
+						page = append(page, order(id))
+					}
+				} else {
+					// следующая страница продолжается после последнего отданного события
+					assert.Equal(t, pages[0][len(pages[0])-1].ID, afterID)
+					page = append(page, order(afterID+1), order(afterID+2))
+				}
+				pages = append(pages, page)
+				return page, nil
+			}).Times(2)
+
+		reqCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		req, _ := http.NewRequestWithContext(reqCtx, http.MethodGet, server.URL+"/api/user/orders/stream", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Last-Event-ID", "100")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		next := sseBlocks(t, resp.Body)
+		assert.Equal(t, "retry: 3000\n", next())
+		var want []model.OrderEvent
+		for _, page := range pages {
+			want = append(want, page...)
+		}
+		for _, event := range want {
+			assert.True(t, strings.HasPrefix(next(), fmt.Sprintf("id: %d\n", event.ID)))
+		}
+		assert.Len(t, pages, 2)
+	})
+
+	t.Run("Replay restores Last-Event-ID", func(t *testing.T) {
+		late := model.OrderEvent{ID: 40, UserID: 1, Number: 12345678903, Status: model.StatusPROCESSED, ChangedAt: changed}
+		events.EXPECT().GetOrderEvents(gomock.Any(), 1, int64(50), int64(0), gomock.Any()).Return([]model.OrderEvent{late}, nil)
+
+		reqCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		req, _ := http.NewRequestWithContext(reqCtx, http.MethodGet, server.URL+"/api/user/orders/stream", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Last-Event-ID", "50")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		next := sseBlocks(t, resp.Body)
+		assert.Equal(t, "retry: 3000\n", next())
+		assert.True(t, strings.HasPrefix(next(), "id: 40\nevent: order\n"))
+		// без этого браузер переподключился бы с Last-Event-ID 40 и получил бы 41-50 повторно
+		assert.Equal(t, "id: 50\n", next())
+	})
+}
+
+// sseBlocks читает поток Server-Sent Events по одному сообщению
+func sseBlocks(t *testing.T, body io.Reader) func() string {
+	reader := bufio.NewReader(body)
+	return func() string {
+		var block strings.Builder
+		for {
+			line, err := reader.ReadString('\n')
+			require.NoError(t, err)
+			if line == "\n" {
+				if block.Len() > 0 {
+					return block.String()
+				}
+				continue
+			}
+			block.WriteString(line)
+		}
+	}
+}
+
+type testResolver map[string][]string
+
+func (r testResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	ips, ok := r[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	addrs := make([]net.IPAddr, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return addrs, nil
+}
+
+func TestWebhooks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	log, _ := logger.InitLogger()
+	webhooks := http_mocks.NewMockWebhookRepoInterface(ctrl)
+	tokens := http_mocks.NewMockTokenRepoInterface(ctrl)
+	var rep = storage.Repository{Auth: http_mocks.NewMockAuthRepoInterface(ctrl),
+		Token:    tokens,
+		Attempts: memory.NewLoginAttempts(),
+		Lockout:  http_mocks.NewMockLockoutRepoInterface(ctrl),
+		Webhook:  webhooks}
+	services := service.NewService(&rep, testConfig(), log)
+	// внутренняя CRM разрешена явно, остальные внутренние адреса запрещены
+	internal, _ := webhook.ParseNetworks([]string{"10.20.0.0/16"})
+	services.Webhook = service.NewWebhookService(webhooks, webhook.Guard{Allowed: internal, Resolver: testResolver{
+		"crm.example.com": {"93.184.216.34"},
+		"crm.internal":    {"10.20.0.5"},
+		"db.internal":     {"10.30.0.5"},
+		"localtest.me":    {"127.0.0.1"},
+	}}, log)
+	tokenAuth, _ := keyring.Ephemeral()
+	h := NewHandler(services, tokenAuth, log)
+	r := h.CreateRouter()
+
+	tokens.EXPECT().IsSessionRevoked(gomock.Any(), testSessionID).Return(false, nil).AnyTimes()
+	userToken, _ := services.Token.GenerateToken(&model.User{ID: 1}, testSessionID, h.TokenAuth)
+	adminToken, _ := services.Token.GenerateToken(&model.User{ID: 7, Role: model.RoleAdmin}, testSessionID, h.TokenAuth)
+	created := time.Date(2024, 11, 10, 16, 9, 57, 0, time.Local)
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		token      string
+		body       string
+		prepare    func()
+		statusCode int
+		want       string
+	}{
+		{
+			name:   "Register user webhook",
+			method: http.MethodPost, target: "/api/user/webhooks", token: userToken,
+			body: `{"url":"https://crm.example.com/hooks","events":["order.processed"]}`,
+			prepare: func() {
+				webhooks.EXPECT().CreateWebhook(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, hook *model.Webhook) error {
+						assert.Equal(t, 1, hook.UserID)
+						assert.Equal(t, []string{model.WebhookOrderProcessed}, hook.Events)
+						assert.True(t, strings.HasPrefix(hook.Secret, "whsec_"))
+						hook.ID, hook.CreatedAt, hook.Secret = 3, created, "whsec_test"
+						return nil
+					})
+			},
+			statusCode: http.StatusCreated,
+			want: `{"id":3,"url":"https://crm.example.com/hooks","events":["order.processed"],
+				"secret":"whsec_test","created_at":"2024-11-10T16:09:57+03:00"}`,
+		},
+		{
+			name:   "Register system webhook for all events",
+			method: http.MethodPost, target: "/api/admin/webhooks", token: adminToken,
+			body: `{"url":"http://crm.internal/hooks"}`,
+			prepare: func() {
+				webhooks.EXPECT().CreateWebhook(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, hook *model.Webhook) error {
+						assert.Equal(t, 0, hook.UserID)
+						assert.Equal(t, model.WebhookEvents, hook.Events)
+						return nil
+					})
+			},
+			statusCode: http.StatusCreated,
+		},
+		{
+			name:   "Cloud metadata address",
+			method: http.MethodPost, target: "/api/user/webhooks", token: userToken,
+			body:       `{"url":"http://169.254.169.254/latest/meta-data"}`,
+			statusCode: http.StatusBadRequest,
+			want:       `{"violations":[{"field":"url","rule":"public","message":"url must point to a public address"}]}`,
+		},
+		{
+			name:   "Host resolving to loopback",
+			method: http.MethodPost, target: "/api/user/webhooks", token: userToken,
+			body:       `{"url":"http://localtest.me:8080/hooks"}`,
+			statusCode: http.StatusBadRequest,
+			want:       `{"violations":[{"field":"url","rule":"public","message":"url must point to a public address"}]}`,
+		},
+		{
+			name:   "Internal host outside allowed networks",
+			method: http.MethodPost, target: "/api/admin/webhooks", token: adminToken,
+			body:       `{"url":"http://db.internal/hooks"}`,
+			statusCode: http.StatusBadRequest,
+			want:       `{"violations":[{"field":"url","rule":"public","message":"url must point to a public address"}]}`,
+		},
+		{
+			name:   "Unresolvable host",
+			method: http.MethodPost, target: "/api/user/webhooks", token: userToken,
+			body:       `{"url":"https://missing.example.com/hooks"}`,
+			statusCode: http.StatusBadRequest,
+			want:       `{"violations":[{"field":"url","rule":"resolve","message":"url host cannot be resolved"}]}`,
+		},
+		{
+			name:   "Invalid url and event",
+			method: http.MethodPost, target: "/api/user/webhooks", token: userToken,
+			body:       `{"url":"ftp://crm.example.com","events":["order.created"]}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:   "Regular user cannot register system webhook",
+			method: http.MethodPost, target: "/api/admin/webhooks", token: userToken,
+			body:       `{"url":"https://crm.example.com/hooks"}`,
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:   "List webhooks without secrets",
+			method: http.MethodGet, target: "/api/user/webhooks", token: userToken,
+			prepare: func() {
+				webhooks.EXPECT().GetWebhooks(gomock.Any(), 1).Return([]model.Webhook{{
+					ID: 3, UserID: 1, URL: "https://crm.example.com/hooks", Events: []string{model.WebhookOrderProcessed}, CreatedAt: created,
+				}}, nil)
+			},
+			statusCode: http.StatusOK,
+			want:       `[{"id":3,"url":"https://crm.example.com/hooks","events":["order.processed"],"created_at":"2024-11-10T16:09:57+03:00"}]`,
+		},
+		{
+			name:   "Delete someone else's webhook",
+			method: http.MethodDelete, target: "/api/user/webhooks/4", token: userToken,
+			prepare: func() {
+				webhooks.EXPECT().DeleteWebhook(gomock.Any(), 1, int64(4)).Return(errs.WebhookNotFoundError{})
+			},
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:   "Delete system webhook",
+			method: http.MethodDelete, target: "/api/admin/webhooks/5", token: adminToken,
+			prepare: func() {
+				webhooks.EXPECT().DeleteWebhook(gomock.Any(), 0, int64(5)).Return(nil)
+			},
+			statusCode: http.StatusNoContent,
+		},
+		{
+			name:   "Dead letters",
+			method: http.MethodGet, target: "/api/admin/webhooks/deliveries/dead", token: adminToken,
+			prepare: func() {
+				webhooks.EXPECT().GetDeliveries(gomock.Any(), model.DeliveryDead, gomock.Any()).Return([]model.WebhookDelivery{{
+					ID: 9, WebhookID: 3, URL: "https://crm.example.com/hooks", Secret: "whsec_test",
+					EventID: 11, EventType: model.WebhookWithdrawalCreated, Payload: json.RawMessage(`{"order":"2377225624"}`),
+					EventCreatedAt: created, Status: model.DeliveryDead, Attempts: 10, NextAttemptAt: created,
+					LastError: "unexpected status 503", LastStatusCode: http.StatusServiceUnavailable,
+				}}, nil)
+			},
+			statusCode: http.StatusOK,
+			want: `[{"id":9,"webhook_id":3,"url":"https://crm.example.com/hooks","event_id":11,"event":"withdrawal.created",
+				"payload":{"order":"2377225624"},"event_created_at":"2024-11-10T16:09:57+03:00","status":"dead","attempts":10,
+				"next_attempt_at":"2024-11-10T16:09:57+03:00","last_error":"unexpected status 503","last_status_code":503}]`,
+		},
+		{
+			name:   "Replay dead letter",
+			method: http.MethodPost, target: "/api/admin/webhooks/deliveries/9/replay", token: adminToken,
+			prepare: func() {
+				webhooks.EXPECT().ReplayDelivery(gomock.Any(), int64(9)).Return(nil)
+			},
+			statusCode: http.StatusAccepted,
+		},
+		{
+			name:   "Replay unknown delivery",
+			method: http.MethodPost, target: "/api/admin/webhooks/deliveries/10/replay", token: adminToken,
+			prepare: func() {
+				webhooks.EXPECT().ReplayDelivery(gomock.Any(), int64(10)).Return(errs.WebhookDeliveryNotFoundError{})
+			},
+			statusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			if tt.prepare != nil {
+				tt.prepare()
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+			if tt.want != "" {
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				assert.JSONEq(t, tt.want, string(body))
+			}
+		})
+	}
+}
+
+type healthStub agentmodel.AccrualHealth
+
+func (s healthStub) Health() agentmodel.AccrualHealth {
+	return agentmodel.AccrualHealth(s)
+}
+
+func TestHealth(t *testing.T) {
+	log, _ := logger.InitLogger()
+	tokenAuth, _ := keyring.Ephemeral()
+	openedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	retryAt := openedAt.Add(30 * time.Second)
+
+	tests := []struct {
+		name    string
+		accrual HealthChecker
+		want    string
+	}{
+		{
+			name: "No Agent",
+			want: `{"status":"ok"}`,
+		},
+		{
+			name:    "Closed",
+			accrual: healthStub{State: agentmodel.CircuitClosed, Failures: 2},
+			want:    `{"status":"ok","accrual":{"state":"closed","failures":2}}`,
+		},
+		{
+			name:    "Open",
+			accrual: healthStub{State: agentmodel.CircuitOpen, Failures: 5, OpenedAt: &openedAt, RetryAt: &retryAt},
+			want: `{"status":"degraded","accrual":{"state":"open","failures":5,
+				"opened_at":"2024-03-01T12:00:00Z","retry_at":"2024-03-01T12:00:30Z"}}`,
+		},
+		{
+			name:    "Half Open",
+			accrual: healthStub{State: agentmodel.CircuitHalfOpen, OpenedAt: &openedAt, RetryAt: &retryAt},
+			want: `{"status":"ok","accrual":{"state":"half-open","failures":0,
+				"opened_at":"2024-03-01T12:00:00Z","retry_at":"2024-03-01T12:00:30Z"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(&service.ServiceCollection{}, tokenAuth, log)
+			h.Accrual = tt.accrual
+			req := httptest.NewRequest(http.MethodGet, "/api/health", nil)
+			w := httptest.NewRecorder()
+			h.CreateRouter().ServeHTTP(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(body))
+		})
+	}
+}
+
+func TestAdminLogin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	log, _ := logger.InitLogger()
+	auth := http_mocks.NewMockAuthRepoInterface(ctrl)
+	tokens := http_mocks.NewMockTokenRepoInterface(ctrl)
+	lockouts := http_mocks.NewMockLockoutRepoInterface(ctrl)
+	tokens.EXPECT().CreateSession(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	tokens.EXPECT().IsSessionRevoked(gomock.Any(), gomock.Any()).Return(false, nil).AnyTimes()
+	var rep = storage.Repository{Auth: auth,
+		Token:    tokens,
+		Attempts: memory.NewLoginAttempts(),
+		Lockout:  lockouts}
+	services := service.NewService(&rep, testConfig(), log)
+	tokenAuth, _ := keyring.Ephemeral()
+	r := NewHandler(services, tokenAuth, log).CreateRouter()
+
+	tests := []struct {
+		name       string
+		role       string
+		statusCode int
+	}{
+		{name: "Admin", role: model.RoleAdmin, statusCode: http.StatusNoContent},
+		{name: "User", role: model.RoleUser, statusCode: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth.EXPECT().GetUserByLogin(gomock.Any(), "support").
+				Return(&model.User{ID: 7, Login: "support", Password: bcryptHash("1"), Role: tt.role}, nil)
+			if tt.role == model.RoleAdmin {
+				lockouts.EXPECT().GetActiveLockouts(gomock.Any()).Return(nil, nil)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/user/login", strings.NewReader(`{"login":"support","password":"1"}`))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			require.Equal(t, http.StatusOK, w.Code)
+
+			// токен после входа сразу несёт роль из базы, обновлять его не нужно
+			req = httptest.NewRequest(http.MethodGet, "/api/admin/lockouts", nil)
+			req.Header.Set("Authorization", w.Header().Get("Authorization"))
+			w = httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.statusCode, w.Code)
+		})
+	}
+}
+
+func TestLoginEmptyCredentials(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	log, _ := logger.InitLogger()
+	// ни хранилище, ни защита от перебора не вызываются
+	var rep = storage.Repository{Auth: http_mocks.NewMockAuthRepoInterface(ctrl),
+		Token:    http_mocks.NewMockTokenRepoInterface(ctrl),
+		Attempts: memory.NewLoginAttempts(),
+		Lockout:  http_mocks.NewMockLockoutRepoInterface(ctrl)}
+	services := service.NewService(&rep, testConfig(), log)
+	tokenAuth, _ := keyring.Ephemeral()
+	r := NewHandler(services, tokenAuth, log).CreateRouter()
+
+	for _, body := range []string{`{"login":"user"}`, `{"password":"1"}`, `{}`} {
+		req := httptest.NewRequest(http.MethodPost, "/api/user/login", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		assert.Equal(t, "empty login or password\n", w.Body.String(), body)
+	}
+}
@@ -7,6 +7,7 @@ package http_mocks
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	model "github.com/SversusN/gophermart/internal/model"
 	gomock "github.com/golang/mock/gomock"
@@ -35,6 +36,20 @@ func (m *MockAuthRepoInterface) EXPECT() *MockAuthRepoInterfaceMockRecorder {
 	return m.recorder
 }
 
+// ChangePassword mocks base method.
+func (m *MockAuthRepoInterface) ChangePassword(ctx context.Context, userID int, passwordHash string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ChangePassword", ctx, userID, passwordHash)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ChangePassword indicates an expected call of ChangePassword.
+func (mr *MockAuthRepoInterfaceMockRecorder) ChangePassword(ctx, userID, passwordHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangePassword", reflect.TypeOf((*MockAuthRepoInterface)(nil).ChangePassword), ctx, userID, passwordHash)
+}
+
 // CreateUser mocks base method.
 func (m *MockAuthRepoInterface) CreateUser(ctx context.Context, user *model.User) (int, error) {
 	m.ctrl.T.Helper()
@@ -50,19 +65,566 @@ func (mr *MockAuthRepoInterfaceMockRecorder) CreateUser(ctx, user interface{}) *
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockAuthRepoInterface)(nil).CreateUser), ctx, user)
 }
 
-// GetUserID mocks base method.
-func (m *MockAuthRepoInterface) GetUserID(ctx context.Context, user *model.User) (int, error) {
+// DeleteUser mocks base method.
+func (m *MockAuthRepoInterface) DeleteUser(ctx context.Context, userID int, force bool) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUserID", ctx, user)
-	ret0, _ := ret[0].(int)
+	ret := m.ctrl.Call(m, "DeleteUser", ctx, userID, force)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUser indicates an expected call of DeleteUser.
+func (mr *MockAuthRepoInterfaceMockRecorder) DeleteUser(ctx, userID, force interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockAuthRepoInterface)(nil).DeleteUser), ctx, userID, force)
+}
+
+// GetUserByID mocks base method.
+func (m *MockAuthRepoInterface) GetUserByID(ctx context.Context, userID int) (*model.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByID", ctx, userID)
+	ret0, _ := ret[0].(*model.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByID indicates an expected call of GetUserByID.
+func (mr *MockAuthRepoInterfaceMockRecorder) GetUserByID(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByID", reflect.TypeOf((*MockAuthRepoInterface)(nil).GetUserByID), ctx, userID)
+}
+
+// GetUserByLogin mocks base method.
+func (m *MockAuthRepoInterface) GetUserByLogin(ctx context.Context, login string) (*model.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByLogin", ctx, login)
+	ret0, _ := ret[0].(*model.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByLogin indicates an expected call of GetUserByLogin.
+func (mr *MockAuthRepoInterfaceMockRecorder) GetUserByLogin(ctx, login interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByLogin", reflect.TypeOf((*MockAuthRepoInterface)(nil).GetUserByLogin), ctx, login)
+}
+
+// UpdatePassword mocks base method.
+func (m *MockAuthRepoInterface) UpdatePassword(ctx context.Context, userID int, passwordHash string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePassword", ctx, userID, passwordHash)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePassword indicates an expected call of UpdatePassword.
+func (mr *MockAuthRepoInterfaceMockRecorder) UpdatePassword(ctx, userID, passwordHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePassword", reflect.TypeOf((*MockAuthRepoInterface)(nil).UpdatePassword), ctx, userID, passwordHash)
+}
+
+// MockTokenRepoInterface is a mock of TokenRepoInterface interface.
+type MockTokenRepoInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockTokenRepoInterfaceMockRecorder
+}
+
+// MockTokenRepoInterfaceMockRecorder is the mock recorder for MockTokenRepoInterface.
+type MockTokenRepoInterfaceMockRecorder struct {
+	mock *MockTokenRepoInterface
+}
+
+// NewMockTokenRepoInterface creates a new mock instance.
+func NewMockTokenRepoInterface(ctrl *gomock.Controller) *MockTokenRepoInterface {
+	mock := &MockTokenRepoInterface{ctrl: ctrl}
+	mock.recorder = &MockTokenRepoInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTokenRepoInterface) EXPECT() *MockTokenRepoInterfaceMockRecorder {
+	return m.recorder
+}
+
+// CreateSession mocks base method.
+func (m *MockTokenRepoInterface) CreateSession(ctx context.Context, session *model.Session, tokenHash string, expiresAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateSession", ctx, session, tokenHash, expiresAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateSession indicates an expected call of CreateSession.
+func (mr *MockTokenRepoInterfaceMockRecorder) CreateSession(ctx, session, tokenHash, expiresAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSession", reflect.TypeOf((*MockTokenRepoInterface)(nil).CreateSession), ctx, session, tokenHash, expiresAt)
+}
+
+// IsSessionRevoked mocks base method.
+func (m *MockTokenRepoInterface) IsSessionRevoked(ctx context.Context, sessionID string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsSessionRevoked", ctx, sessionID)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsSessionRevoked indicates an expected call of IsSessionRevoked.
+func (mr *MockTokenRepoInterfaceMockRecorder) IsSessionRevoked(ctx, sessionID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsSessionRevoked", reflect.TypeOf((*MockTokenRepoInterface)(nil).IsSessionRevoked), ctx, sessionID)
+}
+
+// RevokeSession mocks base method.
+func (m *MockTokenRepoInterface) RevokeSession(ctx context.Context, sessionID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeSession", ctx, sessionID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeSession indicates an expected call of RevokeSession.
+func (mr *MockTokenRepoInterfaceMockRecorder) RevokeSession(ctx, sessionID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeSession", reflect.TypeOf((*MockTokenRepoInterface)(nil).RevokeSession), ctx, sessionID)
+}
+
+// RotateRefreshToken mocks base method.
+func (m *MockTokenRepoInterface) RotateRefreshToken(ctx context.Context, oldHash string, newHash string, expiresAt time.Time) (*model.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateRefreshToken", ctx, oldHash, newHash, expiresAt)
+	ret0, _ := ret[0].(*model.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RotateRefreshToken indicates an expected call of RotateRefreshToken.
+func (mr *MockTokenRepoInterfaceMockRecorder) RotateRefreshToken(ctx, oldHash, newHash, expiresAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateRefreshToken", reflect.TypeOf((*MockTokenRepoInterface)(nil).RotateRefreshToken), ctx, oldHash, newHash, expiresAt)
+}
+
+// MockLoginAttemptRepoInterface is a mock of LoginAttemptRepoInterface interface.
+type MockLoginAttemptRepoInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockLoginAttemptRepoInterfaceMockRecorder
+}
+
+// MockLoginAttemptRepoInterfaceMockRecorder is the mock recorder for MockLoginAttemptRepoInterface.
+type MockLoginAttemptRepoInterfaceMockRecorder struct {
+	mock *MockLoginAttemptRepoInterface
+}
+
+// NewMockLoginAttemptRepoInterface creates a new mock instance.
+func NewMockLoginAttemptRepoInterface(ctrl *gomock.Controller) *MockLoginAttemptRepoInterface {
+	mock := &MockLoginAttemptRepoInterface{ctrl: ctrl}
+	mock.recorder = &MockLoginAttemptRepoInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLoginAttemptRepoInterface) EXPECT() *MockLoginAttemptRepoInterfaceMockRecorder {
+	return m.recorder
+}
+
+// Get mocks base method.
+func (m *MockLoginAttemptRepoInterface) Get(ctx context.Context, key string) (model.LoginAttempts, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, key)
+	ret0, _ := ret[0].(model.LoginAttempts)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockLoginAttemptRepoInterfaceMockRecorder) Get(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockLoginAttemptRepoInterface)(nil).Get), ctx, key)
+}
+
+// RegisterFailure mocks base method.
+func (m *MockLoginAttemptRepoInterface) RegisterFailure(ctx context.Context, key string, now time.Time, limit model.AttemptLimit) (model.LoginAttempts, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RegisterFailure", ctx, key, now, limit)
+	ret0, _ := ret[0].(model.LoginAttempts)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// RegisterFailure indicates an expected call of RegisterFailure.
+func (mr *MockLoginAttemptRepoInterfaceMockRecorder) RegisterFailure(ctx, key, now, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegisterFailure", reflect.TypeOf((*MockLoginAttemptRepoInterface)(nil).RegisterFailure), ctx, key, now, limit)
+}
+
+// Reset mocks base method.
+func (m *MockLoginAttemptRepoInterface) Reset(ctx context.Context, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reset", ctx, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Reset indicates an expected call of Reset.
+func (mr *MockLoginAttemptRepoInterfaceMockRecorder) Reset(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reset", reflect.TypeOf((*MockLoginAttemptRepoInterface)(nil).Reset), ctx, key)
+}
+
+// MockLockoutRepoInterface is a mock of LockoutRepoInterface interface.
+type MockLockoutRepoInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockLockoutRepoInterfaceMockRecorder
+}
+
+// MockLockoutRepoInterfaceMockRecorder is the mock recorder for MockLockoutRepoInterface.
+type MockLockoutRepoInterfaceMockRecorder struct {
+	mock *MockLockoutRepoInterface
+}
+
+// NewMockLockoutRepoInterface creates a new mock instance.
+func NewMockLockoutRepoInterface(ctrl *gomock.Controller) *MockLockoutRepoInterface {
+	mock := &MockLockoutRepoInterface{ctrl: ctrl}
+	mock.recorder = &MockLockoutRepoInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLockoutRepoInterface) EXPECT() *MockLockoutRepoInterfaceMockRecorder {
+	return m.recorder
+}
+
+// GetActiveLockouts mocks base method.
+func (m *MockLockoutRepoInterface) GetActiveLockouts(ctx context.Context) ([]model.Lockout, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetActiveLockouts", ctx)
+	ret0, _ := ret[0].([]model.Lockout)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetActiveLockouts indicates an expected call of GetActiveLockouts.
+func (mr *MockLockoutRepoInterfaceMockRecorder) GetActiveLockouts(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetActiveLockouts", reflect.TypeOf((*MockLockoutRepoInterface)(nil).GetActiveLockouts), ctx)
+}
+
+// MarkIPUnlocked mocks base method.
+func (m *MockLockoutRepoInterface) MarkIPUnlocked(ctx context.Context, ip string, unlockedBy int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkIPUnlocked", ctx, ip, unlockedBy)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkIPUnlocked indicates an expected call of MarkIPUnlocked.
+func (mr *MockLockoutRepoInterfaceMockRecorder) MarkIPUnlocked(ctx, ip, unlockedBy interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkIPUnlocked", reflect.TypeOf((*MockLockoutRepoInterface)(nil).MarkIPUnlocked), ctx, ip, unlockedBy)
+}
+
+// MarkUnlocked mocks base method.
+func (m *MockLockoutRepoInterface) MarkUnlocked(ctx context.Context, login string, unlockedBy int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkUnlocked", ctx, login, unlockedBy)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkUnlocked indicates an expected call of MarkUnlocked.
+func (mr *MockLockoutRepoInterfaceMockRecorder) MarkUnlocked(ctx, login, unlockedBy interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkUnlocked", reflect.TypeOf((*MockLockoutRepoInterface)(nil).MarkUnlocked), ctx, login, unlockedBy)
+}
+
+// RecordLockout mocks base method.
+func (m *MockLockoutRepoInterface) RecordLockout(ctx context.Context, lockout *model.Lockout) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordLockout", ctx, lockout)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RecordLockout indicates an expected call of RecordLockout.
+func (mr *MockLockoutRepoInterfaceMockRecorder) RecordLockout(ctx, lockout interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordLockout", reflect.TypeOf((*MockLockoutRepoInterface)(nil).RecordLockout), ctx, lockout)
+}
+
+// MockAdminRepoInterface is a mock of AdminRepoInterface interface.
+type MockAdminRepoInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockAdminRepoInterfaceMockRecorder
+}
+
+// MockAdminRepoInterfaceMockRecorder is the mock recorder for MockAdminRepoInterface.
+type MockAdminRepoInterfaceMockRecorder struct {
+	mock *MockAdminRepoInterface
+}
+
+// NewMockAdminRepoInterface creates a new mock instance.
+func NewMockAdminRepoInterface(ctrl *gomock.Controller) *MockAdminRepoInterface {
+	mock := &MockAdminRepoInterface{ctrl: ctrl}
+	mock.recorder = &MockAdminRepoInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAdminRepoInterface) EXPECT() *MockAdminRepoInterfaceMockRecorder {
+	return m.recorder
+}
+
+// AdjustBalance mocks base method.
+func (m *MockAdminRepoInterface) AdjustBalance(ctx context.Context, adjustment *model.BalanceAdjustment) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AdjustBalance", ctx, adjustment)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AdjustBalance indicates an expected call of AdjustBalance.
+func (mr *MockAdminRepoInterfaceMockRecorder) AdjustBalance(ctx, adjustment interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AdjustBalance", reflect.TypeOf((*MockAdminRepoInterface)(nil).AdjustBalance), ctx, adjustment)
+}
+
+// GetUserInfo mocks base method.
+func (m *MockAdminRepoInterface) GetUserInfo(ctx context.Context, userID int) (*model.UserInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserInfo", ctx, userID)
+	ret0, _ := ret[0].(*model.UserInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserInfo indicates an expected call of GetUserInfo.
+func (mr *MockAdminRepoInterfaceMockRecorder) GetUserInfo(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserInfo", reflect.TypeOf((*MockAdminRepoInterface)(nil).GetUserInfo), ctx, userID)
+}
+
+// GetUserInfoByLogin mocks base method.
+func (m *MockAdminRepoInterface) GetUserInfoByLogin(ctx context.Context, login string) (*model.UserInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserInfoByLogin", ctx, login)
+	ret0, _ := ret[0].(*model.UserInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserInfoByLogin indicates an expected call of GetUserInfoByLogin.
+func (mr *MockAdminRepoInterfaceMockRecorder) GetUserInfoByLogin(ctx, login interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserInfoByLogin", reflect.TypeOf((*MockAdminRepoInterface)(nil).GetUserInfoByLogin), ctx, login)
+}
+
+// RequeueOrder mocks base method.
+func (m *MockAdminRepoInterface) RequeueOrder(ctx context.Context, number uint64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RequeueOrder", ctx, number)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RequeueOrder indicates an expected call of RequeueOrder.
+func (mr *MockAdminRepoInterfaceMockRecorder) RequeueOrder(ctx, number interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RequeueOrder", reflect.TypeOf((*MockAdminRepoInterface)(nil).RequeueOrder), ctx, number)
+}
+
+// MockLedgerRepoInterface is a mock of LedgerRepoInterface interface.
+type MockLedgerRepoInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockLedgerRepoInterfaceMockRecorder
+}
+
+// MockLedgerRepoInterfaceMockRecorder is the mock recorder for MockLedgerRepoInterface.
+type MockLedgerRepoInterfaceMockRecorder struct {
+	mock *MockLedgerRepoInterface
+}
+
+// NewMockLedgerRepoInterface creates a new mock instance.
+func NewMockLedgerRepoInterface(ctrl *gomock.Controller) *MockLedgerRepoInterface {
+	mock := &MockLedgerRepoInterface{ctrl: ctrl}
+	mock.recorder = &MockLedgerRepoInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLedgerRepoInterface) EXPECT() *MockLedgerRepoInterfaceMockRecorder {
+	return m.recorder
+}
+
+// ExpireLot mocks base method.
+func (m *MockLedgerRepoInterface) ExpireLot(ctx context.Context, lot *model.PointLot) (model.Money, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExpireLot", ctx, lot)
+	ret0, _ := ret[0].(model.Money)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExpireLot indicates an expected call of ExpireLot.
+func (mr *MockLedgerRepoInterfaceMockRecorder) ExpireLot(ctx, lot interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExpireLot", reflect.TypeOf((*MockLedgerRepoInterface)(nil).ExpireLot), ctx, lot)
+}
+
+// GetBalance mocks base method.
+func (m *MockLedgerRepoInterface) GetBalance(ctx context.Context, userID int) (*model.Balance, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBalance", ctx, userID)
+	ret0, _ := ret[0].(*model.Balance)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBalance indicates an expected call of GetBalance.
+func (mr *MockLedgerRepoInterfaceMockRecorder) GetBalance(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBalance", reflect.TypeOf((*MockLedgerRepoInterface)(nil).GetBalance), ctx, userID)
+}
+
+// GetExpiredLots mocks base method.
+func (m *MockLedgerRepoInterface) GetExpiredLots(ctx context.Context, earnedBefore time.Time, limit int) ([]model.PointLot, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetExpiredLots", ctx, earnedBefore, limit)
+	ret0, _ := ret[0].([]model.PointLot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetExpiredLots indicates an expected call of GetExpiredLots.
+func (mr *MockLedgerRepoInterfaceMockRecorder) GetExpiredLots(ctx, earnedBefore, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetExpiredLots", reflect.TypeOf((*MockLedgerRepoInterface)(nil).GetExpiredLots), ctx, earnedBefore, limit)
+}
+
+// GetExpiringLots mocks base method.
+func (m *MockLedgerRepoInterface) GetExpiringLots(ctx context.Context, userID int, earnedBefore time.Time) ([]model.PointLot, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetExpiringLots", ctx, userID, earnedBefore)
+	ret0, _ := ret[0].([]model.PointLot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetExpiringLots indicates an expected call of GetExpiringLots.
+func (mr *MockLedgerRepoInterfaceMockRecorder) GetExpiringLots(ctx, userID, earnedBefore interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetExpiringLots", reflect.TypeOf((*MockLedgerRepoInterface)(nil).GetExpiringLots), ctx, userID, earnedBefore)
+}
+
+// GetTransactions mocks base method.
+func (m *MockLedgerRepoInterface) GetTransactions(ctx context.Context, filter model.TransactionFilter) ([]model.Transaction, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTransactions", ctx, filter)
+	ret0, _ := ret[0].([]model.Transaction)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTransactions indicates an expected call of GetTransactions.
+func (mr *MockLedgerRepoInterfaceMockRecorder) GetTransactions(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTransactions", reflect.TypeOf((*MockLedgerRepoInterface)(nil).GetTransactions), ctx, filter)
+}
+
+// Reconcile mocks base method.
+func (m *MockLedgerRepoInterface) Reconcile(ctx context.Context) ([]model.BalanceDrift, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reconcile", ctx)
+	ret0, _ := ret[0].([]model.BalanceDrift)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Reconcile indicates an expected call of Reconcile.
+func (mr *MockLedgerRepoInterfaceMockRecorder) Reconcile(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reconcile", reflect.TypeOf((*MockLedgerRepoInterface)(nil).Reconcile), ctx)
+}
+
+// MockIdempotencyRepoInterface is a mock of IdempotencyRepoInterface interface.
+type MockIdempotencyRepoInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockIdempotencyRepoInterfaceMockRecorder
+}
+
+// MockIdempotencyRepoInterfaceMockRecorder is the mock recorder for MockIdempotencyRepoInterface.
+type MockIdempotencyRepoInterfaceMockRecorder struct {
+	mock *MockIdempotencyRepoInterface
+}
+
+// NewMockIdempotencyRepoInterface creates a new mock instance.
+func NewMockIdempotencyRepoInterface(ctrl *gomock.Controller) *MockIdempotencyRepoInterface {
+	mock := &MockIdempotencyRepoInterface{ctrl: ctrl}
+	mock.recorder = &MockIdempotencyRepoInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockIdempotencyRepoInterface) EXPECT() *MockIdempotencyRepoInterfaceMockRecorder {
+	return m.recorder
+}
+
+// Complete mocks base method.
+func (m *MockIdempotencyRepoInterface) Complete(ctx context.Context, record *model.IdempotencyRecord) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Complete", ctx, record)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Complete indicates an expected call of Complete.
+func (mr *MockIdempotencyRepoInterfaceMockRecorder) Complete(ctx, record interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Complete", reflect.TypeOf((*MockIdempotencyRepoInterface)(nil).Complete), ctx, record)
+}
+
+// DeleteExpired mocks base method.
+func (m *MockIdempotencyRepoInterface) DeleteExpired(ctx context.Context) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteExpired", ctx)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteExpired indicates an expected call of DeleteExpired.
+func (mr *MockIdempotencyRepoInterfaceMockRecorder) DeleteExpired(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteExpired", reflect.TypeOf((*MockIdempotencyRepoInterface)(nil).DeleteExpired), ctx)
+}
+
+// Release mocks base method.
+func (m *MockIdempotencyRepoInterface) Release(ctx context.Context, userID int, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Release", ctx, userID, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Release indicates an expected call of Release.
+func (mr *MockIdempotencyRepoInterfaceMockRecorder) Release(ctx, userID, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Release", reflect.TypeOf((*MockIdempotencyRepoInterface)(nil).Release), ctx, userID, key)
+}
+
+// Reserve mocks base method.
+func (m *MockIdempotencyRepoInterface) Reserve(ctx context.Context, record *model.IdempotencyRecord) (*model.IdempotencyRecord, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reserve", ctx, record)
+	ret0, _ := ret[0].(*model.IdempotencyRecord)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetUserID indicates an expected call of GetUserID.
-func (mr *MockAuthRepoInterfaceMockRecorder) GetUserID(ctx, user interface{}) *gomock.Call {
+// Reserve indicates an expected call of Reserve.
+func (mr *MockIdempotencyRepoInterfaceMockRecorder) Reserve(ctx, record interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserID", reflect.TypeOf((*MockAuthRepoInterface)(nil).GetUserID), ctx, user)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reserve", reflect.TypeOf((*MockIdempotencyRepoInterface)(nil).Reserve), ctx, record)
 }
 
 // MockAccrualOrderInterface is a mock of AccrualOrderInterface interface.
@@ -88,6 +650,36 @@ func (m *MockAccrualOrderInterface) EXPECT() *MockAccrualOrderInterfaceMockRecor
 	return m.recorder
 }
 
+// GetOrder mocks base method.
+func (m *MockAccrualOrderInterface) GetOrder(ctx context.Context, userID int, number uint64) (*model.OrderDetail, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrder", ctx, userID, number)
+	ret0, _ := ret[0].(*model.OrderDetail)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrder indicates an expected call of GetOrder.
+func (mr *MockAccrualOrderInterfaceMockRecorder) GetOrder(ctx, userID, number interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrder", reflect.TypeOf((*MockAccrualOrderInterface)(nil).GetOrder), ctx, userID, number)
+}
+
+// GetOrders mocks base method.
+func (m *MockAccrualOrderInterface) GetOrders(ctx context.Context, filter model.OrderFilter) ([]model.AccrualOrder, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrders", ctx, filter)
+	ret0, _ := ret[0].([]model.AccrualOrder)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrders indicates an expected call of GetOrders.
+func (mr *MockAccrualOrderInterfaceMockRecorder) GetOrders(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrders", reflect.TypeOf((*MockAccrualOrderInterface)(nil).GetOrders), ctx, filter)
+}
+
 // GetUploadedOrders mocks base method.
 func (m *MockAccrualOrderInterface) GetUploadedOrders(ctx context.Context, userID int) ([]model.AccrualOrder, error) {
 	m.ctrl.T.Helper()
@@ -131,6 +723,21 @@ func (mr *MockAccrualOrderInterfaceMockRecorder) SaveOrder(ctx, order interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveOrder", reflect.TypeOf((*MockAccrualOrderInterface)(nil).SaveOrder), ctx, order)
 }
 
+// SaveOrders mocks base method.
+func (m *MockAccrualOrderInterface) SaveOrders(ctx context.Context, userID int, numbers []uint64) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveOrders", ctx, userID, numbers)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SaveOrders indicates an expected call of SaveOrders.
+func (mr *MockAccrualOrderInterfaceMockRecorder) SaveOrders(ctx, userID, numbers interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveOrders", reflect.TypeOf((*MockAccrualOrderInterface)(nil).SaveOrders), ctx, userID, numbers)
+}
+
 // MockWithdrawOrderRepoInterface is a mock of WithdrawOrderRepoInterface interface.
 type MockWithdrawOrderRepoInterface struct {
 	ctrl     *gomock.Controller
@@ -168,18 +775,19 @@ func (mr *MockWithdrawOrderRepoInterfaceMockRecorder) DeductPoints(ctx, order in
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeductPoints", reflect.TypeOf((*MockWithdrawOrderRepoInterface)(nil).DeductPoints), ctx, order)
 }
 
-// GetAccruals mocks base method.
-func (m *MockWithdrawOrderRepoInterface) GetAccruals(ctx context.Context, UserID int) float32 {
+// GetExpiredHolds mocks base method.
+func (m *MockWithdrawOrderRepoInterface) GetExpiredHolds(ctx context.Context, now time.Time, limit int) ([]uint64, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAccruals", ctx, UserID)
-	ret0, _ := ret[0].(float32)
-	return ret0
+	ret := m.ctrl.Call(m, "GetExpiredHolds", ctx, now, limit)
+	ret0, _ := ret[0].([]uint64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
-// GetAccruals indicates an expected call of GetAccruals.
-func (mr *MockWithdrawOrderRepoInterfaceMockRecorder) GetAccruals(ctx, UserID interface{}) *gomock.Call {
+// GetExpiredHolds indicates an expected call of GetExpiredHolds.
+func (mr *MockWithdrawOrderRepoInterfaceMockRecorder) GetExpiredHolds(ctx, now, limit interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAccruals", reflect.TypeOf((*MockWithdrawOrderRepoInterface)(nil).GetAccruals), ctx, UserID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetExpiredHolds", reflect.TypeOf((*MockWithdrawOrderRepoInterface)(nil).GetExpiredHolds), ctx, now, limit)
 }
 
 // GetWithdrawalOfPoints mocks base method.
@@ -197,16 +805,258 @@ func (mr *MockWithdrawOrderRepoInterfaceMockRecorder) GetWithdrawalOfPoints(ctx,
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWithdrawalOfPoints", reflect.TypeOf((*MockWithdrawOrderRepoInterface)(nil).GetWithdrawalOfPoints), ctx, userID)
 }
 
-// GetWithdrawals mocks base method.
-func (m *MockWithdrawOrderRepoInterface) GetWithdrawals(ctx context.Context, UserID int) float32 {
+// RefundWithdrawal mocks base method.
+func (m *MockWithdrawOrderRepoInterface) RefundWithdrawal(ctx context.Context, refund *model.WithdrawalRefund) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RefundWithdrawal", ctx, refund)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RefundWithdrawal indicates an expected call of RefundWithdrawal.
+func (mr *MockWithdrawOrderRepoInterfaceMockRecorder) RefundWithdrawal(ctx, refund interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefundWithdrawal", reflect.TypeOf((*MockWithdrawOrderRepoInterface)(nil).RefundWithdrawal), ctx, refund)
+}
+
+// ResolveWithdrawal mocks base method.
+func (m *MockWithdrawOrderRepoInterface) ResolveWithdrawal(ctx context.Context, order uint64, status string, reason string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResolveWithdrawal", ctx, order, status, reason)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResolveWithdrawal indicates an expected call of ResolveWithdrawal.
+func (mr *MockWithdrawOrderRepoInterfaceMockRecorder) ResolveWithdrawal(ctx, order, status, reason interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResolveWithdrawal", reflect.TypeOf((*MockWithdrawOrderRepoInterface)(nil).ResolveWithdrawal), ctx, order, status, reason)
+}
+
+// MockTransferRepoInterface is a mock of TransferRepoInterface interface.
+type MockTransferRepoInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockTransferRepoInterfaceMockRecorder
+}
+
+// MockTransferRepoInterfaceMockRecorder is the mock recorder for MockTransferRepoInterface.
+type MockTransferRepoInterfaceMockRecorder struct {
+	mock *MockTransferRepoInterface
+}
+
+// NewMockTransferRepoInterface creates a new mock instance.
+func NewMockTransferRepoInterface(ctrl *gomock.Controller) *MockTransferRepoInterface {
+	mock := &MockTransferRepoInterface{ctrl: ctrl}
+	mock.recorder = &MockTransferRepoInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTransferRepoInterface) EXPECT() *MockTransferRepoInterfaceMockRecorder {
+	return m.recorder
+}
+
+// CreateTransfer mocks base method.
+func (m *MockTransferRepoInterface) CreateTransfer(ctx context.Context, transfer *model.Transfer, limit model.TransferLimit) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateTransfer", ctx, transfer, limit)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateTransfer indicates an expected call of CreateTransfer.
+func (mr *MockTransferRepoInterfaceMockRecorder) CreateTransfer(ctx, transfer, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateTransfer", reflect.TypeOf((*MockTransferRepoInterface)(nil).CreateTransfer), ctx, transfer, limit)
+}
+
+// GetTransfers mocks base method.
+func (m *MockTransferRepoInterface) GetTransfers(ctx context.Context, userID int) ([]model.Transfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTransfers", ctx, userID)
+	ret0, _ := ret[0].([]model.Transfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTransfers indicates an expected call of GetTransfers.
+func (mr *MockTransferRepoInterfaceMockRecorder) GetTransfers(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTransfers", reflect.TypeOf((*MockTransferRepoInterface)(nil).GetTransfers), ctx, userID)
+}
+
+// MockOrderEventRepoInterface is a mock of OrderEventRepoInterface interface.
+type MockOrderEventRepoInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockOrderEventRepoInterfaceMockRecorder
+}
+
+// MockOrderEventRepoInterfaceMockRecorder is the mock recorder for MockOrderEventRepoInterface.
+type MockOrderEventRepoInterfaceMockRecorder struct {
+	mock *MockOrderEventRepoInterface
+}
+
+// NewMockOrderEventRepoInterface creates a new mock instance.
+func NewMockOrderEventRepoInterface(ctrl *gomock.Controller) *MockOrderEventRepoInterface {
+	mock := &MockOrderEventRepoInterface{ctrl: ctrl}
+	mock.recorder = &MockOrderEventRepoInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockOrderEventRepoInterface) EXPECT() *MockOrderEventRepoInterfaceMockRecorder {
+	return m.recorder
+}
+
+// GetOrderEvents mocks base method.
+func (m *MockOrderEventRepoInterface) GetOrderEvents(ctx context.Context, userID int, sinceID int64, afterID int64, limit int) ([]model.OrderEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrderEvents", ctx, userID, sinceID, afterID, limit)
+	ret0, _ := ret[0].([]model.OrderEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrderEvents indicates an expected call of GetOrderEvents.
+func (mr *MockOrderEventRepoInterfaceMockRecorder) GetOrderEvents(ctx, userID, sinceID, afterID, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrderEvents", reflect.TypeOf((*MockOrderEventRepoInterface)(nil).GetOrderEvents), ctx, userID, sinceID, afterID, limit)
+}
+
+// Listen mocks base method.
+func (m *MockOrderEventRepoInterface) Listen(ctx context.Context, handle func(model.OrderEvent)) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Listen", ctx, handle)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Listen indicates an expected call of Listen.
+func (mr *MockOrderEventRepoInterfaceMockRecorder) Listen(ctx, handle interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Listen", reflect.TypeOf((*MockOrderEventRepoInterface)(nil).Listen), ctx, handle)
+}
+
+// MockWebhookRepoInterface is a mock of WebhookRepoInterface interface.
+type MockWebhookRepoInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockWebhookRepoInterfaceMockRecorder
+}
+
+// MockWebhookRepoInterfaceMockRecorder is the mock recorder for MockWebhookRepoInterface.
+type MockWebhookRepoInterfaceMockRecorder struct {
+	mock *MockWebhookRepoInterface
+}
+
+// NewMockWebhookRepoInterface creates a new mock instance.
+func NewMockWebhookRepoInterface(ctrl *gomock.Controller) *MockWebhookRepoInterface {
+	mock := &MockWebhookRepoInterface{ctrl: ctrl}
+	mock.recorder = &MockWebhookRepoInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockWebhookRepoInterface) EXPECT() *MockWebhookRepoInterfaceMockRecorder {
+	return m.recorder
+}
+
+// ClaimDeliveries mocks base method.
+func (m *MockWebhookRepoInterface) ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]model.WebhookDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimDeliveries", ctx, now, lease, limit)
+	ret0, _ := ret[0].([]model.WebhookDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimDeliveries indicates an expected call of ClaimDeliveries.
+func (mr *MockWebhookRepoInterfaceMockRecorder) ClaimDeliveries(ctx, now, lease, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimDeliveries", reflect.TypeOf((*MockWebhookRepoInterface)(nil).ClaimDeliveries), ctx, now, lease, limit)
+}
+
+// CreateWebhook mocks base method.
+func (m *MockWebhookRepoInterface) CreateWebhook(ctx context.Context, webhook *model.Webhook) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateWebhook", ctx, webhook)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateWebhook indicates an expected call of CreateWebhook.
+func (mr *MockWebhookRepoInterfaceMockRecorder) CreateWebhook(ctx, webhook interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateWebhook", reflect.TypeOf((*MockWebhookRepoInterface)(nil).CreateWebhook), ctx, webhook)
+}
+
+// DeleteWebhook mocks base method.
+func (m *MockWebhookRepoInterface) DeleteWebhook(ctx context.Context, userID int, id int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteWebhook", ctx, userID, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteWebhook indicates an expected call of DeleteWebhook.
+func (mr *MockWebhookRepoInterfaceMockRecorder) DeleteWebhook(ctx, userID, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteWebhook", reflect.TypeOf((*MockWebhookRepoInterface)(nil).DeleteWebhook), ctx, userID, id)
+}
+
+// GetDeliveries mocks base method.
+func (m *MockWebhookRepoInterface) GetDeliveries(ctx context.Context, status string, limit int) ([]model.WebhookDelivery, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetWithdrawals", ctx, UserID)
-	ret0, _ := ret[0].(float32)
+	ret := m.ctrl.Call(m, "GetDeliveries", ctx, status, limit)
+	ret0, _ := ret[0].([]model.WebhookDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDeliveries indicates an expected call of GetDeliveries.
+func (mr *MockWebhookRepoInterfaceMockRecorder) GetDeliveries(ctx, status, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeliveries", reflect.TypeOf((*MockWebhookRepoInterface)(nil).GetDeliveries), ctx, status, limit)
+}
+
+// GetWebhooks mocks base method.
+func (m *MockWebhookRepoInterface) GetWebhooks(ctx context.Context, userID int) ([]model.Webhook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWebhooks", ctx, userID)
+	ret0, _ := ret[0].([]model.Webhook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWebhooks indicates an expected call of GetWebhooks.
+func (mr *MockWebhookRepoInterfaceMockRecorder) GetWebhooks(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWebhooks", reflect.TypeOf((*MockWebhookRepoInterface)(nil).GetWebhooks), ctx, userID)
+}
+
+// ReplayDelivery mocks base method.
+func (m *MockWebhookRepoInterface) ReplayDelivery(ctx context.Context, id int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplayDelivery", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReplayDelivery indicates an expected call of ReplayDelivery.
+func (mr *MockWebhookRepoInterfaceMockRecorder) ReplayDelivery(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplayDelivery", reflect.TypeOf((*MockWebhookRepoInterface)(nil).ReplayDelivery), ctx, id)
+}
+
+// UpdateDelivery mocks base method.
+func (m *MockWebhookRepoInterface) UpdateDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateDelivery", ctx, delivery)
+	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// GetWithdrawals indicates an expected call of GetWithdrawals.
-func (mr *MockWithdrawOrderRepoInterfaceMockRecorder) GetWithdrawals(ctx, UserID interface{}) *gomock.Call {
+// UpdateDelivery indicates an expected call of UpdateDelivery.
+func (mr *MockWebhookRepoInterfaceMockRecorder) UpdateDelivery(ctx, delivery interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWithdrawals", reflect.TypeOf((*MockWithdrawOrderRepoInterface)(nil).GetWithdrawals), ctx, UserID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateDelivery", reflect.TypeOf((*MockWebhookRepoInterface)(nil).UpdateDelivery), ctx, delivery)
 }
@@ -1,27 +1,31 @@
 package handler
 
 import (
+	"expvar"
+	"time"
+
 	"github.com/SversusN/gophermart/internal/controller/http/middlewares"
+	"github.com/SversusN/gophermart/internal/model"
 	"github.com/SversusN/gophermart/internal/service"
+	"github.com/SversusN/gophermart/pkg/keyring"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/go-chi/jwtauth/v5"
 	"go.uber.org/zap"
 )
 
-const (
-	signingKey = "JdjshJhdjnnd<SdjkaAkjd"
-)
-
 type Handler struct {
 	Service   *service.ServiceCollection
-	TokenAuth *jwtauth.JWTAuth
-	log       *zap.Logger
+	TokenAuth *keyring.KeyRing
+	// ShopCallbackToken - общий секрет магазина для подтверждения списаний
+	ShopCallbackToken string
+	// StreamHeartbeat - период комментариев-пульса в потоке событий заказов
+	StreamHeartbeat time.Duration
+	// Accrual - связь с системой начислений для проверки здоровья, nil - не проверяется
+	Accrual HealthChecker
+	log     *zap.Logger
 }
 
-func NewHandler(service *service.ServiceCollection, log *zap.Logger) *Handler {
-	tokenAuth := jwtauth.New("HS256", []byte(signingKey), nil)
-
+func NewHandler(service *service.ServiceCollection, tokenAuth *keyring.KeyRing, log *zap.Logger) *Handler {
 	return &Handler{
 		Service:   service,
 		TokenAuth: tokenAuth,
@@ -37,17 +41,67 @@ func (h *Handler) CreateRouter() *chi.Mux {
 	router.Group(func(router chi.Router) {
 		router.Post("/api/user/register", h.registration)
 		router.Post("/api/user/login", h.authentication)
+		router.Post("/api/user/token/refresh", h.refreshToken)
+		router.Get("/.well-known/jwks.json", h.publicKeys)
+		router.Get("/api/health", h.health)
 	})
 
 	router.Group(func(router chi.Router) {
-		router.Use(jwtauth.Verifier(h.TokenAuth))
-		router.Use(jwtauth.Authenticator(h.TokenAuth))
+		router.Use(middlewares.Verifier(h.TokenAuth))
+		router.Use(middlewares.Authenticator)
+		router.Use(h.checkRevocation)
+
+		router.Post("/api/user/logout", h.logout)
+		router.Post("/api/user/password", h.changePassword)
+		router.Delete("/api/user", h.deleteUser)
 
 		router.Post("/api/user/orders", h.loadOrders)
+		router.Post("/api/user/orders/batch", h.loadOrdersBatch)
 		router.Get("/api/user/orders", h.getUploadedOrders)
-		router.Post("/api/user/balance/withdraw", h.deductionOfPoints)
+		router.Get("/api/user/orders/stream", h.streamOrders)
+		router.Get("/api/user/orders/{number}", h.getOrder)
+		router.With(h.idempotency).Post("/api/user/balance/withdraw", h.deductionOfPoints)
 		router.Get("/api/user/withdrawals", h.getWithdrawalOfPoints)
+		router.Post("/api/user/withdrawals/{order}/cancel", h.cancelWithdrawal)
 		router.Get("/api/user/balance", h.getBalance)
+		router.With(h.idempotency).Post("/api/user/balance/transfer", h.transferPoints)
+		router.Get("/api/user/transfers", h.getTransfers)
+		router.Get("/api/user/transactions", h.getTransactions)
+		router.Post("/api/user/webhooks", h.createWebhook)
+		router.Get("/api/user/webhooks", h.getWebhooks)
+		router.Delete("/api/user/webhooks/{id}", h.deleteWebhook)
+	})
+
+	router.Route("/api/admin", func(router chi.Router) {
+		router.Use(middlewares.Verifier(h.TokenAuth))
+		router.Use(middlewares.Authenticator)
+		router.Use(h.checkRevocation)
+		router.Use(middlewares.RequireRole(model.RoleAdmin))
+
+		router.Get("/users", h.adminFindUser)
+		router.Get("/users/{id}", h.adminGetUser)
+		router.Get("/users/{id}/orders", h.adminGetOrders)
+		router.Get("/users/{id}/withdrawals", h.adminGetWithdrawals)
+		router.Post("/users/{id}/balance/adjustments", h.adminAdjustBalance)
+		router.Post("/orders/{number}/requeue", h.adminRequeueOrder)
+		router.Post("/withdrawals/{order}/refund", h.adminRefundWithdrawal)
+		router.Get("/ledger/reconciliation", h.adminReconcile)
+		router.Handle("/metrics", expvar.Handler())
+		router.Get("/lockouts", h.adminGetLockouts)
+		router.Delete("/lockouts/ip/{ip}", h.adminUnlockIP)
+		router.Delete("/lockouts/{login}", h.adminUnlockLogin)
+		router.Post("/webhooks", h.adminCreateWebhook)
+		router.Get("/webhooks", h.adminGetWebhooks)
+		router.Delete("/webhooks/{id}", h.adminDeleteWebhook)
+		router.Get("/webhooks/deliveries/dead", h.adminGetDeadLetters)
+		router.Post("/webhooks/deliveries/{id}/replay", h.adminReplayDelivery)
+	})
+
+	router.Route("/api/shop", func(router chi.Router) {
+		router.Use(middlewares.CallbackToken(h.ShopCallbackToken))
+
+		router.Post("/withdrawals/{order}/confirm", h.shopConfirmWithdrawal)
+		router.Post("/withdrawals/{order}/reject", h.shopRejectWithdrawal)
 	})
 
 	return router
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -14,14 +15,85 @@ import (
 	errs "github.com/SversusN/gophermart/pkg/errors"
 )
 
-func (h *Handler) writeToken(w http.ResponseWriter, user *model.User, nameFunc string) {
-	token, err := h.Service.Auth.GenerateToken(user, h.TokenAuth)
+func (h *Handler) writeToken(w http.ResponseWriter, r *http.Request, user *model.User, nameFunc string) {
+	tokens, err := h.Service.Token.IssueTokens(r.Context(), user, h.TokenAuth)
 	if err != nil {
 		h.log.Error("writeToken: %s - token generate error")
 		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("Authorization", "Bearer "+token)
+	h.writeTokenPair(w, tokens)
+}
+
+func (h *Handler) writeTokenPair(w http.ResponseWriter, tokens *model.TokenPair) {
+	output, err := json.Marshal(tokens)
+	if err != nil {
+		h.log.Error("Handler.writeTokenPair: json marshal error")
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Authorization", "Bearer "+tokens.AccessToken)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(output)
+}
+
+// refreshToken POST /api/user/token/refresh - обмен refresh токена на новую пару
+func (h *Handler) refreshToken(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.RefreshToken == "" {
+		http.Error(w, errs.BadData, http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := h.Service.Token.RefreshTokens(r.Context(), request.RefreshToken, h.TokenAuth)
+	if errors.As(err, &errs.InvalidTokenError{}) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		h.log.Error("Handler.refreshToken: RefreshTokens service error")
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+		return
+	}
+	h.writeTokenPair(w, tokens)
+}
+
+// logout POST /api/user/logout - отзыв всех токенов текущей сессии
+func (h *Handler) logout(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := h.getSessionIDFromToken(w, r, "handler.logout")
+	if err != nil {
+		return
+	}
+	if err = h.Service.Token.Logout(r.Context(), sessionID); err != nil {
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// checkRevocation не пускает access токены отозванных сессий
+func (h *Handler) checkRevocation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, claims, _ := jwtauth.FromContext(r.Context())
+		sessionID, _ := claims["sid"].(string)
+		if sessionID == "" {
+			http.Error(w, errs.InvalidTokenError{}.Error(), http.StatusUnauthorized)
+			return
+		}
+		revoked, err := h.Service.Token.IsSessionRevoked(r.Context(), sessionID)
+		if err != nil {
+			h.log.Error("Handler.checkRevocation: IsSessionRevoked service error")
+			http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+			return
+		}
+		if revoked {
+			http.Error(w, errs.InvalidTokenError{}.Error(), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 func (h *Handler) readUserData(w http.ResponseWriter, r *http.Request, user *model.User, nameFunc string) error {
@@ -44,11 +116,6 @@ func (h *Handler) readUserData(w http.ResponseWriter, r *http.Request, user *mod
 		http.Error(w, errs.BadData, http.StatusBadRequest)
 		return err
 	}
-
-	if user.Login == "" || user.Password == "" {
-		http.Error(w, "empty login or password", http.StatusBadRequest)
-		return err
-	}
 	return nil
 }
 
@@ -70,3 +137,30 @@ func (h *Handler) getUserIDFromToken(w http.ResponseWriter, r *http.Request, nam
 
 	return userID, nil
 }
+
+// publicKeys GET /.well-known/jwks.json - публичные ключи для проверки токенов другими сервисами
+func (h *Handler) publicKeys(w http.ResponseWriter, r *http.Request) {
+	output, err := json.Marshal(h.TokenAuth.PublicKeys())
+	if err != nil {
+		h.log.Error("Handler.publicKeys: json marshal error")
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	w.Write(output)
+}
+
+func (h *Handler) getSessionIDFromToken(w http.ResponseWriter, r *http.Request, nameFunc string) (string, error) {
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		h.log.Error("Handler.getSessionIDFromToken: %s - jwt claims error")
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+		return "", err
+	}
+	sessionID, ok := claims["sid"].(string)
+	if !ok || sessionID == "" {
+		http.Error(w, errs.InvalidTokenError{}.Error(), http.StatusUnauthorized)
+		return "", errs.InvalidTokenError{}
+	}
+	return sessionID, nil
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SversusN/gophermart/internal/model"
+	errs "github.com/SversusN/gophermart/pkg/errors"
+)
+
+// getTransactions GET /api/user/transactions - история всех операций с баллами.
+// Параметры: limit, cursor, from и to (дата или RFC 3339; дата в to включается целиком),
+// type - вид операции, можно перечислить через запятую или повторить.
+func (h *Handler) getTransactions(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromToken(w, r, "handler.getTransactions")
+	if err != nil {
+		return
+	}
+
+	query := r.URL.Query()
+	filter, violations := transactionFilter(query)
+	filter.UserID = userID
+	if len(violations) > 0 {
+		h.writeValidationError(w, errs.ValidationError{Violations: violations})
+		return
+	}
+
+	page, err := h.Service.Ledger.GetTransactions(r.Context(), filter, query.Get("cursor"))
+	var validationErr errs.ValidationError
+	if errors.As(err, &validationErr) {
+		h.writeValidationError(w, validationErr)
+		return
+	}
+	if err != nil {
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, page, "getTransactions")
+}
+
+func transactionFilter(query url.Values) (model.TransactionFilter, []errs.Violation) {
+	var filter model.TransactionFilter
+	var violations []errs.Violation
+	var err error
+
+	if limit := query.Get("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit <= 0 {
+			violations = append(violations, errs.Violation{Field: "limit", Rule: "range", Message: "limit must be a positive number"})
+		}
+	}
+	filter.From, filter.To, violations = dateRange(query, violations)
+	filter.Types = listParam(query, "type")
+	return filter, violations
+}
+
+// dateRange разбирает параметры from и to; дата в to включается целиком
+func dateRange(query url.Values, violations []errs.Violation) (from, to time.Time, _ []errs.Violation) {
+	var err error
+	if value := query.Get("from"); value != "" {
+		if from, _, err = parseDateBound(value); err != nil {
+			violations = append(violations, errs.Violation{Field: "from", Rule: "date", Message: "from must be a date or an RFC 3339 timestamp"})
+		}
+	}
+	if value := query.Get("to"); value != "" {
+		var dateOnly bool
+		if to, dateOnly, err = parseDateBound(value); err != nil {
+			violations = append(violations, errs.Violation{Field: "to", Rule: "date", Message: "to must be a date or an RFC 3339 timestamp"})
+		} else if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+	}
+	return from, to, violations
+}
+
+// listParam собирает значения параметра, перечисленные через запятую или повторенные
+func listParam(query url.Values, name string) []string {
+	var values []string
+	for _, value := range query[name] {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+	}
+	return values
+}
+
+// parseDateBound разбирает дату (в часовом поясе сервера) или метку времени RFC 3339
+func parseDateBound(value string) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/SversusN/gophermart/internal/model"
+	errs "github.com/SversusN/gophermart/pkg/errors"
+)
+
+// transferPoints POST /api/user/balance/transfer - перевод баллов другому пользователю по логину
+func (h *Handler) transferPoints(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromToken(w, r, "handler.transferPoints")
+	if err != nil {
+		return
+	}
+	var input struct {
+		Recipient string      `json:"recipient"`
+		Sum       model.Money `json:"sum"`
+	}
+	if err = json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, errs.BadData, http.StatusBadRequest)
+		return
+	}
+
+	transfer := &model.Transfer{
+		SenderID:       userID,
+		RecipientLogin: h.Service.Auth.NormalizeLogin(input.Recipient),
+		Sum:            input.Sum,
+	}
+	err = h.Service.Transfer.Transfer(r.Context(), transfer)
+
+	var validationErr errs.ValidationError
+	if errors.As(err, &validationErr) {
+		h.writeValidationError(w, validationErr)
+		return
+	}
+	switch err.(type) {
+	case nil:
+		h.writeJSON(w, http.StatusOK, transfer, "transferPoints")
+	case errs.UserNotFoundError:
+		http.Error(w, "recipient not found", http.StatusNotFound)
+	case errs.SelfTransferError:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errs.ShowMeTheMoney:
+		http.Error(w, err.Error(), http.StatusPaymentRequired)
+	case errs.TransferLimitExceededError:
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+	}
+}
+
+// getTransfers GET /api/user/transfers - входящие и исходящие переводы пользователя
+func (h *Handler) getTransfers(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromToken(w, r, "handler.getTransfers")
+	if err != nil {
+		return
+	}
+
+	transfers, err := h.Service.Transfer.GetTransfers(r.Context(), userID)
+	if err != nil {
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+		return
+	}
+	if len(transfers) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, transfers, "getTransfers")
+}
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/SversusN/gophermart/internal/model"
+	errs "github.com/SversusN/gophermart/pkg/errors"
+)
+
+// systemWebhooks - владелец вебхуков, которые получают события всех пользователей
+const systemWebhooks = 0
+
+// createWebhook POST /api/user/webhooks - подписка на события своего аккаунта
+func (h *Handler) createWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromToken(w, r, "handler.createWebhook")
+	if err != nil {
+		return
+	}
+	h.registerWebhook(w, r, userID)
+}
+
+// getWebhooks GET /api/user/webhooks
+func (h *Handler) getWebhooks(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromToken(w, r, "handler.getWebhooks")
+	if err != nil {
+		return
+	}
+	h.listWebhooks(w, r, userID)
+}
+
+// deleteWebhook DELETE /api/user/webhooks/{id}
+func (h *Handler) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromToken(w, r, "handler.deleteWebhook")
+	if err != nil {
+		return
+	}
+	h.removeWebhook(w, r, userID)
+}
+
+// adminCreateWebhook POST /api/admin/webhooks - подписка на события всех пользователей
+func (h *Handler) adminCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	h.registerWebhook(w, r, systemWebhooks)
+}
+
+// adminGetWebhooks GET /api/admin/webhooks
+func (h *Handler) adminGetWebhooks(w http.ResponseWriter, r *http.Request) {
+	h.listWebhooks(w, r, systemWebhooks)
+}
+
+// adminDeleteWebhook DELETE /api/admin/webhooks/{id}
+func (h *Handler) adminDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	h.removeWebhook(w, r, systemWebhooks)
+}
+
+// adminGetDeadLetters GET /api/admin/webhooks/deliveries/dead - события, которые не удалось доставить
+func (h *Handler) adminGetDeadLetters(w http.ResponseWriter, r *http.Request) {
+	deliveries, err := h.Service.Webhook.GetDeadLetters(r.Context())
+	if err != nil {
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+		return
+	}
+	if len(deliveries) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, deliveries, "adminGetDeadLetters")
+}
+
+// adminReplayDelivery POST /api/admin/webhooks/deliveries/{id}/replay - повторная отправка события
+func (h *Handler) adminReplayDelivery(w http.ResponseWriter, r *http.Request) {
+	adminID, err := h.getUserIDFromToken(w, r, "adminReplayDelivery")
+	if err != nil {
+		return
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, errs.BadData, http.StatusBadRequest)
+		return
+	}
+
+	err = h.Service.Webhook.ReplayDelivery(r.Context(), id, adminID)
+	switch err.(type) {
+	case nil:
+		w.WriteHeader(http.StatusAccepted)
+	case errs.WebhookDeliveryNotFoundError:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+	}
+}
+
+func (h *Handler) registerWebhook(w http.ResponseWriter, r *http.Request, ownerID int) {
+	var input struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, errs.BadData, http.StatusBadRequest)
+		return
+	}
+
+	hook := &model.Webhook{UserID: ownerID, URL: input.URL, Events: input.Events}
+	err := h.Service.Webhook.Register(r.Context(), hook)
+	var validationErr errs.ValidationError
+	if errors.As(err, &validationErr) {
+		h.writeValidationError(w, validationErr)
+		return
+	}
+	if err != nil {
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, http.StatusCreated, hook, "registerWebhook")
+}
+
+func (h *Handler) listWebhooks(w http.ResponseWriter, r *http.Request, ownerID int) {
+	hooks, err := h.Service.Webhook.GetWebhooks(r.Context(), ownerID)
+	if err != nil {
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+		return
+	}
+	if len(hooks) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, hooks, "listWebhooks")
+}
+
+func (h *Handler) removeWebhook(w http.ResponseWriter, r *http.Request, ownerID int) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, errs.BadData, http.StatusBadRequest)
+		return
+	}
+
+	err = h.Service.Webhook.DeleteWebhook(r.Context(), ownerID, id)
+	switch err.(type) {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errs.WebhookNotFoundError:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, errs.InternalServerError, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,53 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+
+	"github.com/SversusN/gophermart/pkg/keyring"
+)
+
+// Verifier is jwtauth.Verifier on top of a key ring: the token is looked up
+// in the Authorization header or the "jwt" cookie and verified by its "kid".
+// Tokens without expiration are rejected.
+func Verifier(ring *keyring.KeyRing) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokenString := jwtauth.TokenFromHeader(r)
+			if tokenString == "" {
+				tokenString = jwtauth.TokenFromCookie(r)
+			}
+
+			var token jwt.Token
+			var err error
+			if tokenString == "" {
+				err = jwtauth.ErrNoTokenFound
+			} else if token, err = ring.Decode(tokenString); err != nil {
+				err = jwtauth.ErrorReason(err)
+			} else if err = jwt.Validate(token, jwt.WithRequiredClaim("exp")); err != nil {
+				err = jwtauth.ErrorReason(err)
+			}
+
+			ctx := jwtauth.NewContext(r.Context(), token, err)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Authenticator rejects requests the Verifier did not accept.
+func Authenticator(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, _, err := jwtauth.FromContext(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if token == nil {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
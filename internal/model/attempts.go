@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// LoginAttempts - счетчик неудачных входов по логину или IP
+type LoginAttempts struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// AttemptLimit - когда счетчик неудач сбрасывается и когда вход блокируется
+type AttemptLimit struct {
+	// счетчик сбрасывается, если неудач не было дольше Window
+	Window time.Duration
+	// начиная с MaxFailures неудач подряд вход блокируется на Lockout; 0 - без блокировки
+	MaxFailures int
+	Lockout     time.Duration
+}
+
+// Lockout - запись аудита блокировки, по ней поддержка снимает блокировку
+type Lockout struct {
+	ID          int       `json:"id"`
+	Login       string    `json:"login,omitempty"`
+	IP          string    `json:"ip,omitempty"`
+	Failures    int       `json:"failures"`
+	LockedUntil time.Time `json:"locked_until"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -1,7 +1,10 @@
 package model
 
 type Balance struct {
-	Current   float32 `json:"current"`
-	Withdrawn float32 `json:"withdrawn"`
-	UserID    int     `json:"-"`
+	Current   Money `json:"current"`
+	Withdrawn Money `json:"withdrawn"`
+	Held      Money `json:"held,omitempty"`
+	// ExpiringSoon - баллы, срок которых истекает в ближайшее время
+	ExpiringSoon []ExpiringPoints `json:"expiring_soon,omitempty"`
+	UserID       int              `json:"-"`
 }
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// IdempotencyRecord - сохраненный ответ на запрос с заголовком Idempotency-Key
+type IdempotencyRecord struct {
+	UserID      int
+	Key         string
+	RequestHash string
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	ExpiresAt   time.Time
+}
+
+// Completed - ответ уже записан и его можно повторить
+func (r *IdempotencyRecord) Completed() bool {
+	return r.StatusCode != 0
+}
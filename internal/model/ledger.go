@@ -0,0 +1,72 @@
+package model
+
+import "time"
+
+// Виды операций в журнале баллов
+const (
+	LedgerAccrual    = "accrual"
+	LedgerWithdrawal = "withdrawal"
+	LedgerRefund     = "refund"
+	LedgerAdjustment = "adjustment"
+	LedgerHold       = "hold"
+	LedgerRelease    = "release"
+	LedgerExpiry     = "expiry"
+	LedgerTransfer   = "transfer"
+)
+
+// PointLot - партия баллов, поступившая одной операцией; сгорает целиком по истечении срока
+type PointLot struct {
+	ID        int64
+	UserID    int
+	Remaining Money
+	EarnedAt  time.Time
+}
+
+// ExpiringPoints - баллы, которые сгорят в ближайшее время
+type ExpiringPoints struct {
+	Amount    Money     `json:"amount"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// BalanceDrift - расхождение журнала с колонками users.current/users.withdrawal или с остатками партий
+type BalanceDrift struct {
+	UserID          int   `json:"user_id"`
+	LedgerCurrent   Money `json:"ledger_current"`
+	LegacyCurrent   Money `json:"legacy_current"`
+	LedgerWithdrawn Money `json:"ledger_withdrawn"`
+	LegacyWithdrawn Money `json:"legacy_withdrawn"`
+	LotsRemaining   Money `json:"lots_remaining"`
+}
+
+// LedgerKinds - все виды операций, которые видны в истории пользователя
+var LedgerKinds = []string{
+	LedgerAccrual, LedgerWithdrawal, LedgerRefund, LedgerAdjustment,
+	LedgerHold, LedgerRelease, LedgerExpiry, LedgerTransfer,
+}
+
+// Transaction - операция в истории пользователя: изменение текущего баланса и баланс после нее
+type Transaction struct {
+	ID        int64     `json:"id"`
+	Type      string    `json:"type"`
+	Order     uint64    `json:"order,string,omitempty"`
+	Amount    Money     `json:"amount"`
+	Balance   Money     `json:"balance"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TransactionFilter - выборка истории: операции старше BeforeID, от From включительно до To исключительно.
+// Пустые поля не ограничивают выборку.
+type TransactionFilter struct {
+	UserID   int
+	BeforeID int64
+	From     time.Time
+	To       time.Time
+	Types    []string
+	Limit    int
+}
+
+// TransactionPage - страница истории; NextCursor пуст на последней странице
+type TransactionPage struct {
+	Transactions []Transaction `json:"transactions"`
+	NextCursor   string        `json:"next_cursor,omitempty"`
+}
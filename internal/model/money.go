@@ -0,0 +1,132 @@
+package model
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Money - сумма баллов в сотых долях. Целочисленная арифметика не копит ошибок
+// округления, а в JSON сумма по-прежнему пишется обычным числом: 500, 729.98.
+type Money int64
+
+const (
+	Cent  Money = 1
+	Point Money = 100
+)
+
+var ErrInvalidMoney = errors.New("invalid money amount")
+
+// ParseMoney разбирает десятичную запись без перехода через float.
+// Знаки после сотых округляются половиной от нуля.
+func ParseMoney(s string) (Money, error) {
+	if s == "" || strings.ContainsAny(s, "/ ") {
+		return 0, ErrInvalidMoney
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, ErrInvalidMoney
+	}
+	r.Mul(r, big.NewRat(int64(Point), 1))
+
+	quo, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if rem.Abs(rem).Lsh(rem, 1).Cmp(r.Denom()) >= 0 {
+		quo.Add(quo, big.NewInt(int64(r.Sign())))
+	}
+	if !quo.IsInt64() {
+		return 0, ErrInvalidMoney
+	}
+	return Money(quo.Int64()), nil
+}
+
+func MustParseMoney(s string) Money {
+	m, err := ParseMoney(s)
+	if err != nil {
+		panic(fmt.Sprintf("model: bad money %q: %s", s, err))
+	}
+	return m
+}
+
+// MoneyFromFloat - для значений, пришедших из колонок FLOAT/REAL
+func MoneyFromFloat(f float64) Money {
+	return Money(math.Round(f * float64(Point)))
+}
+
+func (m Money) Float64() float64 {
+	return float64(m) / float64(Point)
+}
+
+// String пишет сумму без лишних нулей: 500, 500.5, 729.98
+func (m Money) String() string {
+	sign := ""
+	abs := uint64(m)
+	if m < 0 {
+		sign, abs = "-", -abs
+	}
+	units, cents := abs/uint64(Point), abs%uint64(Point)
+	switch {
+	case cents == 0:
+		return sign + strconv.FormatUint(units, 10)
+	case cents%10 == 0:
+		return fmt.Sprintf("%s%d.%d", sign, units, cents/10)
+	default:
+		return fmt.Sprintf("%s%d.%02d", sign, units, cents)
+	}
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		return ErrInvalidMoney
+	}
+	parsed, err := ParseMoney(string(data))
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// UnmarshalText разбирает сумму из конфигурации
+func (m *Money) UnmarshalText(text []byte) error {
+	parsed, err := ParseMoney(string(text))
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Scan читает NUMERIC как текст, поэтому значение не проходит через float
+func (m *Money) Scan(src interface{}) error {
+	var err error
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+	case int64:
+		*m = Money(v) * Point
+	case float64:
+		*m = MoneyFromFloat(v)
+	case []byte:
+		*m, err = ParseMoney(string(v))
+	case string:
+		*m, err = ParseMoney(v)
+	default:
+		err = fmt.Errorf("model: cannot scan %T into Money", src)
+	}
+	return err
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
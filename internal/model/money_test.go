@@ -0,0 +1,143 @@
+package model
+
+import (
+	"encoding/json"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+		err  bool
+	}{
+		{in: "500", want: 500 * Point},
+		{in: "729.98", want: 72998},
+		{in: "0.1", want: 10},
+		{in: "-10.5", want: -1050},
+		{in: "1e2", want: 100 * Point},
+		{in: "0.005", want: 1},
+		{in: "-0.005", want: -1},
+		{in: "0.0049", want: 0},
+		{in: "", err: true},
+		{in: "abc", err: true},
+		{in: "1/3", err: true},
+		{in: "1e30", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseMoney(tt.in)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	tests := []struct {
+		money Money
+		wire  string
+	}{
+		{money: 0, wire: "0"},
+		{money: 500 * Point, wire: "500"},
+		{money: 50050, wire: "500.5"},
+		{money: 72998, wire: "729.98"},
+		{money: 5, wire: "0.05"},
+		{money: -1050, wire: "-10.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.wire, func(t *testing.T) {
+			out, err := json.Marshal(tt.money)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wire, string(out))
+
+			var back Money
+			require.NoError(t, json.Unmarshal(out, &back))
+			assert.Equal(t, tt.money, back)
+		})
+	}
+
+	var m Money
+	assert.Error(t, json.Unmarshal([]byte(`"500"`), &m))
+}
+
+// Сумма тысяч операций в Money совпадает с точной суммой десятичных записей,
+// а float32 на тех же данных ошибается.
+func TestMoneySumIsExact(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	for round := 0; round < 20; round++ {
+		var sum Money
+		var sum32 float32
+		exact := new(big.Rat)
+		for i := 0; i < 5000; i++ {
+			amount := Money(rnd.Int63n(1_000_000)) - 300_000
+			wire := amount.String()
+
+			parsed, err := ParseMoney(wire)
+			require.NoError(t, err)
+			require.Equal(t, amount, parsed, "round trip of %s", wire)
+
+			sum += parsed
+			sum32 += float32(parsed.Float64())
+			r, _ := new(big.Rat).SetString(wire)
+			exact.Add(exact, r)
+		}
+		assert.Equal(t, exact.FloatString(2), new(big.Rat).SetFrac64(int64(sum), int64(Point)).FloatString(2))
+		if round == 0 {
+			assert.NotEqual(t, sum, MoneyFromFloat(float64(sum32)), "float32 accumulation is expected to drift")
+		}
+	}
+}
+
+// Пополнения и списания в произвольном порядке возвращают баланс ровно к нулю
+func TestMoneyCreditDebitBalance(t *testing.T) {
+	rnd := rand.New(rand.NewSource(7))
+	amounts := make([]Money, 10000)
+	for i := range amounts {
+		amounts[i] = MustParseMoney(MoneyFromFloat(rnd.Float64() * 1000).String())
+	}
+	var balance Money
+	for _, a := range amounts {
+		balance += a
+	}
+	rnd.Shuffle(len(amounts), func(i, j int) { amounts[i], amounts[j] = amounts[j], amounts[i] })
+	for _, a := range amounts {
+		balance -= a
+	}
+	assert.Equal(t, Money(0), balance)
+}
+
+func TestMoneyScan(t *testing.T) {
+	var m Money
+	require.NoError(t, m.Scan([]byte("729.98")))
+	assert.Equal(t, Money(72998), m)
+	require.NoError(t, m.Scan("12.3"))
+	assert.Equal(t, Money(1230), m)
+	require.NoError(t, m.Scan(int64(7)))
+	assert.Equal(t, 7*Point, m)
+	require.NoError(t, m.Scan(nil))
+	assert.Equal(t, Money(0), m)
+	assert.Error(t, m.Scan(true))
+
+	v, err := Money(-1050).Value()
+	require.NoError(t, err)
+	assert.Equal(t, "-10.5", v)
+}
+
+func TestMoneyUnmarshalText(t *testing.T) {
+	var m Money
+	require.NoError(t, m.UnmarshalText([]byte("10000")))
+	assert.Equal(t, 10000*Point, m)
+	require.NoError(t, m.UnmarshalText([]byte("0.5")))
+	assert.Equal(t, 50*Cent, m)
+	assert.Error(t, m.UnmarshalText([]byte("ten")))
+}
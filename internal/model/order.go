@@ -6,13 +6,97 @@ type AccrualOrder struct {
 	UserID     int       `json:"user_id"`
 	Number     uint64    `json:"number,string"`
 	Status     Status    `json:"status"`
-	Accrual    float32   `json:"accrual,omitempty"`
+	Accrual    Money     `json:"accrual,omitempty"`
 	UploadedAt time.Time `json:"uploaded_at"`
 }
 
+// OrderStatusChange - переход заказа в статус; Accrual заполнен для PROCESSED
+type OrderStatusChange struct {
+	Status    Status    `json:"status"`
+	Accrual   Money     `json:"accrual,omitempty"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// OrderDetail - заказ с историей статусов от первого к последнему
+type OrderDetail struct {
+	AccrualOrder
+	History []OrderStatusChange `json:"history"`
+}
+
+// OrderEvent - смена статуса заказа для подписчиков; ID совпадает с записью истории и растёт монотонно
+type OrderEvent struct {
+	ID        int64     `json:"id"`
+	UserID    int       `json:"user_id"`
+	Number    uint64    `json:"number,string"`
+	Status    Status    `json:"status"`
+	Accrual   Money     `json:"accrual,omitempty"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// Результат загрузки номера заказа в пакете
+const (
+	OrderAccepted        = "accepted"
+	OrderAlreadyUploaded = "already_uploaded"
+	OrderOwnedByAnother  = "owned_by_another_user"
+	OrderInvalid         = "invalid"
+)
+
+// OrderUploadResult - что стало с номером из пакетной загрузки; Number - номер в том виде, в каком пришел
+type OrderUploadResult struct {
+	Number string `json:"number"`
+	Result string `json:"result"`
+}
+
+// OrderFilter - выборка заказов пользователя, от старых к новым или, с Descending, от новых к старым:
+// после позиции After, загруженные от From включительно до To исключительно.
+// Пустые поля и нулевой Limit не ограничивают выборку.
+type OrderFilter struct {
+	UserID     int
+	Statuses   []Status
+	From       time.Time
+	To         time.Time
+	Descending bool
+	After      *OrderCursor
+	Limit      int
+}
+
+// OrderCursor - последний заказ предыдущей страницы и порядок, в котором она выдана
+type OrderCursor struct {
+	UploadedAt time.Time `json:"uploaded_at"`
+	Number     uint64    `json:"number"`
+	Descending bool      `json:"desc,omitempty"`
+}
+
+// OrderPage - страница заказов; NextCursor пуст на последней странице
+type OrderPage struct {
+	Orders     []AccrualOrder
+	NextCursor string
+}
+
+// Статусы списания: PENDING -> CONFIRMED/REJECTED, CONFIRMED -> REFUNDED
+const (
+	WithdrawalPending   = "PENDING"
+	WithdrawalConfirmed = "CONFIRMED"
+	WithdrawalRejected  = "REJECTED"
+	WithdrawalRefunded  = "REFUNDED"
+)
+
 type WithdrawOrder struct {
-	UserID      int       `json:"-"`
-	Order       uint64    `json:"order,string"`
-	Sum         float32   `json:"sum,omitempty"`
-	ProcessedAt time.Time `json:"processed_at"`
+	UserID        int        `json:"-"`
+	Order         uint64     `json:"order,string"`
+	Sum           Money      `json:"sum,omitempty"`
+	Status        string     `json:"status,omitempty"`
+	ProcessedAt   time.Time  `json:"processed_at"`
+	HoldExpiresAt *time.Time `json:"hold_expires_at,omitempty"`
+	RefundedAt    *time.Time `json:"refunded_at,omitempty"`
+}
+
+// WithdrawalRefund - отмена списания с возвратом баллов.
+// UserID пуст, когда отмену делает поддержка; NotBefore пуст, когда окно отмены не проверяется.
+type WithdrawalRefund struct {
+	Order      uint64
+	UserID     int
+	RefundedBy int
+	Reason     string
+	NotBefore  time.Time
 }
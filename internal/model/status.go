@@ -36,3 +36,16 @@ func (s Status) MarshalJSON() ([]byte, error) {
 	json, err := json.Marshal(s.String())
 	return json, err
 }
+
+func (s *Status) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	status, err := GetStatus(value)
+	if err != nil {
+		return err
+	}
+	*s = status
+	return nil
+}
@@ -0,0 +1,15 @@
+package model
+
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// Session - семейство refresh токенов, выданных по одному входу
+type Session struct {
+	ID     string
+	UserID int
+	Role   string
+}
@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// Направление перевода с точки зрения пользователя, который смотрит историю
+const (
+	TransferOutgoing = "outgoing"
+	TransferIncoming = "incoming"
+)
+
+// Transfer - перевод баллов другому пользователю
+type Transfer struct {
+	ID             int64     `json:"id"`
+	SenderID       int       `json:"-"`
+	RecipientID    int       `json:"-"`
+	RecipientLogin string    `json:"-"`
+	Direction      string    `json:"direction"`
+	Counterparty   string    `json:"counterparty"`
+	Sum            Money     `json:"sum"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// TransferLimit - сколько пользователь может перевести начиная с Since; нулевой Amount - без ограничения
+type TransferLimit struct {
+	Amount Money
+	Since  time.Time
+}
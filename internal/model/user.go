@@ -1,7 +1,35 @@
 package model
 
+import "time"
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
 	ID       int    `json:"id,omitempty" db:"user_id"`
 	Login    string `json:"login,omitempty" db:"login"`
 	Password string `json:"password,omitempty" db:"password"`
+	Role     string `json:"-" db:"role"`
+}
+
+// UserInfo - карточка пользователя для поддержки
+type UserInfo struct {
+	ID        int        `json:"id"`
+	Login     string     `json:"login,omitempty"`
+	Role      string     `json:"role"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	Current   Money      `json:"current"`
+	Withdrawn Money      `json:"withdrawn"`
+}
+
+// BalanceAdjustment - ручная корректировка баланса, причина обязательна
+type BalanceAdjustment struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	AdminID   int       `json:"admin_id"`
+	Amount    Money     `json:"amount"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
 }
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// События, на которые подписываются вебхуки
+const (
+	WebhookOrderProcessed    = "order.processed"
+	WebhookWithdrawalCreated = "withdrawal.created"
+)
+
+// WebhookEvents - все события, которые можно указать при регистрации
+var WebhookEvents = []string{WebhookOrderProcessed, WebhookWithdrawalCreated}
+
+// Состояния доставки вебхука
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// Webhook - адрес, на который отправляются события. Нулевой UserID - подписка на события всех пользователей.
+// Secret отдаётся только при регистрации
+type Webhook struct {
+	ID        int64     `json:"id"`
+	UserID    int       `json:"-"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery - отправка одного события одному вебхуку
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	WebhookID      int64           `json:"webhook_id"`
+	URL            string          `json:"url"`
+	Secret         string          `json:"-"`
+	EventID        int64           `json:"event_id"`
+	EventType      string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	EventCreatedAt time.Time       `json:"event_created_at"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastError      string          `json:"last_error,omitempty"`
+	LastStatusCode int             `json:"last_status_code,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
+
+// OrderProcessedEvent - данные события order.processed
+type OrderProcessedEvent struct {
+	UserID      int       `json:"user_id"`
+	Number      uint64    `json:"number,string"`
+	Accrual     Money     `json:"accrual"`
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+// WithdrawalCreatedEvent - данные события withdrawal.created
+type WithdrawalCreatedEvent struct {
+	UserID      int       `json:"user_id"`
+	Order       uint64    `json:"order,string"`
+	Sum         Money     `json:"sum"`
+	Status      string    `json:"status"`
+	ProcessedAt time.Time `json:"processed_at"`
+}
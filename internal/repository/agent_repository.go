@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -11,8 +12,9 @@ import (
 )
 
 type AgentRepoInterface interface {
-	GetOrders(ctx context.Context, limit int) ([]model.Order, error)
-	UpdateOrderAccruals(ctx context.Context, orderAccruals []model.OrderAccrual) error
+	GetOrders(ctx context.Context, owner string, limit int, lease time.Duration) ([]model.Order, error)
+	UpdateOrderAccruals(ctx context.Context, owner string, orderAccruals []model.OrderAccrual) error
+	RetryOrder(ctx context.Context, owner string, retry model.OrderRetry) error
 }
 
 type AgentRepository struct {
@@ -0,0 +1,73 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/SversusN/gophermart/internal/model"
+)
+
+const sweepEvery = 1024
+
+// LoginAttempts хранит счетчики неудачных входов в памяти процесса.
+// При нескольких репликах каждая считает попытки самостоятельно.
+type LoginAttempts struct {
+	mu       sync.Mutex
+	attempts map[string]model.LoginAttempts
+	writes   int
+}
+
+func NewLoginAttempts() *LoginAttempts {
+	return &LoginAttempts{
+		attempts: make(map[string]model.LoginAttempts),
+	}
+}
+
+func (l *LoginAttempts) Get(_ context.Context, key string) (model.LoginAttempts, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.attempts[key], nil
+}
+
+// RegisterFailure увеличивает счетчик; если с прошлой неудачи прошло больше окна, счет начинается заново.
+// Достигнув порога, счетчик блокируется под тем же мьютексом: параллельные неудачи не проскакивают порог,
+// а после истечения блокировки следующая неудача блокирует снова. true - блокировка начата этим вызовом
+func (l *LoginAttempts) RegisterFailure(_ context.Context, key string, now time.Time, limit model.AttemptLimit) (model.LoginAttempts, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a := l.attempts[key]
+	if now.Sub(a.LastFailure) > limit.Window && now.After(a.LockedUntil) {
+		a = model.LoginAttempts{}
+	}
+	a.Failures++
+	a.LastFailure = now
+	locked := false
+	if limit.MaxFailures > 0 && a.Failures >= limit.MaxFailures && !now.Before(a.LockedUntil) {
+		a.LockedUntil = now.Add(limit.Lockout)
+		locked = true
+	}
+	l.attempts[key] = a
+
+	l.writes++
+	if l.writes%sweepEvery == 0 {
+		l.sweep(now, limit.Window)
+	}
+	return a, locked, nil
+}
+
+func (l *LoginAttempts) Reset(_ context.Context, key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.attempts, key)
+	return nil
+}
+
+func (l *LoginAttempts) sweep(now time.Time, window time.Duration) {
+	for key, a := range l.attempts {
+		if now.Sub(a.LastFailure) > window && now.After(a.LockedUntil) {
+			delete(l.attempts, key)
+		}
+	}
+}
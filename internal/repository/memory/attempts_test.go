@@ -0,0 +1,65 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SversusN/gophermart/internal/model"
+)
+
+var testLimit = model.AttemptLimit{Window: time.Hour, MaxFailures: 3, Lockout: time.Minute}
+
+func TestRegisterFailureLocksOnce(t *testing.T) {
+	attempts := NewLoginAttempts()
+	now := time.Now()
+	var locks atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, locked, err := attempts.RegisterFailure(context.Background(), "login:user", now, testLimit)
+			assert.NoError(t, err)
+			if locked {
+				locks.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), locks.Load())
+	a, err := attempts.Get(context.Background(), "login:user")
+	require.NoError(t, err)
+	assert.Equal(t, 20, a.Failures)
+	assert.Equal(t, now.Add(testLimit.Lockout), a.LockedUntil)
+}
+
+func TestRegisterFailureLocksAgainAfterExpiry(t *testing.T) {
+	ctx := context.Background()
+	attempts := NewLoginAttempts()
+	now := time.Now()
+	for i := 1; i <= 3; i++ {
+		_, locked, err := attempts.RegisterFailure(ctx, "ip:10.0.0.1", now, testLimit)
+		require.NoError(t, err)
+		assert.Equal(t, i == 3, locked)
+	}
+
+	// блокировка истекла, но окно счетчика нет: первая же неудача блокирует снова
+	later := now.Add(testLimit.Lockout + time.Second)
+	a, locked, err := attempts.RegisterFailure(ctx, "ip:10.0.0.1", later, testLimit)
+	require.NoError(t, err)
+	assert.True(t, locked)
+	assert.Equal(t, 4, a.Failures)
+	assert.Equal(t, later.Add(testLimit.Lockout), a.LockedUntil)
+
+	// без порога счетчик не блокируется
+	_, locked, err = attempts.RegisterFailure(ctx, "login:user", now, model.AttemptLimit{Window: time.Hour})
+	require.NoError(t, err)
+	assert.False(t, locked)
+}
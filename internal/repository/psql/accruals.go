@@ -3,9 +3,11 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	errs "github.com/SversusN/gophermart/pkg/errors"
 	"go.uber.org/zap"
+	"strings"
 	"time"
 
 	"github.com/SversusN/gophermart/internal/model"
@@ -54,7 +56,7 @@ func (a *AccrualOrderPostgres) SaveOrder(ctx context.Context, order *model.Accru
 	order.UploadedAt = time.Now()
 
 	var userID int
-	var current float32
+	var current model.Money
 
 	checkCurrent, err := a.db.PrepareContext(ctx, "SELECT id, current FROM users WHERE id = $1;")
 	if err != nil {
@@ -71,6 +73,10 @@ func (a *AccrualOrderPostgres) SaveOrder(ctx context.Context, order *model.Accru
 	if err != nil {
 		return err
 	}
+	err = recordOrderStatus(ctx, tx, order.UserID, order.Number, order.Status.String(), order.Accrual, order.UploadedAt)
+	if err != nil {
+		return err
+	}
 
 	if order.Status == model.StatusPROCESSED {
 		current = current + order.Accrual
@@ -85,10 +91,62 @@ func (a *AccrualOrderPostgres) SaveOrder(ctx context.Context, order *model.Accru
 		if err != nil {
 			return err
 		}
+		lt := credit(model.LedgerAccrual, order.Number, userID, accountLoyalty, order.Accrual)
+		lt.earnedAt = order.UploadedAt
+		_, err = postLedger(ctx, tx, lt)
+		if err != nil {
+			return err
+		}
 	}
 	return tx.Commit()
 }
 
+// SaveOrders загружает пачку новых заказов в одной транзакции и возвращает результат по каждому номеру.
+// Повтор номера внутри пачки считается уже загруженным этим пользователем.
+func (a *AccrualOrderPostgres) SaveOrders(ctx context.Context, userID int, numbers []uint64) (results []string, err error) {
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			if txError := tx.Rollback(); txError != nil {
+				err = fmt.Errorf("accruals SaveOrders rollback error %s: %s", txError.Error(), err.Error())
+			}
+		}
+	}()
+
+	results = make([]string, len(numbers))
+	uploadedAt := time.Now()
+	for i, number := range numbers {
+		var owner int
+		err = tx.QueryRowContext(ctx,
+			`INSERT INTO public.accruals(order_num, user_id, status, uploaded_at) VALUES ($1,$2,$3,$4)
+			ON CONFLICT (order_num) DO NOTHING RETURNING user_id`,
+			number, userID, model.StatusNEW.String(), uploadedAt).Scan(&owner)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = tx.QueryRowContext(ctx, "SELECT user_id FROM public.accruals WHERE order_num = $1", number).Scan(&owner)
+			if err != nil {
+				return nil, err
+			}
+			results[i] = model.OrderAlreadyUploaded
+			if owner != userID {
+				results[i] = model.OrderOwnedByAnother
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		err = recordOrderStatus(ctx, tx, userID, number, model.StatusNEW.String(), 0, uploadedAt)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = model.OrderAccepted
+	}
+	return results, tx.Commit()
+}
+
 func (a *AccrualOrderPostgres) GetUserIDByNumberOrder(ctx context.Context, number uint64) int {
 	row := a.db.QueryRowContext(ctx, "SELECT user_id FROM public.accruals WHERE order_num=$1", number)
 	var userID int
@@ -97,7 +155,45 @@ func (a *AccrualOrderPostgres) GetUserIDByNumberOrder(ctx context.Context, numbe
 }
 
 func (a *AccrualOrderPostgres) GetUploadedOrders(ctx context.Context, userID int) ([]model.AccrualOrder, error) {
-	rows, err := a.db.QueryContext(ctx, "SELECT order_num, status, amount, uploaded_at FROM public.accruals WHERE user_id =$1", userID)
+	return a.GetOrders(ctx, model.OrderFilter{UserID: userID})
+}
+
+// GetOrders - заказы пользователя по времени загрузки; порядок однозначен за счет номера заказа
+func (a *AccrualOrderPostgres) GetOrders(ctx context.Context, filter model.OrderFilter) ([]model.AccrualOrder, error) {
+	direction, comparison := "ASC", ">"
+	if filter.Descending {
+		direction, comparison = "DESC", "<"
+	}
+	args := []interface{}{filter.UserID}
+	conditions := []string{"user_id = $1"}
+	if filter.After != nil {
+		args = append(args, filter.After.UploadedAt, filter.After.Number)
+		conditions = append(conditions, fmt.Sprintf("(uploaded_at, order_num) %s ($%d, $%d)", comparison, len(args)-1, len(args)))
+	}
+	if len(filter.Statuses) > 0 {
+		placeholders := make([]string, 0, len(filter.Statuses))
+		for _, status := range filter.Statuses {
+			args = append(args, status.String())
+			placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+		}
+		conditions = append(conditions, "status IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if !filter.From.IsZero() {
+		args = append(args, filter.From)
+		conditions = append(conditions, fmt.Sprintf("uploaded_at >= $%d", len(args)))
+	}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To)
+		conditions = append(conditions, fmt.Sprintf("uploaded_at < $%d", len(args)))
+	}
+	query := "SELECT order_num, status, amount, uploaded_at FROM public.accruals WHERE " +
+		strings.Join(conditions, " AND ") + fmt.Sprintf(" ORDER BY uploaded_at %[1]s, order_num %[1]s", direction)
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := a.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -114,7 +210,7 @@ func (a *AccrualOrderPostgres) GetUploadedOrders(ctx context.Context, userID int
 		}
 		order.Status, err = model.GetStatus(status)
 		if err != nil {
-			a.log.Error("accrualagent err db GetUploadedOrders")
+			a.log.Error("accrualagent err db GetOrders")
 			return nil, err
 		}
 		orders = append(orders, order)
@@ -125,3 +221,44 @@ func (a *AccrualOrderPostgres) GetUploadedOrders(ctx context.Context, userID int
 
 	return orders, nil
 }
+
+// GetOrder - заказ пользователя с историей статусов; чужой заказ не отличается от несуществующего
+func (a *AccrualOrderPostgres) GetOrder(ctx context.Context, userID int, number uint64) (*model.OrderDetail, error) {
+	var order model.OrderDetail
+	var status string
+	err := a.db.QueryRowContext(ctx,
+		"SELECT order_num, user_id, status, amount, uploaded_at FROM public.accruals WHERE order_num = $1 AND user_id = $2",
+		number, userID).Scan(&order.Number, &order.UserID, &status, &order.Accrual, &order.UploadedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errs.OrderNotFoundError{}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if order.Status, err = model.GetStatus(status); err != nil {
+		return nil, err
+	}
+
+	rows, err := a.db.QueryContext(ctx,
+		"SELECT status, accrual, changed_at FROM public.order_status_history WHERE order_num = $1 ORDER BY id", number)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	order.History = []model.OrderStatusChange{}
+	for rows.Next() {
+		var change model.OrderStatusChange
+		if err = rows.Scan(&status, &change.Accrual, &change.ChangedAt); err != nil {
+			return nil, err
+		}
+		if change.Status, err = model.GetStatus(status); err != nil {
+			return nil, err
+		}
+		order.History = append(order.History, change)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
@@ -0,0 +1,88 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/SversusN/gophermart/internal/model"
+)
+
+func TestGetOrdersOrder(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	userID := createTestUser(t, db)
+	uploaded := time.Now().Add(-time.Hour).Truncate(time.Microsecond)
+	first := uint64(time.Now().UnixNano() / 1000)
+	// два заказа с одним временем загрузки: порядок между ними задаёт номер
+	numbers := []uint64{first, first + 1, first + 2}
+	for i, number := range numbers {
+		_, err := db.ExecContext(ctx, "INSERT INTO public.accruals(order_num, user_id, status, uploaded_at) VALUES ($1, $2, 'NEW', $3)",
+			number, userID, uploaded.Add(time.Duration(min(i, 1))*time.Minute))
+		require.NoError(t, err)
+	}
+	repo := NewAccrualOrderPostgres(db, zap.NewNop())
+	numbersOf := func(orders []model.AccrualOrder) []uint64 {
+		var result []uint64
+		for _, order := range orders {
+			result = append(result, order.Number)
+		}
+		return result
+	}
+
+	// без параметров - от старых к новым, как до постраничной выдачи
+	orders, err := repo.GetUploadedOrders(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, numbers, numbersOf(orders))
+
+	orders, err = repo.GetOrders(ctx, model.OrderFilter{UserID: userID, Limit: 2})
+	require.NoError(t, err)
+	require.Equal(t, numbers[:2], numbersOf(orders))
+	orders, err = repo.GetOrders(ctx, model.OrderFilter{UserID: userID, Limit: 2,
+		After: &model.OrderCursor{UploadedAt: orders[1].UploadedAt, Number: orders[1].Number}})
+	require.NoError(t, err)
+	assert.Equal(t, numbers[2:], numbersOf(orders))
+
+	orders, err = repo.GetOrders(ctx, model.OrderFilter{UserID: userID, Limit: 2, Descending: true})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{numbers[2], numbers[1]}, numbersOf(orders))
+	orders, err = repo.GetOrders(ctx, model.OrderFilter{UserID: userID, Limit: 2, Descending: true,
+		After: &model.OrderCursor{UploadedAt: orders[1].UploadedAt, Number: orders[1].Number, Descending: true}})
+	require.NoError(t, err)
+	assert.Equal(t, numbers[:1], numbersOf(orders))
+}
+
+func TestGetOrdersUsesIndex(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	// в тестовой базе мало строк: без запрета планировщик прочитает таблицу целиком
+	_, err = tx.ExecContext(ctx, "SET LOCAL enable_seqscan = off")
+	require.NoError(t, err)
+
+	for _, direction := range []struct{ order, comparison string }{{"ASC", ">"}, {"DESC", "<"}} {
+		rows, err := tx.QueryContext(ctx, fmt.Sprintf(`EXPLAIN SELECT order_num, status, amount, uploaded_at FROM public.accruals
+			WHERE user_id = 1 AND (uploaded_at, order_num) %[2]s (NOW(), 0)
+			ORDER BY uploaded_at %[1]s, order_num %[1]s LIMIT 50`, direction.order, direction.comparison))
+		require.NoError(t, err)
+		var plan strings.Builder
+		for rows.Next() {
+			var line string
+			require.NoError(t, rows.Scan(&line))
+			plan.WriteString(line + "\n")
+		}
+		require.NoError(t, rows.Err())
+		rows.Close()
+		// страница читается по индексу в нужном порядке, без сортировки заказов пользователя
+		assert.Contains(t, plan.String(), "accruals_user_uploaded_idx", direction.order)
+		assert.NotContains(t, plan.String(), "Sort", direction.order)
+	}
+}
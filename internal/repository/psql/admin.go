@@ -0,0 +1,157 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/SversusN/gophermart/internal/model"
+	errs "github.com/SversusN/gophermart/pkg/errors"
+)
+
+const userInfoQuery = `SELECT u.id, COALESCE(u.login, ''), u.role, u.deleted_at, b.current, b.withdrawn
+	FROM public.users u CROSS JOIN LATERAL (
+		SELECT ` + balanceSums + `
+		FROM public.ledger_entries e JOIN public.ledger_transactions t ON t.id = e.transaction_id
+		WHERE e.user_id = u.id
+	) b(current, withdrawn, held) `
+
+type AdminPostgres struct {
+	db  *sql.DB
+	log *zap.Logger
+}
+
+func NewAdminPostgres(db *sql.DB, log *zap.Logger) *AdminPostgres {
+	return &AdminPostgres{
+		db:  db,
+		log: log,
+	}
+}
+
+func (a *AdminPostgres) GetUserInfo(ctx context.Context, userID int) (*model.UserInfo, error) {
+	return a.scanUserInfo(a.db.QueryRowContext(ctx, userInfoQuery+"WHERE u.id = $1", userID))
+}
+
+func (a *AdminPostgres) GetUserInfoByLogin(ctx context.Context, login string) (*model.UserInfo, error) {
+	var userID int
+	err := a.db.QueryRowContext(ctx, "SELECT id FROM public.users WHERE login = $1", login).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errs.UserNotFoundError{}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a.GetUserInfo(ctx, userID)
+}
+
+func (a *AdminPostgres) scanUserInfo(row *sql.Row) (*model.UserInfo, error) {
+	var info model.UserInfo
+	var deletedAt sql.NullTime
+	err := row.Scan(&info.ID, &info.Login, &info.Role, &deletedAt, &info.Current, &info.Withdrawn)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errs.UserNotFoundError{}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if deletedAt.Valid {
+		info.DeletedAt = &deletedAt.Time
+	}
+	return &info, nil
+}
+
+// RequeueOrder возвращает заказ в очередь агента начислений.
+// Обработанные заказы не трогаем - начисление по ним уже учтено в балансе.
+func (a *AdminPostgres) RequeueOrder(ctx context.Context, number uint64) (err error) {
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if txError := tx.Rollback(); txError != nil {
+				err = fmt.Errorf("admin RequeueOrder rollback error %s: %s", txError.Error(), err.Error())
+			}
+		}
+	}()
+
+	var userID int
+	var status string
+	err = tx.QueryRowContext(ctx, "SELECT user_id, status FROM public.accruals WHERE order_num = $1 FOR UPDATE", number).Scan(&userID, &status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errs.OrderNotFoundError{}
+	}
+	if err != nil {
+		return err
+	}
+	if status == model.StatusPROCESSED.String() {
+		return errs.OrderAlreadyProcessedError{}
+	}
+
+	// повторный опрос начинается сразу, без накопленной паузы
+	_, err = tx.ExecContext(ctx,
+		`UPDATE public.accruals SET status = $1, attempts = 0, next_attempt_at = NOW(), last_error = NULL, lease_owner = NULL
+		WHERE order_num = $2`,
+		model.StatusNEW.String(), number)
+	if err != nil {
+		return err
+	}
+	if err = recordOrderStatus(ctx, tx, userID, number, model.StatusNEW.String(), 0, time.Now()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AdjustBalance записывает корректировку; баланс после нее не может стать отрицательным
+func (a *AdminPostgres) AdjustBalance(ctx context.Context, adjustment *model.BalanceAdjustment) (err error) {
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if txError := tx.Rollback(); txError != nil {
+				err = fmt.Errorf("admin AdjustBalance rollback error %s: %s", txError.Error(), err.Error())
+			}
+		}
+	}()
+
+	var userID int
+	err = tx.QueryRowContext(ctx, "SELECT id FROM public.users WHERE id = $1 FOR UPDATE", adjustment.UserID).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errs.UserNotFoundError{}
+	}
+	if err != nil {
+		return err
+	}
+
+	balance, err := ledgerBalance(ctx, tx, adjustment.UserID)
+	if err != nil {
+		return err
+	}
+	if balance+adjustment.Amount < 0 {
+		return errs.ShowMeTheMoney{}
+	}
+
+	adjustment.CreatedAt = time.Now()
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO public.balance_adjustments(user_id, admin_id, amount, reason, created_at) VALUES ($1,$2,$3,$4,$5) RETURNING id",
+		adjustment.UserID, adjustment.AdminID, adjustment.Amount, adjustment.Reason, adjustment.CreatedAt).Scan(&adjustment.ID)
+	if err != nil {
+		return err
+	}
+	lt := credit(model.LedgerAdjustment, 0, adjustment.UserID, accountAdjustment, adjustment.Amount)
+	lt.referenceID = int64(adjustment.ID)
+	if _, err = postLedger(ctx, tx, lt); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE public.users SET current = current + $1 WHERE id = $2", adjustment.Amount, adjustment.UserID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
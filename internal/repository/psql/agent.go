@@ -3,9 +3,14 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
 	"go.uber.org/zap"
 
 	"github.com/SversusN/gophermart/internal/accrualagent/model"
+	ledger "github.com/SversusN/gophermart/internal/model"
 )
 
 type AgentPG struct {
@@ -20,8 +25,18 @@ func NewAgentPostgres(db *sql.DB, log *zap.Logger) *AgentPG {
 	}
 }
 
-func (a *AgentPG) GetOrders(ctx context.Context, limit int) ([]model.Order, error) {
-	rows, err := a.db.QueryContext(ctx, "SELECT order_num, status FROM public.accruals WHERE status=$1 OR status=$2 ORDER BY uploaded_at limit $3", model.StatusNEW.String(), model.StatusPROCESSING.String(), limit)
+// GetOrders забирает для агента owner заказы, которым пора опрашиваться, и сдвигает их следующую попытку на lease.
+// Заказы, взятые другими агентами, пропускаются; если агент упадёт, заказ вернётся в очередь после аренды
+func (a *AgentPG) GetOrders(ctx context.Context, owner string, limit int, lease time.Duration) ([]model.Order, error) {
+	now := time.Now()
+	rows, err := a.db.QueryContext(ctx,
+		`UPDATE public.accruals a SET next_attempt_at = $2, lease_owner = $6
+		FROM (SELECT order_num FROM public.accruals
+			WHERE status IN ($3, $4) AND next_attempt_at <= $1
+			ORDER BY next_attempt_at, uploaded_at LIMIT $5 FOR UPDATE SKIP LOCKED) due
+		WHERE a.order_num = due.order_num
+		RETURNING a.order_num, a.status, a.attempts`,
+		now, now.Add(lease), model.StatusNEW.String(), model.StatusPROCESSING.String(), limit, owner)
 	if err != nil {
 		return nil, err
 	}
@@ -30,7 +45,7 @@ func (a *AgentPG) GetOrders(ctx context.Context, limit int) ([]model.Order, erro
 	for rows.Next() {
 		var order model.Order
 		var status string
-		err = rows.Scan(&order.Number, &status)
+		err = rows.Scan(&order.Number, &status, &order.Attempts)
 		if err != nil {
 			return nil, err
 		}
@@ -48,20 +63,78 @@ func (a *AgentPG) GetOrders(ctx context.Context, limit int) ([]model.Order, erro
 	return orders, nil
 }
 
-func (a *AgentPG) UpdateOrderAccruals(ctx context.Context, orderAccruals []model.OrderAccrual) error {
-
-	stmt, err := a.db.PrepareContext(ctx,
-		"UPDATE public.accruals SET status=$1, amount=$2 WHERE order_num=$3")
+// UpdateOrderAccruals сохраняет ответы системы начислений: смена статуса дописывается в историю заказа,
+// начисление по обработанному заказу проводится по журналу и попадает в outbox в той же транзакции.
+// Ответы по заказам, которые уже забрал другой агент, пропускаются
+func (a *AgentPG) UpdateOrderAccruals(ctx context.Context, owner string, orderAccruals []model.OrderAccrual) (err error) {
+	tx, err := a.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
+	defer func() {
+		if err != nil {
+			if txError := tx.Rollback(); txError != nil {
+				err = fmt.Errorf("agent UpdateOrderAccruals rollback error %s: %s", txError.Error(), err.Error())
+			}
+		}
+	}()
 
 	for _, order := range orderAccruals {
-		_, err = stmt.ExecContext(ctx, order.Status, order.Accrual, order.Order)
+		var userID int
+		var uploadedAt time.Time
+		var previous string
+		err = tx.QueryRowContext(ctx,
+			`WITH prev AS (SELECT order_num, status FROM public.accruals WHERE order_num = $3 AND lease_owner = $5 FOR UPDATE)
+			UPDATE public.accruals a SET status = $1, amount = $2, attempts = 0, last_error = NULL, next_attempt_at = $4,
+				lease_owner = NULL
+			FROM prev WHERE a.order_num = prev.order_num RETURNING a.user_id, a.uploaded_at, prev.status`,
+			order.Status.String(), order.Accrual, order.Order, order.NextAttemptAt, owner).Scan(&userID, &uploadedAt, &previous)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if previous != order.Status.String() {
+			err = recordOrderStatus(ctx, tx, userID, order.Order, order.Status.String(), order.Accrual, time.Now())
+			if err != nil {
+				return err
+			}
+		}
+		if order.Status != model.StatusPROCESSED {
+			continue
+		}
+
+		// срок жизни начисленных баллов считается от загрузки заказа
+		lt := credit(ledger.LedgerAccrual, order.Order, userID, accountLoyalty, order.Accrual)
+		lt.earnedAt = uploadedAt
+		var posted bool
+		posted, err = postLedger(ctx, tx, lt)
 		if err != nil {
 			return err
 		}
+		if posted {
+			_, err = tx.ExecContext(ctx, "UPDATE public.users SET current = current + $1 WHERE id = $2", order.Accrual, userID)
+			if err != nil {
+				return err
+			}
+			err = enqueueEvent(ctx, tx, userID, ledger.WebhookOrderProcessed, ledger.OrderProcessedEvent{
+				UserID: userID, Number: order.Order, Accrual: order.Accrual, ProcessedAt: time.Now(),
+			})
+			if err != nil {
+				return err
+			}
+		}
 	}
-	return nil
+	return tx.Commit()
+}
+
+// RetryOrder откладывает опрос заказа после неудачи, если заказ всё ещё у агента owner
+func (a *AgentPG) RetryOrder(ctx context.Context, owner string, retry model.OrderRetry) error {
+	_, err := a.db.ExecContext(ctx,
+		`UPDATE public.accruals SET attempts = $2, next_attempt_at = $3, last_error = $4, lease_owner = NULL
+		WHERE order_num = $1 AND lease_owner = $5 AND status IN ($6, $7)`,
+		retry.Order, retry.Attempts, retry.NextAttemptAt, retry.LastError, owner,
+		model.StatusNEW.String(), model.StatusPROCESSING.String())
+	return err
 }
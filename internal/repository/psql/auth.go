@@ -3,6 +3,8 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	errs "github.com/SversusN/gophermart/pkg/errors"
 	"go.uber.org/zap"
 
@@ -40,13 +42,112 @@ func (a *AuthPostgres) CreateUser(ctx context.Context, user *model.User) (int, e
 	return userID, nil
 }
 
-func (a *AuthPostgres) GetUserID(ctx context.Context, user *model.User) (int, error) {
-	row := a.db.QueryRowContext(ctx, "SELECT id FROM public.users WHERE login=$1 AND password=$2", user.Login, user.Password)
-	var id sql.NullInt32
-	_ = row.Scan(&id)
-	if !id.Valid {
-		return 0, errs.AuthenticationError{}
+func (a *AuthPostgres) GetUserByLogin(ctx context.Context, login string) (*model.User, error) {
+	row := a.db.QueryRowContext(ctx, "SELECT id, login, password, role FROM public.users WHERE login=$1", login)
+	var user model.User
+	err := row.Scan(&user.ID, &user.Login, &user.Password, &user.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errs.AuthenticationError{}
 	}
-	userID := int(id.Int32)
-	return userID, nil
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (a *AuthPostgres) UpdatePassword(ctx context.Context, userID int, passwordHash string) error {
+	_, err := a.db.ExecContext(ctx, "UPDATE public.users SET password=$1 WHERE id=$2", passwordHash, userID)
+	return err
+}
+
+func (a *AuthPostgres) GetUserByID(ctx context.Context, userID int) (*model.User, error) {
+	row := a.db.QueryRowContext(ctx, "SELECT id, login, password, role FROM public.users WHERE id=$1 AND deleted_at IS NULL", userID)
+	var user model.User
+	err := row.Scan(&user.ID, &user.Login, &user.Password, &user.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errs.AuthenticationError{}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ChangePassword меняет хеш и отзывает все сессии пользователя одной транзакцией
+func (a *AuthPostgres) ChangePassword(ctx context.Context, userID int, passwordHash string) (err error) {
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if txError := tx.Rollback(); txError != nil {
+				err = fmt.Errorf("auth ChangePassword rollback error %s: %s", txError.Error(), err.Error())
+			}
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, "UPDATE public.users SET password=$1 WHERE id=$2", passwordHash, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE public.token_families SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL", userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteUser обезличивает пользователя. Начисления и списания не удаляются - они нужны для учета.
+func (a *AuthPostgres) DeleteUser(ctx context.Context, userID int, force bool) (err error) {
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if txError := tx.Rollback(); txError != nil {
+				err = fmt.Errorf("auth DeleteUser rollback error %s: %s", txError.Error(), err.Error())
+			}
+		}
+	}()
+
+	var id int
+	err = tx.QueryRowContext(ctx, "SELECT id FROM public.users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", userID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errs.AuthenticationError{}
+	}
+	if err != nil {
+		return err
+	}
+
+	balance, err := ledgerBalance(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	if balance > 0 && !force {
+		return errs.PositiveBalanceError{Balance: balance.String()}
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE public.users SET login = NULL, password = '', deleted_at = NOW() WHERE id = $1", userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE public.token_families SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL", userID)
+	if err != nil {
+		return err
+	}
+	// вебхуки удалённого пользователя отключаются, недоставленные события уходят в dead letter
+	_, err = tx.ExecContext(ctx,
+		`UPDATE public.webhook_deliveries SET status = $1, last_error = 'user deleted'
+		WHERE status = $2 AND webhook_id IN (SELECT id FROM public.webhooks WHERE user_id = $3 AND deleted_at IS NULL)`,
+		model.DeliveryDead, model.DeliveryPending, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE public.webhooks SET deleted_at = NOW() WHERE user_id = $1 AND deleted_at IS NULL", userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
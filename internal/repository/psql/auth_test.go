@@ -0,0 +1,64 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/SversusN/gophermart/internal/model"
+)
+
+// createTestDelivery заводит пользователю вебхук с недоставленным событием
+func createTestDelivery(t *testing.T, db *sql.DB, userID int) (webhookID, deliveryID int64) {
+	t.Helper()
+	ctx := context.Background()
+	require.NoError(t, db.QueryRowContext(ctx,
+		"INSERT INTO public.webhooks(user_id, url, secret, events) VALUES ($1, 'https://example.com/hook', 's', '{order.processed}') RETURNING id",
+		userID).Scan(&webhookID))
+	var eventID int64
+	require.NoError(t, db.QueryRowContext(ctx,
+		"INSERT INTO public.outbox_events(user_id, event_type, payload) VALUES ($1, 'order.processed', '{}') RETURNING id",
+		userID).Scan(&eventID))
+	require.NoError(t, db.QueryRowContext(ctx,
+		"INSERT INTO public.webhook_deliveries(webhook_id, event_id) VALUES ($1, $2) RETURNING id",
+		webhookID, eventID).Scan(&deliveryID))
+	return webhookID, deliveryID
+}
+
+func webhookState(t *testing.T, db *sql.DB, webhookID, deliveryID int64) (deleted bool, status string) {
+	t.Helper()
+	ctx := context.Background()
+	require.NoError(t, db.QueryRowContext(ctx,
+		"SELECT deleted_at IS NOT NULL FROM public.webhooks WHERE id = $1", webhookID).Scan(&deleted))
+	require.NoError(t, db.QueryRowContext(ctx,
+		"SELECT status FROM public.webhook_deliveries WHERE id = $1", deliveryID).Scan(&status))
+	return deleted, status
+}
+
+func TestChangePasswordKeepsWebhooks(t *testing.T) {
+	db := testDB(t)
+	userID := createTestUser(t, db)
+	webhookID, deliveryID := createTestDelivery(t, db, userID)
+
+	require.NoError(t, NewAuthPostgres(db, zap.NewNop()).ChangePassword(context.Background(), userID, "hash"))
+
+	deleted, status := webhookState(t, db, webhookID, deliveryID)
+	assert.False(t, deleted)
+	assert.Equal(t, model.DeliveryPending, status)
+}
+
+func TestDeleteUserDisablesWebhooks(t *testing.T) {
+	db := testDB(t)
+	userID := createTestUser(t, db)
+	webhookID, deliveryID := createTestDelivery(t, db, userID)
+
+	require.NoError(t, NewAuthPostgres(db, zap.NewNop()).DeleteUser(context.Background(), userID, false))
+
+	deleted, status := webhookState(t, db, webhookID, deliveryID)
+	assert.True(t, deleted)
+	assert.Equal(t, model.DeliveryDead, status)
+}
@@ -0,0 +1,105 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	"go.uber.org/zap"
+
+	"github.com/SversusN/gophermart/internal/model"
+)
+
+type OrderEventsPostgres struct {
+	db  *sql.DB
+	log *zap.Logger
+}
+
+func NewOrderEventsPostgres(db *sql.DB, log *zap.Logger) *OrderEventsPostgres {
+	return &OrderEventsPostgres{
+		db:  db,
+		log: log,
+	}
+}
+
+// Listen подписывается на смену статусов заказов на выделенном соединении и передаёт события в handle,
+// пока не отменён контекст или не оборвалось соединение
+func (o *OrderEventsPostgres) Listen(ctx context.Context, handle func(model.OrderEvent)) error {
+	conn, err := o.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var listenErr error
+	err = conn.Raw(func(driverConn interface{}) error {
+		pg, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("events Listen: unexpected driver connection %T", driverConn)
+		}
+		listenErr = listen(ctx, pg, handle, o.log)
+		// соединение с активным LISTEN нельзя возвращать в пул
+		return driver.ErrBadConn
+	})
+	if listenErr != nil {
+		return listenErr
+	}
+	return err
+}
+
+func listen(ctx context.Context, pg *stdlib.Conn, handle func(model.OrderEvent), log *zap.Logger) error {
+	if _, err := pg.Conn().Exec(ctx, "LISTEN "+orderEventsChannel); err != nil {
+		return err
+	}
+	for {
+		notification, err := pg.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var event model.OrderEvent
+		if err = json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+			log.Warn("OrderEventsPostgres.Listen: malformed notification", zap.String("payload", notification.Payload))
+			continue
+		}
+		handle(event)
+	}
+}
+
+// GetOrderEvents - переходы статусов заказов пользователя, пропущенные клиентом после события sinceID,
+// с id больше afterID по возрастанию id. id назначается при вставке, а запись видна после фиксации,
+// поэтому кроме переходов после sinceID отдаются и переходы с меньшим id, которые ещё не были
+// зафиксированы, когда записывалось событие sinceID: клиент получить их не мог
+func (o *OrderEventsPostgres) GetOrderEvents(ctx context.Context, userID int, sinceID, afterID int64, limit int) ([]model.OrderEvent, error) {
+	rows, err := o.db.QueryContext(ctx,
+		`SELECT h.id, a.user_id, h.order_num, h.status, h.accrual, h.changed_at
+		FROM public.order_status_history h JOIN public.accruals a ON a.order_num = h.order_num
+		WHERE a.user_id = $1 AND h.id > $3 AND (h.id > $2 OR (h.id < $2 AND EXISTS (
+			SELECT 1 FROM public.order_status_history s WHERE s.id = $2
+			AND h.tx_id <> s.tx_id AND NOT pg_visible_in_snapshot(h.tx_id, s.snapshot))))
+		ORDER BY h.id LIMIT $4`, userID, sinceID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []model.OrderEvent
+	for rows.Next() {
+		var event model.OrderEvent
+		var status string
+		err = rows.Scan(&event.ID, &event.UserID, &event.Number, &status, &event.Accrual, &event.ChangedAt)
+		if err != nil {
+			return nil, err
+		}
+		if event.Status, err = model.GetStatus(status); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
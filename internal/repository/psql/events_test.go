@@ -0,0 +1,67 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/SversusN/gophermart/internal/model"
+)
+
+func TestGetOrderEventsLateCommit(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	userID := createTestUser(t, db)
+	number := uint64(time.Now().UnixNano() / 1000)
+	_, err := db.ExecContext(ctx, "INSERT INTO public.accruals(order_num, user_id, status) VALUES ($1, $2, 'NEW')", number, userID)
+	require.NoError(t, err)
+
+	repo := NewOrderEventsPostgres(db, zap.NewNop())
+	ids := func(events []model.OrderEvent) []int64 {
+		var ids []int64
+		for _, event := range events {
+			ids = append(ids, event.ID)
+		}
+		return ids
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	require.NoError(t, recordOrderStatus(ctx, tx, userID, number, model.StatusNEW.String(), 0, time.Now()))
+	require.NoError(t, tx.Commit())
+
+	// второй переход получает меньший id, но фиксируется после третьего
+	late, err := db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	defer late.Rollback()
+	require.NoError(t, recordOrderStatus(ctx, late, userID, number, model.StatusPROCESSING.String(), 0, time.Now()))
+	early, err := db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	require.NoError(t, recordOrderStatus(ctx, early, userID, number, model.StatusPROCESSED.String(), 10*model.Point, time.Now()))
+	require.NoError(t, early.Commit())
+
+	events, err := repo.GetOrderEvents(ctx, userID, 0, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	first, streamed := events[0].ID, events[1].ID
+
+	// после переподключения отдаётся только пропущенный переход, полученное раньше не повторяется
+	require.NoError(t, late.Commit())
+	events, err = repo.GetOrderEvents(ctx, userID, streamed, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, model.StatusPROCESSING, events[0].Status)
+	assert.Less(t, events[0].ID, streamed)
+	assert.Greater(t, events[0].ID, first)
+
+	// история читается страницами
+	page, err := repo.GetOrderEvents(ctx, userID, first, 0, 1)
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	rest, err := repo.GetOrderEvents(ctx, userID, first, page[0].ID, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{events[0].ID, streamed}, append(ids(page), ids(rest)...))
+}
@@ -0,0 +1,41 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/SversusN/gophermart/internal/model"
+)
+
+// orderEventsChannel - канал NOTIFY, по которому реплики узнают о смене статусов заказов
+const orderEventsChannel = "order_events"
+
+// recordOrderStatus дописывает переход статуса заказа и оповещает подписчиков;
+// уведомление доставляется только после фиксации транзакции.
+// Начисление сохраняется только для PROCESSED
+func recordOrderStatus(ctx context.Context, tx *sql.Tx, userID int, orderNum uint64, status string, accrual model.Money, changedAt time.Time) error {
+	var amount sql.NullString
+	if status == model.StatusPROCESSED.String() {
+		amount = sql.NullString{String: accrual.String(), Valid: true}
+	} else {
+		accrual = 0
+	}
+	event := model.OrderEvent{UserID: userID, Number: orderNum, Accrual: accrual, ChangedAt: changedAt}
+	err := tx.QueryRowContext(ctx,
+		"INSERT INTO public.order_status_history(order_num, status, accrual, changed_at) VALUES ($1,$2,$3,$4) RETURNING id",
+		orderNum, status, amount, changedAt).Scan(&event.ID)
+	if err != nil {
+		return err
+	}
+	if event.Status, err = model.GetStatus(status); err != nil {
+		return err
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "SELECT pg_notify($1, $2)", orderEventsChannel, string(payload))
+	return err
+}
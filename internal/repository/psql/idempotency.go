@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"go.uber.org/zap"
+
+	"github.com/SversusN/gophermart/internal/model"
+)
+
+type IdempotencyPostgres struct {
+	db  *sql.DB
+	log *zap.Logger
+}
+
+func NewIdempotencyPostgres(db *sql.DB, log *zap.Logger) *IdempotencyPostgres {
+	return &IdempotencyPostgres{
+		db:  db,
+		log: log,
+	}
+}
+
+// Reserve занимает ключ за запросом. Просроченная запись перезаписывается.
+// Если ключ уже занят, возвращается существующая запись.
+func (i *IdempotencyPostgres) Reserve(ctx context.Context, record *model.IdempotencyRecord) (*model.IdempotencyRecord, error) {
+	var reserved bool
+	err := i.db.QueryRowContext(ctx,
+		`INSERT INTO public.idempotency_keys(user_id, key, request_hash, expires_at) VALUES ($1,$2,$3,$4)
+		ON CONFLICT (user_id, key) DO UPDATE
+			SET request_hash = EXCLUDED.request_hash, status_code = NULL, content_type = '', response_body = NULL,
+				created_at = NOW(), expires_at = EXCLUDED.expires_at
+			WHERE idempotency_keys.expires_at < NOW()
+		RETURNING true`,
+		record.UserID, record.Key, record.RequestHash, record.ExpiresAt).Scan(&reserved)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	existing := model.IdempotencyRecord{UserID: record.UserID, Key: record.Key}
+	var statusCode sql.NullInt32
+	err = i.db.QueryRowContext(ctx,
+		`SELECT request_hash, status_code, content_type, response_body, expires_at
+		FROM public.idempotency_keys WHERE user_id = $1 AND key = $2`, record.UserID, record.Key).
+		Scan(&existing.RequestHash, &statusCode, &existing.ContentType, &existing.Body, &existing.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	existing.StatusCode = int(statusCode.Int32)
+	return &existing, nil
+}
+
+func (i *IdempotencyPostgres) Complete(ctx context.Context, record *model.IdempotencyRecord) error {
+	_, err := i.db.ExecContext(ctx,
+		`UPDATE public.idempotency_keys SET status_code = $1, content_type = $2, response_body = $3
+		WHERE user_id = $4 AND key = $5`,
+		record.StatusCode, record.ContentType, record.Body, record.UserID, record.Key)
+	return err
+}
+
+// Release освобождает ключ, если запрос не удалось выполнить, чтобы клиент мог повторить его
+func (i *IdempotencyPostgres) Release(ctx context.Context, userID int, key string) error {
+	_, err := i.db.ExecContext(ctx,
+		"DELETE FROM public.idempotency_keys WHERE user_id = $1 AND key = $2 AND status_code IS NULL", userID, key)
+	return err
+}
+
+func (i *IdempotencyPostgres) DeleteExpired(ctx context.Context) (int64, error) {
+	result, err := i.db.ExecContext(ctx, "DELETE FROM public.idempotency_keys WHERE expires_at < NOW()")
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,320 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/SversusN/gophermart/internal/model"
+)
+
+// счета журнала; у счетов user и hold всегда есть владелец
+const (
+	accountUser       = "user"
+	accountHold       = "hold"
+	accountLoyalty    = "loyalty"
+	accountRedemption = "redemption"
+	accountAdjustment = "adjustment"
+	accountExpired    = "expired"
+)
+
+// balanceSums - текущий баланс, сумма списаний и удержания по проводкам пользователя.
+// Списанным считается то, что ушло на счет redemption со счета user или hold.
+const balanceSums = `COALESCE(SUM(e.amount) FILTER (WHERE e.account = 'user'), 0),
+	COALESCE(-SUM(e.amount) FILTER (WHERE t.kind IN ('withdrawal', 'refund')), 0),
+	COALESCE(SUM(e.amount) FILTER (WHERE e.account = 'hold'), 0)`
+
+const userBalanceQuery = `SELECT ` + balanceSums + `
+	FROM public.ledger_entries e JOIN public.ledger_transactions t ON t.id = e.transaction_id
+	WHERE e.user_id = $1`
+
+// posting - проводка по счету; userID заполняется только для счетов пользователя
+type posting struct {
+	account string
+	userID  int
+	amount  model.Money
+}
+
+// ledgerTransaction - операция журнала, сумма проводок которой равна нулю
+type ledgerTransaction struct {
+	kind        string
+	orderNum    uint64
+	referenceID int64
+	// earnedAt - дата, от которой считается срок жизни поступивших баллов; по умолчанию момент проводки
+	earnedAt time.Time
+	postings []posting
+}
+
+// move переводит amount со счета from на счет to
+func move(kind string, orderNum uint64, amount model.Money, from, to posting) ledgerTransaction {
+	from.amount, to.amount = -amount, amount
+	return ledgerTransaction{kind: kind, orderNum: orderNum, postings: []posting{to, from}}
+}
+
+// credit переводит amount со счета account на счет пользователя
+func credit(kind string, orderNum uint64, userID int, account string, amount model.Money) ledgerTransaction {
+	return move(kind, orderNum, amount, posting{account: account}, posting{account: accountUser, userID: userID})
+}
+
+// debit переводит amount со счета пользователя на счет account
+func debit(kind string, orderNum uint64, userID int, account string, amount model.Money) ledgerTransaction {
+	return move(kind, orderNum, amount, posting{account: accountUser, userID: userID}, posting{account: account})
+}
+
+// postLedger записывает операцию в рамках переданной транзакции БД.
+// Повторная операция того же вида по тому же заказу не записывается, тогда возвращается false.
+func postLedger(ctx context.Context, tx *sql.Tx, lt ledgerTransaction) (bool, error) {
+	if len(lt.postings) == 0 || lt.postings[0].amount == 0 {
+		return false, nil
+	}
+
+	var orderNum, referenceID sql.NullInt64
+	if lt.orderNum != 0 {
+		orderNum = sql.NullInt64{Int64: int64(lt.orderNum), Valid: true}
+	}
+	if lt.referenceID != 0 {
+		referenceID = sql.NullInt64{Int64: lt.referenceID, Valid: true}
+	}
+
+	var transactionID int64
+	err := tx.QueryRowContext(ctx,
+		`INSERT INTO public.ledger_transactions(kind, order_num, reference_id) VALUES ($1,$2,$3)
+		ON CONFLICT (kind, order_num) WHERE order_num IS NOT NULL DO NOTHING RETURNING id`,
+		lt.kind, orderNum, referenceID).Scan(&transactionID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	for _, p := range lt.postings {
+		var userID sql.NullInt64
+		if p.account == accountUser || p.account == accountHold {
+			userID = sql.NullInt64{Int64: int64(p.userID), Valid: true}
+		}
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO public.ledger_entries(transaction_id, account, user_id, amount) VALUES ($1,$2,$3,$4)",
+			transactionID, p.account, userID, p.amount)
+		if err != nil {
+			return false, err
+		}
+	}
+	if err = applyLots(ctx, tx, transactionID, lt); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ledgerBalance читает баланс пользователя внутри транзакции БД
+func ledgerBalance(ctx context.Context, tx *sql.Tx, userID int) (model.Money, error) {
+	var current, withdrawn, held model.Money
+	err := tx.QueryRowContext(ctx, userBalanceQuery, userID).Scan(&current, &withdrawn, &held)
+	return current, err
+}
+
+type LedgerPostgres struct {
+	db  *sql.DB
+	log *zap.Logger
+}
+
+func NewLedgerPostgres(db *sql.DB, log *zap.Logger) *LedgerPostgres {
+	return &LedgerPostgres{
+		db:  db,
+		log: log,
+	}
+}
+
+func (l *LedgerPostgres) GetBalance(ctx context.Context, userID int) (*model.Balance, error) {
+	balance := model.Balance{UserID: userID}
+	err := l.db.QueryRowContext(ctx, userBalanceQuery, userID).Scan(&balance.Current, &balance.Withdrawn, &balance.Held)
+	if err != nil {
+		return nil, err
+	}
+	return &balance, nil
+}
+
+// Reconcile сравнивает журнал с колонками users.current/users.withdrawal и с остатками партий
+// и возвращает пользователей, у которых они расходятся
+func (l *LedgerPostgres) Reconcile(ctx context.Context) ([]model.BalanceDrift, error) {
+	rows, err := l.db.QueryContext(ctx,
+		`SELECT u.id, COALESCE(b.current, 0), u.current, COALESCE(b.withdrawn, 0), u.withdrawal, COALESCE(p.remaining, 0)
+		FROM public.users u LEFT JOIN (
+			SELECT e.user_id, `+balanceSums+`
+			FROM public.ledger_entries e JOIN public.ledger_transactions t ON t.id = e.transaction_id
+			WHERE e.user_id IS NOT NULL GROUP BY e.user_id
+		) b(user_id, current, withdrawn, held) ON b.user_id = u.id
+		LEFT JOIN (
+			SELECT user_id, SUM(remaining) FROM public.point_lots WHERE expired_at IS NULL GROUP BY user_id
+		) p(user_id, remaining) ON p.user_id = u.id
+		WHERE COALESCE(b.current, 0) <> u.current OR COALESCE(b.withdrawn, 0) <> u.withdrawal
+			OR COALESCE(b.current, 0) <> COALESCE(p.remaining, 0)
+		ORDER BY u.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var drifts []model.BalanceDrift
+	for rows.Next() {
+		var d model.BalanceDrift
+		err = rows.Scan(&d.UserID, &d.LedgerCurrent, &d.LegacyCurrent, &d.LedgerWithdrawn, &d.LegacyWithdrawn, &d.LotsRemaining)
+		if err != nil {
+			return nil, err
+		}
+		drifts = append(drifts, d)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return drifts, nil
+}
+
+// GetExpiringLots - действующие партии пользователя, полученные раньше earnedBefore, от старых к новым
+func (l *LedgerPostgres) GetExpiringLots(ctx context.Context, userID int, earnedBefore time.Time) ([]model.PointLot, error) {
+	return l.queryLots(ctx,
+		`SELECT id, user_id, remaining, earned_at FROM public.point_lots
+		WHERE user_id = $1 AND remaining > 0 AND expired_at IS NULL AND earned_at < $2
+		ORDER BY earned_at, id`, userID, earnedBefore)
+}
+
+// GetExpiredLots - действующие партии всех пользователей, полученные раньше earnedBefore
+func (l *LedgerPostgres) GetExpiredLots(ctx context.Context, earnedBefore time.Time, limit int) ([]model.PointLot, error) {
+	return l.queryLots(ctx,
+		`SELECT id, user_id, remaining, earned_at FROM public.point_lots
+		WHERE remaining > 0 AND expired_at IS NULL AND earned_at < $1
+		ORDER BY earned_at, id LIMIT $2`, earnedBefore, limit)
+}
+
+func (l *LedgerPostgres) queryLots(ctx context.Context, query string, args ...any) ([]model.PointLot, error) {
+	rows, err := l.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lots []model.PointLot
+	for rows.Next() {
+		var lot model.PointLot
+		if err = rows.Scan(&lot.ID, &lot.UserID, &lot.Remaining, &lot.EarnedAt); err != nil {
+			return nil, err
+		}
+		lots = append(lots, lot)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return lots, nil
+}
+
+// ExpireLot списывает остаток партии на счет expired и возвращает сгоревшую сумму;
+// уже сгоревшая или израсходованная партия ничего не меняет
+func (l *LedgerPostgres) ExpireLot(ctx context.Context, lot *model.PointLot) (expired model.Money, err error) {
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			if txError := tx.Rollback(); txError != nil {
+				err = fmt.Errorf("ledger ExpireLot rollback error %s: %s", txError.Error(), err.Error())
+			}
+		}
+	}()
+
+	// порядок блокировок как у списания: сначала пользователь, потом партии
+	var userID int
+	err = tx.QueryRowContext(ctx, "SELECT id FROM public.users WHERE id = $1 FOR UPDATE", lot.UserID).Scan(&userID)
+	if err != nil {
+		return 0, err
+	}
+	err = tx.QueryRowContext(ctx,
+		"SELECT remaining FROM public.point_lots WHERE id = $1 AND expired_at IS NULL FOR UPDATE", lot.ID).Scan(&expired)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, tx.Commit()
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE public.point_lots SET remaining = 0, expired_at = NOW() WHERE id = $1", lot.ID)
+	if err != nil {
+		return 0, err
+	}
+	if expired > 0 {
+		lt := debit(model.LedgerExpiry, 0, lot.UserID, accountExpired, expired)
+		lt.referenceID = lot.ID
+		if _, err = postLedger(ctx, tx, lt); err != nil {
+			return 0, err
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE public.users SET current = current - $1 WHERE id = $2", expired, lot.UserID)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return expired, tx.Commit()
+}
+
+// GetTransactions - история операций по счету user, новые сначала. Баланс после операции
+// считается по всей истории пользователя, поэтому фильтры на него не влияют.
+func (l *LedgerPostgres) GetTransactions(ctx context.Context, filter model.TransactionFilter) ([]model.Transaction, error) {
+	args := []interface{}{filter.UserID}
+	var conditions []string
+	if filter.BeforeID != 0 {
+		args = append(args, filter.BeforeID)
+		conditions = append(conditions, fmt.Sprintf("id < $%d", len(args)))
+	}
+	if !filter.From.IsZero() {
+		args = append(args, filter.From)
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To)
+		conditions = append(conditions, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+	if len(filter.Types) > 0 {
+		placeholders := make([]string, 0, len(filter.Types))
+		for _, kind := range filter.Types {
+			args = append(args, kind)
+			placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+		}
+		conditions = append(conditions, "kind IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit)
+
+	rows, err := l.db.QueryContext(ctx,
+		`SELECT id, kind, COALESCE(order_num, 0), amount, balance, created_at FROM (
+			SELECT t.id, t.kind, t.order_num, SUM(e.amount) AS amount,
+				SUM(SUM(e.amount)) OVER (ORDER BY t.id) AS balance, t.created_at
+			FROM public.ledger_entries e JOIN public.ledger_transactions t ON t.id = e.transaction_id
+			WHERE e.user_id = $1 AND e.account = 'user'
+			GROUP BY t.id
+		) h `+where+fmt.Sprintf(`
+		ORDER BY id DESC LIMIT $%d`, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transactions []model.Transaction
+	for rows.Next() {
+		var tr model.Transaction
+		if err = rows.Scan(&tr.ID, &tr.Type, &tr.Order, &tr.Amount, &tr.Balance, &tr.CreatedAt); err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, tr)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"go.uber.org/zap"
+
+	"github.com/SversusN/gophermart/internal/model"
+)
+
+type LockoutPostgres struct {
+	db  *sql.DB
+	log *zap.Logger
+}
+
+func NewLockoutPostgres(db *sql.DB, log *zap.Logger) *LockoutPostgres {
+	return &LockoutPostgres{
+		db:  db,
+		log: log,
+	}
+}
+
+func (l *LockoutPostgres) RecordLockout(ctx context.Context, lockout *model.Lockout) error {
+	row := l.db.QueryRowContext(ctx,
+		"INSERT INTO public.login_lockouts(login, ip, failures, locked_until) VALUES (NULLIF($1,''),NULLIF($2,''),$3,$4) RETURNING id, created_at",
+		lockout.Login, lockout.IP, lockout.Failures, lockout.LockedUntil)
+	return row.Scan(&lockout.ID, &lockout.CreatedAt)
+}
+
+func (l *LockoutPostgres) GetActiveLockouts(ctx context.Context) ([]model.Lockout, error) {
+	rows, err := l.db.QueryContext(ctx,
+		`SELECT id, COALESCE(login,''), COALESCE(ip,''), failures, locked_until, created_at FROM public.login_lockouts
+		WHERE unlocked_at IS NULL AND locked_until > NOW() ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lockouts []model.Lockout
+	for rows.Next() {
+		var lockout model.Lockout
+		err = rows.Scan(&lockout.ID, &lockout.Login, &lockout.IP, &lockout.Failures, &lockout.LockedUntil, &lockout.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		lockouts = append(lockouts, lockout)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return lockouts, nil
+}
+
+func (l *LockoutPostgres) MarkUnlocked(ctx context.Context, login string, unlockedBy int) error {
+	_, err := l.db.ExecContext(ctx,
+		"UPDATE public.login_lockouts SET unlocked_at = NOW(), unlocked_by = NULLIF($2,0) WHERE login = $1 AND unlocked_at IS NULL",
+		login, unlockedBy)
+	return err
+}
+
+// MarkIPUnlocked закрывает блокировки по IP; блокировки логинов с этого адреса не затрагиваются
+func (l *LockoutPostgres) MarkIPUnlocked(ctx context.Context, ip string, unlockedBy int) error {
+	_, err := l.db.ExecContext(ctx,
+		"UPDATE public.login_lockouts SET unlocked_at = NOW(), unlocked_by = NULLIF($2,0) WHERE ip = $1 AND login IS NULL AND unlocked_at IS NULL",
+		ip, unlockedBy)
+	return err
+}
@@ -0,0 +1,198 @@
+package postgres
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/SversusN/gophermart/internal/model"
+	errs "github.com/SversusN/gophermart/pkg/errors"
+)
+
+// applyLots поддерживает партии баллов для проводок по счету user:
+// расход берется из самых старых партий, возврат восстанавливает израсходованные партии,
+// перевод переносит получателю даты партий отправителя, остальные поступления открывают новую партию.
+// Сгорание партий проводит ExpireLot.
+func applyLots(ctx context.Context, tx *sql.Tx, transactionID int64, lt ledgerTransaction) error {
+	if lt.kind == model.LedgerExpiry {
+		return nil
+	}
+	// расход проводится первым: перевод открывает партии получателя по партиям, израсходованным отправителем
+	postings := slices.Clone(lt.postings)
+	slices.SortStableFunc(postings, func(a, b posting) int { return cmp.Compare(a.amount, b.amount) })
+	for _, p := range postings {
+		if p.account != accountUser {
+			continue
+		}
+		var err error
+		switch {
+		case p.amount < 0:
+			err = consumeLots(ctx, tx, transactionID, p.userID, -p.amount)
+		case lt.kind == model.LedgerRefund || lt.kind == model.LedgerRelease:
+			err = restoreLots(ctx, tx, lt.orderNum, p.userID, p.amount)
+		case lt.kind == model.LedgerTransfer:
+			err = transferLots(ctx, tx, transactionID, p.userID)
+		default:
+			err = addLot(ctx, tx, sql.NullInt64{Int64: transactionID, Valid: true}, p.userID, p.amount, lt.earnedAt)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addLot(ctx context.Context, tx *sql.Tx, transactionID sql.NullInt64, userID int, amount model.Money, earnedAt time.Time) error {
+	if earnedAt.IsZero() {
+		earnedAt = time.Now()
+	}
+	_, err := tx.ExecContext(ctx,
+		"INSERT INTO public.point_lots(user_id, transaction_id, amount, remaining, earned_at) VALUES ($1,$2,$3,$3,$4)",
+		userID, transactionID, amount, earnedAt)
+	return err
+}
+
+// consumeLots списывает amount с действующих партий пользователя начиная с самых старых
+func consumeLots(ctx context.Context, tx *sql.Tx, transactionID int64, userID int, amount model.Money) error {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, remaining FROM public.point_lots
+		WHERE user_id = $1 AND remaining > 0 AND expired_at IS NULL
+		ORDER BY earned_at, id FOR UPDATE`, userID)
+	if err != nil {
+		return err
+	}
+	type lot struct {
+		id        int64
+		remaining model.Money
+	}
+	var lots []lot
+	for rows.Next() {
+		var l lot
+		if err = rows.Scan(&l.id, &l.remaining); err != nil {
+			rows.Close()
+			return err
+		}
+		lots = append(lots, l)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, l := range lots {
+		if amount == 0 {
+			break
+		}
+		take := min(l.remaining, amount)
+		_, err = tx.ExecContext(ctx, "UPDATE public.point_lots SET remaining = remaining - $1 WHERE id = $2", take, l.id)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO public.point_lot_allocations(lot_id, transaction_id, amount) VALUES ($1,$2,$3)",
+			l.id, transactionID, take)
+		if err != nil {
+			return err
+		}
+		amount -= take
+	}
+	if amount > 0 {
+		return errs.ShowMeTheMoney{}
+	}
+	return nil
+}
+
+// restoreLots возвращает баллы в партии, из которых было оплачено списание по заказу.
+// Если партия успела сгореть, возвращенные баллы получают ее дату и сгорают при следующем проходе;
+// если списание было до появления партий, открывается новая партия.
+func restoreLots(ctx context.Context, tx *sql.Tx, orderNum uint64, userID int, amount model.Money) error {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT l.id, l.transaction_id, l.earned_at, l.expired_at IS NOT NULL, a.amount
+		FROM public.point_lot_allocations a
+		JOIN public.point_lots l ON l.id = a.lot_id
+		JOIN public.ledger_transactions t ON t.id = a.transaction_id
+		WHERE t.order_num = $1 AND t.kind IN ($2, $3)
+		ORDER BY l.earned_at DESC, l.id DESC FOR UPDATE OF l`,
+		orderNum, model.LedgerWithdrawal, model.LedgerHold)
+	if err != nil {
+		return err
+	}
+	type allocation struct {
+		lotID         int64
+		transactionID sql.NullInt64
+		earnedAt      time.Time
+		expired       bool
+		amount        model.Money
+	}
+	var allocations []allocation
+	for rows.Next() {
+		var a allocation
+		if err = rows.Scan(&a.lotID, &a.transactionID, &a.earnedAt, &a.expired, &a.amount); err != nil {
+			rows.Close()
+			return err
+		}
+		allocations = append(allocations, a)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, a := range allocations {
+		if amount == 0 {
+			break
+		}
+		give := min(a.amount, amount)
+		if a.expired {
+			err = addLot(ctx, tx, a.transactionID, userID, give, a.earnedAt)
+		} else {
+			_, err = tx.ExecContext(ctx, "UPDATE public.point_lots SET remaining = remaining + $1 WHERE id = $2", give, a.lotID)
+		}
+		if err != nil {
+			return err
+		}
+		amount -= give
+	}
+	if amount > 0 {
+		return addLot(ctx, tx, sql.NullInt64{}, userID, amount, time.Time{})
+	}
+	return nil
+}
+
+// transferLots открывает получателю перевода по партии на каждую партию, израсходованную отправителем,
+// с ее датой начисления: перевод туда и обратно не продлевает срок жизни баллов
+func transferLots(ctx context.Context, tx *sql.Tx, transactionID int64, userID int) error {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT a.amount, l.earned_at FROM public.point_lot_allocations a
+		JOIN public.point_lots l ON l.id = a.lot_id
+		WHERE a.transaction_id = $1 ORDER BY l.earned_at, l.id`, transactionID)
+	if err != nil {
+		return err
+	}
+	type allocation struct {
+		amount   model.Money
+		earnedAt time.Time
+	}
+	var allocations []allocation
+	for rows.Next() {
+		var a allocation
+		if err = rows.Scan(&a.amount, &a.earnedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		allocations = append(allocations, a)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, a := range allocations {
+		if err = addLot(ctx, tx, sql.NullInt64{Int64: transactionID, Valid: true}, userID, a.amount, a.earnedAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
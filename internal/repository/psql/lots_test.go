@@ -0,0 +1,178 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/SversusN/gophermart/internal/model"
+	errs "github.com/SversusN/gophermart/pkg/errors"
+)
+
+// postTestLedger проводит операцию журнала и меняет баланс пользователя на сумму его проводок
+func postTestLedger(t *testing.T, db *sql.DB, lt ledgerTransaction) {
+	t.Helper()
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	posted, err := postLedger(ctx, tx, lt)
+	require.NoError(t, err)
+	require.True(t, posted)
+	for _, p := range lt.postings {
+		if p.account == accountUser {
+			_, err = tx.ExecContext(ctx, "UPDATE public.users SET current = current + $1 WHERE id = $2", p.amount, p.userID)
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tx.Commit())
+}
+
+// earnPoints начисляет пользователю баллы корректировкой с датой начисления earnedAt
+func earnPoints(t *testing.T, db *sql.DB, userID int, amount model.Money, earnedAt time.Time) {
+	t.Helper()
+	lt := credit(model.LedgerAdjustment, 0, userID, accountAdjustment, amount)
+	lt.earnedAt = earnedAt
+	postTestLedger(t, db, lt)
+}
+
+// testOrderNum - номер заказа, не занятый другими тестами
+func testOrderNum() uint64 {
+	return uint64(time.Now().UnixNano()/1000) + uint64(testUsers.Add(1))
+}
+
+type testLot struct {
+	remaining model.Money
+	earnedAt  time.Time
+}
+
+func lot(remaining model.Money, earnedAt time.Time) testLot {
+	return testLot{remaining: remaining, earnedAt: earnedAt}
+}
+
+// activeLots - действующие партии пользователя от старых к новым
+func activeLots(t *testing.T, db *sql.DB, userID int) []testLot {
+	t.Helper()
+	rows, err := db.QueryContext(context.Background(),
+		`SELECT remaining, earned_at FROM public.point_lots
+		WHERE user_id = $1 AND remaining > 0 AND expired_at IS NULL ORDER BY earned_at, id`, userID)
+	require.NoError(t, err)
+	defer rows.Close()
+	var lots []testLot
+	for rows.Next() {
+		var l testLot
+		require.NoError(t, rows.Scan(&l.remaining, &l.earnedAt))
+		l.earnedAt = l.earnedAt.In(time.Local)
+		lots = append(lots, l)
+	}
+	require.NoError(t, rows.Err())
+	return lots
+}
+
+func userLogin(t *testing.T, db *sql.DB, userID int) string {
+	t.Helper()
+	var login string
+	require.NoError(t, db.QueryRowContext(context.Background(), "SELECT login FROM public.users WHERE id = $1", userID).Scan(&login))
+	return login
+}
+
+func TestTransferKeepsLotDates(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	alice, bob := createTestUser(t, db), createTestUser(t, db)
+	older := time.Now().AddDate(0, -6, 0).Truncate(time.Microsecond)
+	newer := time.Now().AddDate(0, -2, 0).Truncate(time.Microsecond)
+	earnPoints(t, db, alice, 30*model.Point, older)
+	earnPoints(t, db, alice, 50*model.Point, newer)
+	repo := NewTransferPostgres(db, zap.NewNop())
+
+	// перевод забирает самые старые баллы и переносит их даты получателю
+	require.NoError(t, repo.CreateTransfer(ctx,
+		&model.Transfer{SenderID: alice, RecipientLogin: userLogin(t, db, bob), Sum: 40 * model.Point}, model.TransferLimit{}))
+	bobLots := activeLots(t, db, bob)
+	require.Len(t, bobLots, 2)
+	assert.Equal(t, []testLot{lot(30*model.Point, older), lot(10*model.Point, newer)}, bobLots)
+
+	// перевод обратно не продлевает срок жизни баллов
+	require.NoError(t, repo.CreateTransfer(ctx,
+		&model.Transfer{SenderID: bob, RecipientLogin: userLogin(t, db, alice), Sum: 40 * model.Point}, model.TransferLimit{}))
+	assert.Empty(t, activeLots(t, db, bob))
+	var total model.Money
+	for _, l := range activeLots(t, db, alice) {
+		assert.Contains(t, []time.Time{older, newer}, l.earnedAt)
+		total += l.remaining
+	}
+	assert.Equal(t, 80*model.Point, total)
+}
+
+func TestConsumeLotsOldestFirst(t *testing.T) {
+	db := testDB(t)
+	userID := createTestUser(t, db)
+	now := time.Now().Truncate(time.Microsecond)
+	months := func(n int) time.Time { return now.AddDate(0, -n, 0) }
+	// начисления приходят не по порядку дат: расход идет по earned_at, а не по порядку вставки
+	earnPoints(t, db, userID, 50*model.Point, months(2))
+	earnPoints(t, db, userID, 30*model.Point, months(3))
+	earnPoints(t, db, userID, 20*model.Point, months(1))
+
+	postTestLedger(t, db, debit(model.LedgerWithdrawal, testOrderNum(), userID, accountRedemption, 60*model.Point))
+	assert.Equal(t, []testLot{lot(20*model.Point, months(2)), lot(20*model.Point, months(1))}, activeLots(t, db, userID))
+
+	// списание больше остатка партий не проводится
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	_, err = postLedger(ctx, tx, debit(model.LedgerWithdrawal, testOrderNum(), userID, accountRedemption, 41*model.Point))
+	assert.ErrorIs(t, err, errs.ShowMeTheMoney{})
+}
+
+func TestRefundIntoExpiredLot(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	userID := createTestUser(t, db)
+	old := time.Now().AddDate(0, -13, 0).Truncate(time.Microsecond)
+	recent := time.Now().AddDate(0, -1, 0).Truncate(time.Microsecond)
+	earnPoints(t, db, userID, 30*model.Point, old)
+	earnPoints(t, db, userID, 50*model.Point, recent)
+
+	order := testOrderNum()
+	postTestLedger(t, db, debit(model.LedgerWithdrawal, order, userID, accountRedemption, 40*model.Point))
+	require.Equal(t, []testLot{lot(40*model.Point, recent)}, activeLots(t, db, userID))
+
+	// израсходованная старая партия сгорает пустой
+	repo := NewLedgerPostgres(db, zap.NewNop())
+	var oldLot model.PointLot
+	require.NoError(t, db.QueryRowContext(ctx,
+		"SELECT id, user_id, remaining, earned_at FROM public.point_lots WHERE user_id = $1 AND earned_at = $2", userID, old).
+		Scan(&oldLot.ID, &oldLot.UserID, &oldLot.Remaining, &oldLot.EarnedAt))
+	expired, err := repo.ExpireLot(ctx, &oldLot)
+	require.NoError(t, err)
+	assert.Zero(t, expired)
+
+	// возврат восстанавливает свежую партию, а баллы сгоревшей получают ее дату
+	postTestLedger(t, db, credit(model.LedgerRefund, order, userID, accountRedemption, 40*model.Point))
+	assert.Equal(t, []testLot{lot(30*model.Point, old), lot(50*model.Point, recent)}, activeLots(t, db, userID))
+
+	// и сгорают при следующем проходе
+	lots, err := repo.GetExpiredLots(ctx, time.Now().AddDate(0, -12, 0), 1000)
+	require.NoError(t, err)
+	var refunded *model.PointLot
+	for i := range lots {
+		if lots[i].UserID == userID {
+			require.Nil(t, refunded, "only the refunded lot has expired")
+			refunded = &lots[i]
+		}
+	}
+	require.NotNil(t, refunded)
+	assert.NotEqual(t, oldLot.ID, refunded.ID)
+	expired, err = repo.ExpireLot(ctx, refunded)
+	require.NoError(t, err)
+	assert.Equal(t, 30*model.Point, expired)
+	assert.Equal(t, []testLot{lot(50*model.Point, recent)}, activeLots(t, db, userID))
+}
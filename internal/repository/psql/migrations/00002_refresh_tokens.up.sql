@@ -0,0 +1,26 @@
+BEGIN TRANSACTION;
+
+-- семейство refresh токенов = одна сессия входа, отзывается целиком
+CREATE TABLE IF NOT EXISTS token_families
+(
+    id         TEXT PRIMARY KEY,
+    user_id    INT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens
+(
+    id         BIGSERIAL PRIMARY KEY,
+    family_id  TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    used_at    TIMESTAMP WITH TIME ZONE,
+    FOREIGN KEY (family_id) REFERENCES token_families (id)
+);
+
+CREATE INDEX IF NOT EXISTS token_families_user_id_idx ON token_families (user_id);
+
+COMMIT TRANSACTION;
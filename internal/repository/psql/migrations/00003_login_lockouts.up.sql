@@ -0,0 +1,18 @@
+BEGIN TRANSACTION;
+
+CREATE TABLE IF NOT EXISTS login_lockouts
+(
+    id           SERIAL PRIMARY KEY,
+    login        TEXT,
+    ip           TEXT,
+    failures     INT NOT NULL,
+    locked_until TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at   TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    unlocked_at  TIMESTAMP WITH TIME ZONE,
+    unlocked_by  INT,
+    FOREIGN KEY (unlocked_by) REFERENCES users (id)
+);
+
+CREATE INDEX IF NOT EXISTS login_lockouts_login_idx ON login_lockouts (login);
+
+COMMIT TRANSACTION;
@@ -0,0 +1,7 @@
+BEGIN TRANSACTION;
+
+-- удаленный аккаунт обезличивается: логин обнуляется, строки начислений и списаний остаются для учета
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users ALTER COLUMN login DROP NOT NULL;
+
+COMMIT TRANSACTION;
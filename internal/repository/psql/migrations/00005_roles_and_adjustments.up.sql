@@ -0,0 +1,20 @@
+BEGIN TRANSACTION;
+
+-- роль выдается вручную: UPDATE users SET role = 'admin' WHERE login = '...'
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'admin'));
+
+CREATE TABLE IF NOT EXISTS balance_adjustments
+(
+    id         SERIAL PRIMARY KEY,
+    user_id    INT  NOT NULL,
+    admin_id   INT  NOT NULL,
+    amount     REAL NOT NULL CHECK (amount <> 0),
+    reason     TEXT NOT NULL CHECK (btrim(reason) <> ''),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users (id),
+    FOREIGN KEY (admin_id) REFERENCES users (id)
+);
+
+CREATE INDEX IF NOT EXISTS balance_adjustments_user_id_idx ON balance_adjustments (user_id);
+
+COMMIT TRANSACTION;
@@ -0,0 +1,90 @@
+BEGIN TRANSACTION;
+
+-- Двойная запись: каждая операция - это транзакция из проводок, сумма которых равна нулю.
+-- Счет 'user' принадлежит пользователю, остальные - счета программы лояльности:
+-- loyalty - источник начислений, redemption - списанные баллы, adjustment - ручные корректировки.
+CREATE TABLE IF NOT EXISTS ledger_transactions
+(
+    id           BIGSERIAL PRIMARY KEY,
+    kind         TEXT NOT NULL CHECK (kind IN ('accrual', 'withdrawal', 'refund', 'adjustment')),
+    order_num    BIGINT,
+    reference_id BIGINT,
+    created_at   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- по заказу допускается не больше одной операции каждого вида
+CREATE UNIQUE INDEX IF NOT EXISTS ledger_transactions_order_idx ON ledger_transactions (kind, order_num) WHERE order_num IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS ledger_entries
+(
+    id             BIGSERIAL PRIMARY KEY,
+    transaction_id BIGINT         NOT NULL REFERENCES ledger_transactions (id),
+    account        TEXT           NOT NULL CHECK (account IN ('user', 'loyalty', 'redemption', 'adjustment')),
+    user_id        INT REFERENCES users (id),
+    amount         NUMERIC(14, 2) NOT NULL CHECK (amount <> 0),
+    CHECK ((account = 'user') = (user_id IS NOT NULL))
+);
+
+CREATE INDEX IF NOT EXISTS ledger_entries_user_idx ON ledger_entries (user_id, transaction_id) WHERE account = 'user';
+CREATE INDEX IF NOT EXISTS ledger_entries_transaction_idx ON ledger_entries (transaction_id);
+
+-- проводки не исправляются и не удаляются, ошибка исправляется новой операцией
+CREATE OR REPLACE FUNCTION ledger_immutable() RETURNS TRIGGER AS
+$$
+BEGIN
+    RAISE EXCEPTION 'ledger is append-only: % on % is not allowed', TG_OP, TG_TABLE_NAME;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ledger_transactions_immutable
+    BEFORE UPDATE OR DELETE ON ledger_transactions
+    FOR EACH ROW EXECUTE FUNCTION ledger_immutable();
+CREATE TRIGGER ledger_transactions_no_truncate
+    BEFORE TRUNCATE ON ledger_transactions
+    FOR EACH STATEMENT EXECUTE FUNCTION ledger_immutable();
+CREATE TRIGGER ledger_entries_immutable
+    BEFORE UPDATE OR DELETE ON ledger_entries
+    FOR EACH ROW EXECUTE FUNCTION ledger_immutable();
+CREATE TRIGGER ledger_entries_no_truncate
+    BEFORE TRUNCATE ON ledger_entries
+    FOR EACH STATEMENT EXECUTE FUNCTION ledger_immutable();
+
+-- баланс транзакции проверяется в момент коммита, когда все ее проводки уже записаны
+CREATE OR REPLACE FUNCTION ledger_balanced() RETURNS TRIGGER AS
+$$
+BEGIN
+    IF (SELECT SUM(amount) FROM ledger_entries WHERE transaction_id = NEW.transaction_id) <> 0 THEN
+        RAISE EXCEPTION 'ledger transaction % is not balanced', NEW.transaction_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER ledger_entries_balanced
+    AFTER INSERT ON ledger_entries
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION ledger_balanced();
+
+-- перенос истории
+INSERT INTO ledger_transactions(kind, order_num, created_at)
+SELECT 'accrual', order_num, uploaded_at FROM accruals WHERE round(amount::numeric, 2) > 0;
+INSERT INTO ledger_entries(transaction_id, account, user_id, amount)
+SELECT t.id, 'user', a.user_id, a.amount FROM ledger_transactions t JOIN accruals a ON a.order_num = t.order_num WHERE t.kind = 'accrual';
+INSERT INTO ledger_entries(transaction_id, account, amount)
+SELECT t.id, 'loyalty', -a.amount FROM ledger_transactions t JOIN accruals a ON a.order_num = t.order_num WHERE t.kind = 'accrual';
+
+INSERT INTO ledger_transactions(kind, order_num, created_at)
+SELECT 'withdrawal', order_num, processed_at FROM withdrawals WHERE round(amount::numeric, 2) > 0;
+INSERT INTO ledger_entries(transaction_id, account, user_id, amount)
+SELECT t.id, 'user', w.user_id, -w.amount FROM ledger_transactions t JOIN withdrawals w ON w.order_num = t.order_num WHERE t.kind = 'withdrawal';
+INSERT INTO ledger_entries(transaction_id, account, amount)
+SELECT t.id, 'redemption', w.amount FROM ledger_transactions t JOIN withdrawals w ON w.order_num = t.order_num WHERE t.kind = 'withdrawal';
+
+INSERT INTO ledger_transactions(kind, reference_id, created_at)
+SELECT 'adjustment', id, created_at FROM balance_adjustments WHERE round(amount::numeric, 2) <> 0;
+INSERT INTO ledger_entries(transaction_id, account, user_id, amount)
+SELECT t.id, 'user', b.user_id, b.amount FROM ledger_transactions t JOIN balance_adjustments b ON b.id = t.reference_id WHERE t.kind = 'adjustment';
+INSERT INTO ledger_entries(transaction_id, account, amount)
+SELECT t.id, 'adjustment', -b.amount FROM ledger_transactions t JOIN balance_adjustments b ON b.id = t.reference_id WHERE t.kind = 'adjustment';
+
+COMMIT TRANSACTION;
@@ -0,0 +1,10 @@
+BEGIN TRANSACTION;
+
+-- суммы баллов хранятся точно, до сотых
+ALTER TABLE users ALTER COLUMN "current" TYPE NUMERIC(14, 2) USING round("current"::numeric, 2);
+ALTER TABLE users ALTER COLUMN withdrawal TYPE NUMERIC(14, 2) USING round(withdrawal::numeric, 2);
+ALTER TABLE accruals ALTER COLUMN amount TYPE NUMERIC(14, 2) USING round(amount::numeric, 2);
+ALTER TABLE withdrawals ALTER COLUMN amount TYPE NUMERIC(14, 2) USING round(amount::numeric, 2);
+ALTER TABLE balance_adjustments ALTER COLUMN amount TYPE NUMERIC(14, 2) USING round(amount::numeric, 2);
+
+COMMIT TRANSACTION;
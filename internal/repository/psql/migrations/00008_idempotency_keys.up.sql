@@ -0,0 +1,20 @@
+BEGIN TRANSACTION;
+
+-- status_code пуст, пока первый запрос с ключом еще выполняется
+CREATE TABLE IF NOT EXISTS idempotency_keys
+(
+    user_id       INT  NOT NULL,
+    key           TEXT NOT NULL,
+    request_hash  TEXT NOT NULL,
+    status_code   INT,
+    content_type  TEXT NOT NULL DEFAULT '',
+    response_body BYTEA,
+    created_at    TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    expires_at    TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (user_id, key),
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
+
+COMMIT TRANSACTION;
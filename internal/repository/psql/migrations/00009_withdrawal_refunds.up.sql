@@ -0,0 +1,8 @@
+BEGIN TRANSACTION;
+
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'COMPLETED' CHECK (status IN ('COMPLETED', 'REFUNDED'));
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS refunded_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS refunded_by INT REFERENCES users (id);
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS refund_reason TEXT;
+
+COMMIT TRANSACTION;
@@ -0,0 +1,30 @@
+BEGIN TRANSACTION;
+
+-- Списание проходит PENDING -> CONFIRMED/REJECTED; подтвержденное можно вернуть (REFUNDED).
+-- Пока списание в PENDING, баллы лежат на счете удержания пользователя (hold).
+ALTER TABLE withdrawals DROP CONSTRAINT IF EXISTS withdrawals_status_check;
+UPDATE withdrawals SET status = 'CONFIRMED' WHERE status = 'COMPLETED';
+ALTER TABLE withdrawals ALTER COLUMN status SET DEFAULT 'CONFIRMED';
+ALTER TABLE withdrawals ADD CONSTRAINT withdrawals_status_check CHECK (status IN ('PENDING', 'CONFIRMED', 'REJECTED', 'REFUNDED'));
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS hold_expires_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS resolved_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS resolution_reason TEXT;
+
+CREATE INDEX IF NOT EXISTS withdrawals_pending_idx ON withdrawals (hold_expires_at) WHERE status = 'PENDING';
+
+ALTER TABLE ledger_transactions DROP CONSTRAINT IF EXISTS ledger_transactions_kind_check;
+ALTER TABLE ledger_transactions ADD CONSTRAINT ledger_transactions_kind_check
+    CHECK (kind IN ('accrual', 'withdrawal', 'refund', 'adjustment', 'hold', 'release'));
+
+-- счет удержания, как и счет user, принадлежит пользователю
+ALTER TABLE ledger_entries DROP CONSTRAINT IF EXISTS ledger_entries_account_check;
+ALTER TABLE ledger_entries ADD CONSTRAINT ledger_entries_account_check
+    CHECK (account IN ('user', 'hold', 'loyalty', 'redemption', 'adjustment'));
+ALTER TABLE ledger_entries DROP CONSTRAINT IF EXISTS ledger_entries_check;
+ALTER TABLE ledger_entries ADD CONSTRAINT ledger_entries_owner_check
+    CHECK ((account IN ('user', 'hold')) = (user_id IS NOT NULL));
+
+DROP INDEX IF EXISTS ledger_entries_user_idx;
+CREATE INDEX IF NOT EXISTS ledger_entries_user_idx ON ledger_entries (user_id, transaction_id) WHERE user_id IS NOT NULL;
+
+COMMIT TRANSACTION;
@@ -0,0 +1,58 @@
+BEGIN TRANSACTION;
+
+-- Баллы на счете user хранятся партиями: каждое поступление - отдельная партия со своей датой,
+-- списание расходует партии начиная с самых старых (FIFO), а истекшие партии списываются
+-- на счет expired. Сумма остатков действующих партий всегда равна балансу счета user.
+CREATE TABLE IF NOT EXISTS point_lots
+(
+    id             BIGSERIAL PRIMARY KEY,
+    user_id        INT            NOT NULL REFERENCES users (id),
+    transaction_id BIGINT REFERENCES ledger_transactions (id),
+    amount         NUMERIC(14, 2) NOT NULL CHECK (amount > 0),
+    remaining      NUMERIC(14, 2) NOT NULL CHECK (remaining >= 0 AND remaining <= amount),
+    earned_at      TIMESTAMP WITH TIME ZONE NOT NULL,
+    expired_at     TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS point_lots_user_idx ON point_lots (user_id, earned_at, id) WHERE remaining > 0 AND expired_at IS NULL;
+CREATE INDEX IF NOT EXISTS point_lots_earned_idx ON point_lots (earned_at) WHERE remaining > 0 AND expired_at IS NULL;
+
+-- из каких партий оплачена операция; по ним возврат восстанавливает партии
+CREATE TABLE IF NOT EXISTS point_lot_allocations
+(
+    lot_id         BIGINT         NOT NULL REFERENCES point_lots (id),
+    transaction_id BIGINT         NOT NULL REFERENCES ledger_transactions (id),
+    amount         NUMERIC(14, 2) NOT NULL CHECK (amount > 0),
+    PRIMARY KEY (transaction_id, lot_id)
+);
+
+ALTER TABLE ledger_transactions DROP CONSTRAINT IF EXISTS ledger_transactions_kind_check;
+ALTER TABLE ledger_transactions ADD CONSTRAINT ledger_transactions_kind_check
+    CHECK (kind IN ('accrual', 'withdrawal', 'refund', 'adjustment', 'hold', 'release', 'expiry'));
+
+ALTER TABLE ledger_entries DROP CONSTRAINT IF EXISTS ledger_entries_account_check;
+ALTER TABLE ledger_entries ADD CONSTRAINT ledger_entries_account_check
+    CHECK (account IN ('user', 'hold', 'loyalty', 'redemption', 'adjustment', 'expired'));
+
+-- Текущий баланс раскладывается по самым новым начислениям: старые при FIFO уже израсходованы.
+-- То, что начислениями не покрыто (ручные корректировки), становится одной партией с датой миграции.
+WITH balances AS (
+    SELECT user_id, SUM(amount) AS balance FROM ledger_entries WHERE account = 'user' GROUP BY user_id
+), earned AS (
+    SELECT t.id AS transaction_id, a.user_id, a.amount, a.uploaded_at,
+           SUM(a.amount) OVER (PARTITION BY a.user_id ORDER BY a.uploaded_at DESC, a.order_num DESC) - a.amount AS newer
+    FROM accruals a JOIN ledger_transactions t ON t.kind = 'accrual' AND t.order_num = a.order_num
+    WHERE a.amount > 0
+)
+INSERT INTO point_lots(user_id, transaction_id, amount, remaining, earned_at)
+SELECT e.user_id, e.transaction_id, e.amount, LEAST(e.amount, b.balance - e.newer), e.uploaded_at
+FROM earned e JOIN balances b ON b.user_id = e.user_id
+WHERE b.balance - e.newer > 0;
+
+INSERT INTO point_lots(user_id, amount, remaining, earned_at)
+SELECT b.user_id, b.balance - COALESCE(l.remaining, 0), b.balance - COALESCE(l.remaining, 0), NOW()
+FROM (SELECT user_id, SUM(amount) AS balance FROM ledger_entries WHERE account = 'user' GROUP BY user_id) b
+         LEFT JOIN (SELECT user_id, SUM(remaining) AS remaining FROM point_lots GROUP BY user_id) l ON l.user_id = b.user_id
+WHERE b.balance > COALESCE(l.remaining, 0);
+
+COMMIT TRANSACTION;
@@ -0,0 +1,21 @@
+BEGIN TRANSACTION;
+
+CREATE TABLE IF NOT EXISTS transfers
+(
+    id           BIGSERIAL PRIMARY KEY,
+    sender_id    INT            NOT NULL REFERENCES users (id),
+    recipient_id INT            NOT NULL REFERENCES users (id),
+    amount       NUMERIC(14, 2) NOT NULL CHECK (amount > 0),
+    created_at   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CHECK (sender_id <> recipient_id)
+);
+
+CREATE INDEX IF NOT EXISTS transfers_sender_idx ON transfers (sender_id, created_at);
+CREATE INDEX IF NOT EXISTS transfers_recipient_idx ON transfers (recipient_id, created_at);
+
+-- перевод - одна операция журнала с проводками по счетам user отправителя и получателя
+ALTER TABLE ledger_transactions DROP CONSTRAINT IF EXISTS ledger_transactions_kind_check;
+ALTER TABLE ledger_transactions ADD CONSTRAINT ledger_transactions_kind_check
+    CHECK (kind IN ('accrual', 'withdrawal', 'refund', 'adjustment', 'hold', 'release', 'expiry', 'transfer'));
+
+COMMIT TRANSACTION;
@@ -0,0 +1,23 @@
+BEGIN TRANSACTION;
+
+-- переходы статусов заказа; accruals хранит только текущее состояние
+CREATE TABLE IF NOT EXISTS order_status_history
+(
+    id         BIGSERIAL PRIMARY KEY,
+    order_num  BIGINT NOT NULL REFERENCES accruals (order_num),
+    status     TEXT   NOT NULL,
+    accrual    NUMERIC(14, 2),
+    changed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS order_status_history_order_idx ON order_status_history (order_num, id);
+
+-- Для загруженных раньше заказов известны только загрузка и текущий статус;
+-- промежуточные переходы не сохранялись, поэтому текущий статус датируется миграцией.
+INSERT INTO order_status_history(order_num, status, changed_at)
+SELECT order_num, 'NEW', uploaded_at FROM accruals ORDER BY uploaded_at, order_num;
+INSERT INTO order_status_history(order_num, status, accrual)
+SELECT order_num, status, CASE WHEN status = 'PROCESSED' THEN amount END FROM accruals
+WHERE status <> 'NEW' ORDER BY uploaded_at, order_num;
+
+COMMIT TRANSACTION;
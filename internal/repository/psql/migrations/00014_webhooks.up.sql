@@ -0,0 +1,45 @@
+BEGIN TRANSACTION;
+
+-- подписки на события; у подписок всей системы, которые заводит администратор, user_id пуст
+CREATE TABLE IF NOT EXISTS webhooks
+(
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    INT REFERENCES users (id),
+    url        TEXT   NOT NULL,
+    secret     TEXT   NOT NULL,
+    events     TEXT[] NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS webhooks_user_idx ON webhooks (user_id) WHERE deleted_at IS NULL;
+
+-- outbox: событие пишется в той же транзакции, что и изменение, которое его вызвало
+CREATE TABLE IF NOT EXISTS outbox_events
+(
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    INT   NOT NULL REFERENCES users (id),
+    event_type TEXT  NOT NULL,
+    payload    JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+    id               BIGSERIAL PRIMARY KEY,
+    webhook_id       BIGINT NOT NULL REFERENCES webhooks (id),
+    event_id         BIGINT NOT NULL REFERENCES outbox_events (id),
+    status           TEXT   NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'dead')),
+    attempts         INT    NOT NULL DEFAULT 0,
+    next_attempt_at  TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_error       TEXT,
+    last_status_code INT,
+    delivered_at     TIMESTAMP WITH TIME ZONE,
+    created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (webhook_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_dead_idx ON webhook_deliveries (id) WHERE status = 'dead';
+
+COMMIT TRANSACTION;
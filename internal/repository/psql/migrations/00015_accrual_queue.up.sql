@@ -0,0 +1,11 @@
+BEGIN TRANSACTION;
+
+-- очередь опроса системы начислений: заказ берётся агентом, когда подошло next_attempt_at;
+-- attempts и last_error описывают подряд идущие неудачные опросы
+ALTER TABLE accruals ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0;
+ALTER TABLE accruals ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW();
+ALTER TABLE accruals ADD COLUMN IF NOT EXISTS last_error TEXT;
+
+CREATE INDEX IF NOT EXISTS accruals_due_idx ON accruals (next_attempt_at) WHERE status IN ('NEW', 'PROCESSING');
+
+COMMIT TRANSACTION;
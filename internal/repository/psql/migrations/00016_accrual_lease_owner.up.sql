@@ -0,0 +1,6 @@
+BEGIN TRANSACTION;
+
+-- агент, который взял заказ в работу; ответ агента, чья аренда истекла и заказ забрал другой, не записывается
+ALTER TABLE accruals ADD COLUMN IF NOT EXISTS lease_owner TEXT;
+
+COMMIT TRANSACTION;
@@ -0,0 +1,11 @@
+BEGIN TRANSACTION;
+
+-- транзакция перехода и снимок, который она видела при вставке: по ним при переподключении
+-- находятся переходы с меньшим id, зафиксированные позже уже отданного клиенту.
+-- У прежних записей снимка нет, они повторно не отдаются
+ALTER TABLE order_status_history ADD COLUMN IF NOT EXISTS tx_id xid8;
+ALTER TABLE order_status_history ADD COLUMN IF NOT EXISTS snapshot pg_snapshot;
+ALTER TABLE order_status_history ALTER COLUMN tx_id SET DEFAULT pg_current_xact_id();
+ALTER TABLE order_status_history ALTER COLUMN snapshot SET DEFAULT pg_current_snapshot();
+
+COMMIT TRANSACTION;
@@ -0,0 +1,7 @@
+BEGIN TRANSACTION;
+
+-- постраничная выдача заказов пользователя: ключ курсора (uploaded_at, order_num) читается по индексу
+-- в обе стороны, без сортировки всех заказов пользователя на каждой странице
+CREATE INDEX IF NOT EXISTS accruals_user_uploaded_idx ON accruals (user_id, uploaded_at, order_num);
+
+COMMIT TRANSACTION;
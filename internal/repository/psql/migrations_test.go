@@ -0,0 +1,132 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	migratepg "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SversusN/gophermart/internal/model"
+)
+
+// freshDB создает пустую базу рядом с тестовой и удаляет ее после теста; миграции не применяются
+func freshDB(t *testing.T) (*sql.DB, *migrate.Migrate) {
+	t.Helper()
+	db := testDB(t)
+	ctx := context.Background()
+	name := fmt.Sprintf("gophermart_test_%d", time.Now().UnixNano())
+	_, err := db.ExecContext(ctx, "CREATE DATABASE "+name)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.ExecContext(ctx, "DROP DATABASE IF EXISTS "+name+" WITH (FORCE)") })
+
+	dsn, err := url.Parse(testDSN(t))
+	require.NoError(t, err)
+	dsn.Path = "/" + name
+	fresh, err := NewPsql(dsn.String())
+	require.NoError(t, err)
+	t.Cleanup(func() { fresh.DB.Close() })
+
+	source, err := iofs.New(MigrationsFS, migrationsDir)
+	require.NoError(t, err)
+	driver, err := migratepg.WithInstance(fresh.DB, &migratepg.Config{})
+	require.NoError(t, err)
+	m, err := migrate.NewWithInstance("iofs", source, name, driver)
+	require.NoError(t, err)
+	return fresh.DB, m
+}
+
+// Test00011Backfill проверяет раскладку баланса по партиям при появлении партий:
+// баланс покрывается самыми новыми начислениями, непокрытый остаток становится партией с датой миграции
+func Test00011Backfill(t *testing.T) {
+	db, m := freshDB(t)
+	ctx := context.Background()
+	require.NoError(t, m.Migrate(10))
+
+	exec := func(query string, args ...any) int64 {
+		t.Helper()
+		var id int64
+		require.NoError(t, db.QueryRowContext(ctx, query+" RETURNING id", args...).Scan(&id))
+		return id
+	}
+	user := func(login string) int {
+		return int(exec("INSERT INTO users(login, password) VALUES ($1, '')", login))
+	}
+	now := time.Now().Truncate(time.Microsecond)
+	accrual := func(userID int, number uint64, amount model.Money, uploadedAt time.Time) {
+		_, err := db.ExecContext(ctx, "INSERT INTO accruals(order_num, user_id, status, amount, uploaded_at) VALUES ($1,$2,'PROCESSED',$3,$4)",
+			number, userID, amount, uploadedAt)
+		require.NoError(t, err)
+		id := exec("INSERT INTO ledger_transactions(kind, order_num) VALUES ('accrual', $1)", number)
+		exec("INSERT INTO ledger_entries(transaction_id, account, user_id, amount) VALUES ($1, 'user', $2, $3)", id, userID, amount)
+		exec("INSERT INTO ledger_entries(transaction_id, account, amount) VALUES ($1, 'loyalty', $2)", id, -amount)
+	}
+	move := func(kind string, userID int, account string, amount model.Money) {
+		id := exec("INSERT INTO ledger_transactions(kind) VALUES ($1)", kind)
+		exec("INSERT INTO ledger_entries(transaction_id, account, user_id, amount) VALUES ($1, 'user', $2, $3)", id, userID, amount)
+		exec("INSERT INTO ledger_entries(transaction_id, account, amount) VALUES ($1, $2, $3)", id, account, -amount)
+	}
+
+	// 100 + 50 + 30 начислено, 120 потрачено, 20 добавлено вручную: баланс 80 покрывают два новых начисления
+	spender := user("spender")
+	accrual(spender, 1, 100*model.Point, now.AddDate(0, -3, 0))
+	accrual(spender, 2, 50*model.Point, now.AddDate(0, -2, 0))
+	accrual(spender, 3, 30*model.Point, now.AddDate(0, -1, 0))
+	move(model.LedgerWithdrawal, spender, accountRedemption, -120*model.Point)
+	move(model.LedgerAdjustment, spender, accountAdjustment, 20*model.Point)
+	// 40 начислено и 25 добавлено вручную: корректировка начислением не покрыта
+	adjusted := user("adjusted")
+	accrual(adjusted, 4, 40*model.Point, now.AddDate(0, -1, 0))
+	move(model.LedgerAdjustment, adjusted, accountAdjustment, 25*model.Point)
+	// все потрачено: партий нет
+	empty := user("empty")
+	accrual(empty, 5, 10*model.Point, now.AddDate(0, -1, 0))
+	move(model.LedgerWithdrawal, empty, accountRedemption, -10*model.Point)
+
+	migrated := time.Now()
+	require.NoError(t, m.Migrate(11))
+
+	type backfilled struct {
+		amount, remaining model.Money
+		earnedAt          time.Time
+		fromAccrual       bool
+	}
+	lotsOf := func(userID int) []backfilled {
+		rows, err := db.QueryContext(ctx,
+			"SELECT amount, remaining, earned_at, transaction_id IS NOT NULL FROM point_lots WHERE user_id = $1 ORDER BY earned_at, id", userID)
+		require.NoError(t, err)
+		defer rows.Close()
+		var lots []backfilled
+		for rows.Next() {
+			var l backfilled
+			require.NoError(t, rows.Scan(&l.amount, &l.remaining, &l.earnedAt, &l.fromAccrual))
+			lots = append(lots, l)
+		}
+		require.NoError(t, rows.Err())
+		return lots
+	}
+
+	lots := lotsOf(spender)
+	require.Len(t, lots, 2)
+	assert.Equal(t, backfilled{50 * model.Point, 50 * model.Point, now.AddDate(0, -2, 0), true},
+		backfilled{lots[0].amount, lots[0].remaining, lots[0].earnedAt.In(time.Local), lots[0].fromAccrual})
+	assert.Equal(t, backfilled{30 * model.Point, 30 * model.Point, now.AddDate(0, -1, 0), true},
+		backfilled{lots[1].amount, lots[1].remaining, lots[1].earnedAt.In(time.Local), lots[1].fromAccrual})
+
+	lots = lotsOf(adjusted)
+	require.Len(t, lots, 2)
+	assert.Equal(t, backfilled{40 * model.Point, 40 * model.Point, now.AddDate(0, -1, 0), true},
+		backfilled{lots[0].amount, lots[0].remaining, lots[0].earnedAt.In(time.Local), lots[0].fromAccrual})
+	assert.Equal(t, 25*model.Point, lots[1].remaining)
+	assert.False(t, lots[1].fromAccrual)
+	assert.WithinDuration(t, migrated, lots[1].earnedAt, time.Minute)
+
+	assert.Empty(t, lotsOf(empty))
+}
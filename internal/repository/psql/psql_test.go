@@ -0,0 +1,48 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testUsers atomic.Int64
+
+// testDB открывает базу с применёнными миграциями. Нужна отдельная база:
+// TEST_DATABASE_URI=postgres://... go test ./internal/repository/psql/...
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := testDSN(t)
+	db, err := NewPsql(dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.DB.Close() })
+	require.NoError(t, db.Init(dsn))
+	return db.DB
+}
+
+// testDSN - адрес тестовой базы; без него тест пропускается
+func testDSN(t *testing.T) string {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URI")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URI is not set")
+	}
+	return dsn
+}
+
+// createTestUser заводит пользователя с уникальным логином
+func createTestUser(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var userID int
+	err := db.QueryRowContext(context.Background(),
+		"INSERT INTO public.users(login, password) VALUES ($1, '') RETURNING id",
+		fmt.Sprintf("%s-%d-%d", t.Name(), time.Now().UnixNano(), testUsers.Add(1))).Scan(&userID)
+	require.NoError(t, err)
+	return userID
+}
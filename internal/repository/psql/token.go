@@ -0,0 +1,130 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/SversusN/gophermart/internal/model"
+	errs "github.com/SversusN/gophermart/pkg/errors"
+)
+
+type TokenPostgres struct {
+	db  *sql.DB
+	log *zap.Logger
+}
+
+func NewTokenPostgres(db *sql.DB, log *zap.Logger) *TokenPostgres {
+	return &TokenPostgres{
+		db:  db,
+		log: log,
+	}
+}
+
+func (t *TokenPostgres) CreateSession(ctx context.Context, session *model.Session, tokenHash string, expiresAt time.Time) (err error) {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if txError := tx.Rollback(); txError != nil {
+				err = fmt.Errorf("tokens CreateSession rollback error %s: %s", txError.Error(), err.Error())
+			}
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO public.token_families(id, user_id) VALUES ($1,$2)", session.ID, session.UserID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO public.refresh_tokens(family_id, token_hash, expires_at) VALUES ($1,$2,$3)",
+		session.ID, tokenHash, expiresAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RotateRefreshToken меняет refresh токен на новый в той же сессии.
+// Повторное использование уже обмененного токена означает утечку - сессия отзывается целиком.
+func (t *TokenPostgres) RotateRefreshToken(ctx context.Context, oldHash, newHash string, expiresAt time.Time) (session *model.Session, err error) {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		// при повторном использовании токена транзакция уже зафиксирована, откатывать нечего
+		if err != nil {
+			if txError := tx.Rollback(); txError != nil && !errors.Is(txError, sql.ErrTxDone) {
+				err = fmt.Errorf("tokens RotateRefreshToken rollback error %s: %s", txError.Error(), err.Error())
+			}
+		}
+	}()
+
+	var tokenID int64
+	var oldExpiresAt time.Time
+	var usedAt, revokedAt sql.NullTime
+	session = &model.Session{}
+	err = tx.QueryRowContext(ctx,
+		`SELECT r.id, r.expires_at, r.used_at, f.id, f.user_id, f.revoked_at, u.role
+		FROM public.refresh_tokens r JOIN public.token_families f ON f.id = r.family_id
+		JOIN public.users u ON u.id = f.user_id
+		WHERE r.token_hash = $1 FOR UPDATE OF r, f`, oldHash).
+		Scan(&tokenID, &oldExpiresAt, &usedAt, &session.ID, &session.UserID, &revokedAt, &session.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errs.InvalidTokenError{}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if revokedAt.Valid || time.Now().After(oldExpiresAt) {
+		return nil, errs.InvalidTokenError{}
+	}
+	if usedAt.Valid {
+		_, err = tx.ExecContext(ctx, "UPDATE public.token_families SET revoked_at = NOW() WHERE id = $1", session.ID)
+		if err != nil {
+			return nil, err
+		}
+		if err = tx.Commit(); err != nil {
+			return nil, err
+		}
+		return nil, errs.RefreshTokenReusedError{SessionID: session.ID}
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE public.refresh_tokens SET used_at = NOW() WHERE id = $1", tokenID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO public.refresh_tokens(family_id, token_hash, expires_at) VALUES ($1,$2,$3)",
+		session.ID, newHash, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return session, tx.Commit()
+}
+
+func (t *TokenPostgres) RevokeSession(ctx context.Context, sessionID string) error {
+	_, err := t.db.ExecContext(ctx,
+		"UPDATE public.token_families SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL", sessionID)
+	return err
+}
+
+func (t *TokenPostgres) IsSessionRevoked(ctx context.Context, sessionID string) (bool, error) {
+	var revokedAt sql.NullTime
+	err := t.db.QueryRowContext(ctx, "SELECT revoked_at FROM public.token_families WHERE id = $1", sessionID).Scan(&revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return revokedAt.Valid, nil
+}
@@ -0,0 +1,167 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+
+	"github.com/SversusN/gophermart/internal/model"
+	errs "github.com/SversusN/gophermart/pkg/errors"
+)
+
+// transferAttempts - сколько раз перевод повторяется после конфликта сериализации
+const transferAttempts = 3
+
+type TransferPostgres struct {
+	db  *sql.DB
+	log *zap.Logger
+}
+
+func NewTransferPostgres(db *sql.DB, log *zap.Logger) *TransferPostgres {
+	return &TransferPostgres{
+		db:  db,
+		log: log,
+	}
+}
+
+// CreateTransfer переводит баллы в одной сериализуемой транзакции;
+// при конфликте сериализации перевод повторяется целиком
+func (t *TransferPostgres) CreateTransfer(ctx context.Context, transfer *model.Transfer, limit model.TransferLimit) (err error) {
+	for attempt := 1; ; attempt++ {
+		err = t.createTransfer(ctx, transfer, limit)
+		if !isSerializationFailure(err) || attempt == transferAttempts {
+			return err
+		}
+		t.log.Warn("transfer CreateTransfer: serialization failure, retrying", zap.Int("attempt", attempt))
+	}
+}
+
+func (t *TransferPostgres) createTransfer(ctx context.Context, transfer *model.Transfer, limit model.TransferLimit) (err error) {
+	tx, err := t.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// после неудачного Commit транзакция уже завершена: ошибка фиксации (в том числе 40001) возвращается как есть
+		if err != nil {
+			if txError := tx.Rollback(); txError != nil && !errors.Is(txError, sql.ErrTxDone) {
+				err = fmt.Errorf("transfer CreateTransfer rollback error %s: %w", txError.Error(), err)
+			}
+		}
+	}()
+
+	err = tx.QueryRowContext(ctx,
+		"SELECT id FROM public.users WHERE login = $1 AND deleted_at IS NULL", transfer.RecipientLogin).
+		Scan(&transfer.RecipientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errs.UserNotFoundError{}
+	}
+	if err != nil {
+		return err
+	}
+	if transfer.RecipientID == transfer.SenderID {
+		return errs.SelfTransferError{}
+	}
+
+	// обе строки блокируются по возрастанию id: встречные переводы ждут друг друга, а не взаимоблокируются
+	rows, err := tx.QueryContext(ctx,
+		"SELECT id FROM public.users WHERE id IN ($1, $2) ORDER BY id FOR UPDATE", transfer.SenderID, transfer.RecipientID)
+	if err != nil {
+		return err
+	}
+	locked := 0
+	for rows.Next() {
+		locked++
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if locked != 2 {
+		return errs.UserNotFoundError{}
+	}
+
+	if limit.Amount > 0 {
+		var sent model.Money
+		err = tx.QueryRowContext(ctx,
+			"SELECT COALESCE(SUM(amount), 0) FROM public.transfers WHERE sender_id = $1 AND created_at >= $2",
+			transfer.SenderID, limit.Since).Scan(&sent)
+		if err != nil {
+			return err
+		}
+		if sent+transfer.Sum > limit.Amount {
+			return errs.TransferLimitExceededError{Remaining: max(limit.Amount-sent, 0).String()}
+		}
+	}
+
+	balance, err := ledgerBalance(ctx, tx, transfer.SenderID)
+	if err != nil {
+		return err
+	}
+	if balance < transfer.Sum {
+		return errs.ShowMeTheMoney{}
+	}
+
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO public.transfers(sender_id, recipient_id, amount) VALUES ($1,$2,$3) RETURNING id, created_at",
+		transfer.SenderID, transfer.RecipientID, transfer.Sum).Scan(&transfer.ID, &transfer.CreatedAt)
+	if err != nil {
+		return err
+	}
+	lt := move(model.LedgerTransfer, 0, transfer.Sum,
+		posting{account: accountUser, userID: transfer.SenderID}, posting{account: accountUser, userID: transfer.RecipientID})
+	lt.referenceID = transfer.ID
+	if _, err = postLedger(ctx, tx, lt); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		"UPDATE public.users SET current = current + CASE WHEN id = $1 THEN -$3::numeric ELSE $3::numeric END WHERE id IN ($1, $2)",
+		transfer.SenderID, transfer.RecipientID, transfer.Sum)
+	if err != nil {
+		return err
+	}
+
+	transfer.Direction, transfer.Counterparty = model.TransferOutgoing, transfer.RecipientLogin
+	return tx.Commit()
+}
+
+// GetTransfers - входящие и исходящие переводы пользователя, новые сначала
+func (t *TransferPostgres) GetTransfers(ctx context.Context, userID int) ([]model.Transfer, error) {
+	rows, err := t.db.QueryContext(ctx,
+		`SELECT tr.id, tr.sender_id, tr.recipient_id, COALESCE(u.login, ''), tr.amount, tr.created_at
+		FROM public.transfers tr
+		JOIN public.users u ON u.id = CASE WHEN tr.sender_id = $1 THEN tr.recipient_id ELSE tr.sender_id END
+		WHERE tr.sender_id = $1 OR tr.recipient_id = $1
+		ORDER BY tr.created_at DESC, tr.id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transfers []model.Transfer
+	for rows.Next() {
+		var transfer model.Transfer
+		err = rows.Scan(&transfer.ID, &transfer.SenderID, &transfer.RecipientID, &transfer.Counterparty, &transfer.Sum, &transfer.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		transfer.Direction = model.TransferIncoming
+		if transfer.SenderID == userID {
+			transfer.Direction = model.TransferOutgoing
+		}
+		transfers = append(transfers, transfer)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return transfers, nil
+}
+
+func isSerializationFailure(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "40001"
+}
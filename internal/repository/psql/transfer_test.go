@@ -0,0 +1,20 @@
+package postgres
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsSerializationFailure(t *testing.T) {
+	conflict := &pgconn.PgError{Code: "40001"}
+	assert.True(t, isSerializationFailure(conflict))
+	// ошибка фиксации, обернутая при откате, по-прежнему повторяется
+	assert.True(t, isSerializationFailure(fmt.Errorf("transfer CreateTransfer rollback error %s: %w", "conn closed", conflict)))
+	assert.False(t, isSerializationFailure(&pgconn.PgError{Code: "23505"}))
+	assert.False(t, isSerializationFailure(errors.New("40001")))
+	assert.False(t, isSerializationFailure(nil))
+}
@@ -0,0 +1,216 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/SversusN/gophermart/internal/model"
+	errs "github.com/SversusN/gophermart/pkg/errors"
+)
+
+type WebhookPostgres struct {
+	db  *sql.DB
+	log *zap.Logger
+}
+
+func NewWebhookPostgres(db *sql.DB, log *zap.Logger) *WebhookPostgres {
+	return &WebhookPostgres{
+		db:  db,
+		log: log,
+	}
+}
+
+// enqueueEvent пишет событие в outbox и ставит доставку каждому подходящему вебхуку;
+// вызывается в транзакции изменения, поэтому событие не теряется и не появляется без него
+func enqueueEvent(ctx context.Context, tx *sql.Tx, userID int, eventType string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	var eventID int64
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO public.outbox_events(user_id, event_type, payload) VALUES ($1,$2,$3) RETURNING id",
+		userID, eventType, string(payload)).Scan(&eventID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO public.webhook_deliveries(webhook_id, event_id)
+		SELECT id, $1 FROM public.webhooks
+		WHERE deleted_at IS NULL AND (user_id IS NULL OR user_id = $2) AND $3 = ANY(events)`,
+		eventID, userID, eventType)
+	return err
+}
+
+func (w *WebhookPostgres) CreateWebhook(ctx context.Context, webhook *model.Webhook) error {
+	return w.db.QueryRowContext(ctx,
+		`INSERT INTO public.webhooks(user_id, url, secret, events) VALUES (NULLIF($1, 0), $2, $3, string_to_array($4, ','))
+		RETURNING id, created_at`,
+		webhook.UserID, webhook.URL, webhook.Secret, strings.Join(webhook.Events, ",")).Scan(&webhook.ID, &webhook.CreatedAt)
+}
+
+// GetWebhooks - действующие вебхуки пользователя, для нулевого userID - вебхуки всей системы
+func (w *WebhookPostgres) GetWebhooks(ctx context.Context, userID int) ([]model.Webhook, error) {
+	rows, err := w.db.QueryContext(ctx,
+		`SELECT id, COALESCE(user_id, 0), url, array_to_string(events, ','), created_at FROM public.webhooks
+		WHERE user_id IS NOT DISTINCT FROM NULLIF($1, 0) AND deleted_at IS NULL ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []model.Webhook
+	for rows.Next() {
+		var webhook model.Webhook
+		var events string
+		if err = rows.Scan(&webhook.ID, &webhook.UserID, &webhook.URL, &events, &webhook.CreatedAt); err != nil {
+			return nil, err
+		}
+		webhook.Events = strings.Split(events, ",")
+		webhooks = append(webhooks, webhook)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// DeleteWebhook отключает вебхук; недоставленные события уходят в dead letter
+func (w *WebhookPostgres) DeleteWebhook(ctx context.Context, userID int, id int64) (err error) {
+	tx, err := w.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if txError := tx.Rollback(); txError != nil {
+				err = fmt.Errorf("webhook DeleteWebhook rollback error %s: %s", txError.Error(), err.Error())
+			}
+		}
+	}()
+
+	result, err := tx.ExecContext(ctx,
+		`UPDATE public.webhooks SET deleted_at = NOW()
+		WHERE id = $1 AND user_id IS NOT DISTINCT FROM NULLIF($2, 0) AND deleted_at IS NULL`, id, userID)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return errs.WebhookNotFoundError{}
+	}
+	_, err = tx.ExecContext(ctx,
+		"UPDATE public.webhook_deliveries SET status = $1, last_error = 'webhook deleted' WHERE webhook_id = $2 AND status = $3",
+		model.DeliveryDead, id, model.DeliveryPending)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ClaimDeliveries выбирает доставки, которым пора уходить, и откладывает их на lease:
+// если отправитель упадёт, доставку подхватит другой после истечения аренды
+func (w *WebhookPostgres) ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]model.WebhookDelivery, error) {
+	rows, err := w.db.QueryContext(ctx,
+		`UPDATE public.webhook_deliveries d SET next_attempt_at = $2
+		FROM (SELECT id FROM public.webhook_deliveries WHERE status = $3 AND next_attempt_at <= $1
+			ORDER BY next_attempt_at LIMIT $4 FOR UPDATE SKIP LOCKED) due,
+			public.webhooks wh, public.outbox_events e
+		WHERE d.id = due.id AND wh.id = d.webhook_id AND e.id = d.event_id
+		RETURNING d.id, d.webhook_id, wh.url, wh.secret, d.event_id, e.event_type, e.payload::text, e.created_at,
+			d.status, d.attempts, d.next_attempt_at`,
+		now, now.Add(lease), model.DeliveryPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []model.WebhookDelivery
+	for rows.Next() {
+		var delivery model.WebhookDelivery
+		var payload string
+		err = rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.URL, &delivery.Secret, &delivery.EventID,
+			&delivery.EventType, &payload, &delivery.EventCreatedAt, &delivery.Status, &delivery.Attempts, &delivery.NextAttemptAt)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Payload = json.RawMessage(payload)
+		deliveries = append(deliveries, delivery)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// UpdateDelivery сохраняет результат попытки доставки
+func (w *WebhookPostgres) UpdateDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	_, err := w.db.ExecContext(ctx,
+		`UPDATE public.webhook_deliveries SET status = $1, attempts = $2, next_attempt_at = $3,
+		last_error = NULLIF($4, ''), last_status_code = NULLIF($5, 0), delivered_at = $6 WHERE id = $7`,
+		delivery.Status, delivery.Attempts, delivery.NextAttemptAt, delivery.LastError, delivery.LastStatusCode,
+		delivery.DeliveredAt, delivery.ID)
+	return err
+}
+
+// GetDeliveries - последние доставки в статусе status, новые первыми
+func (w *WebhookPostgres) GetDeliveries(ctx context.Context, status string, limit int) ([]model.WebhookDelivery, error) {
+	rows, err := w.db.QueryContext(ctx,
+		`SELECT d.id, d.webhook_id, wh.url, d.event_id, e.event_type, e.payload::text, e.created_at,
+			d.status, d.attempts, d.next_attempt_at, COALESCE(d.last_error, ''), COALESCE(d.last_status_code, 0), d.delivered_at
+		FROM public.webhook_deliveries d
+		JOIN public.webhooks wh ON wh.id = d.webhook_id
+		JOIN public.outbox_events e ON e.id = d.event_id
+		WHERE d.status = $1 ORDER BY d.id DESC LIMIT $2`, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []model.WebhookDelivery
+	for rows.Next() {
+		var delivery model.WebhookDelivery
+		var payload string
+		var deliveredAt sql.NullTime
+		err = rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.URL, &delivery.EventID, &delivery.EventType,
+			&payload, &delivery.EventCreatedAt, &delivery.Status, &delivery.Attempts, &delivery.NextAttemptAt,
+			&delivery.LastError, &delivery.LastStatusCode, &deliveredAt)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Payload = json.RawMessage(payload)
+		if deliveredAt.Valid {
+			delivery.DeliveredAt = &deliveredAt.Time
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// ReplayDelivery возвращает доставку в очередь с новым счётчиком попыток; вебхук должен быть действующим
+func (w *WebhookPostgres) ReplayDelivery(ctx context.Context, id int64) error {
+	var status string
+	err := w.db.QueryRowContext(ctx,
+		`UPDATE public.webhook_deliveries d SET status = $2, attempts = 0, next_attempt_at = NOW(),
+			last_error = NULL, last_status_code = NULL, delivered_at = NULL
+		FROM public.webhooks wh
+		WHERE d.id = $1 AND wh.id = d.webhook_id AND wh.deleted_at IS NULL
+		RETURNING d.status`, id, model.DeliveryPending).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errs.WebhookDeliveryNotFoundError{}
+	}
+	return err
+}
@@ -0,0 +1,44 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/SversusN/gophermart/internal/model"
+)
+
+func TestClaimDeliveriesLease(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	_, deliveryID := createTestDelivery(t, db, createTestUser(t, db))
+	repo := NewWebhookPostgres(db, zap.NewNop())
+	claimed := func(now time.Time) bool {
+		t.Helper()
+		deliveries, err := repo.ClaimDeliveries(ctx, now, time.Minute, 1000)
+		require.NoError(t, err)
+		for _, delivery := range deliveries {
+			if delivery.ID == deliveryID {
+				return true
+			}
+		}
+		return false
+	}
+
+	now := time.Now()
+	require.True(t, claimed(now))
+	// пока аренда не истекла, доставку не берет другая реплика
+	assert.False(t, claimed(now.Add(30*time.Second)))
+	// отправитель упал, не сохранив результат: после аренды доставка снова в очереди
+	assert.True(t, claimed(now.Add(time.Minute+time.Second)))
+
+	// доставленное из очереди уходит
+	delivered := now.Add(2 * time.Minute)
+	require.NoError(t, repo.UpdateDelivery(ctx, &model.WebhookDelivery{ID: deliveryID, Status: model.DeliveryDelivered,
+		Attempts: 1, NextAttemptAt: delivered, LastStatusCode: 200, DeliveredAt: &delivered}))
+	assert.False(t, claimed(now.Add(time.Hour)))
+}
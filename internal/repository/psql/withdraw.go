@@ -3,6 +3,7 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	errs "github.com/SversusN/gophermart/pkg/errors"
 	"go.uber.org/zap"
@@ -23,22 +24,6 @@ func NewWithdrawOrderPostgres(db *sql.DB, log *zap.Logger) *WithdrawOrderReposit
 	}
 }
 
-func (w *WithdrawOrderRepository) GetAccruals(ctx context.Context, UserID int) float32 {
-	row := w.db.QueryRowContext(ctx, "SELECT SUM(amount) FROM public.accruals WHERE user_id=$1", UserID)
-	var accruals float32
-	_ = row.Scan(&accruals)
-
-	return accruals
-}
-
-func (w *WithdrawOrderRepository) GetWithdrawals(ctx context.Context, UserID int) float32 {
-	row := w.db.QueryRowContext(ctx, "SELECT SUM(amount) FROM public.withdrawals WHERE user_id=$1", UserID)
-	var withdrawals float32
-	_ = row.Scan(&withdrawals)
-
-	return withdrawals
-}
-
 func (w *WithdrawOrderRepository) DeductPoints(ctx context.Context, order *model.WithdrawOrder) (err error) {
 	order.ProcessedAt = time.Now()
 	tx, err := w.db.Begin()
@@ -66,33 +51,57 @@ func (w *WithdrawOrderRepository) DeductPoints(ctx context.Context, order *model
 		}
 	}
 
-	//https://t.me/bushigo/36
-	sumAcc := 0.0
-	sumWd := 0.0
-	err = tx.QueryRowContext(ctx,
-		`SELECT COALESCE(SUM(a.amount),0) as TotalBalance FROM (SELECT * FROM public.accruals FOR UPDATE) a WHERE a.user_id=$1`, order.UserID).Scan(&sumAcc)
+	// строка пользователя блокируется, чтобы параллельные списания видели актуальный баланс
+	err = tx.QueryRowContext(ctx, "SELECT id FROM public.users WHERE id = $1 FOR UPDATE", order.UserID).Scan(&canDeduct)
 	if err != nil {
 		w.log.Error(err.Error())
 		return err
 	}
-	err = tx.QueryRowContext(ctx,
-		`SELECT COALESCE(SUM(a.amount),0) as TotalBalance FROM (SELECT * FROM public.withdrawals FOR UPDATE) a WHERE a.user_id=$1`, order.UserID).Scan(&sumWd)
+	balance, err := ledgerBalance(ctx, tx, order.UserID)
 	if err != nil {
 		w.log.Error(err.Error())
 		return err
 	}
-	if sumAcc-sumWd <= 0 {
+	if balance <= 0 || balance < order.Sum {
 		return errs.ShowMeTheMoney{}
 	}
 
+	if order.Status == "" {
+		order.Status = model.WithdrawalConfirmed
+	}
+	var holdExpiresAt sql.NullTime
+	if order.HoldExpiresAt != nil {
+		holdExpiresAt = sql.NullTime{Time: *order.HoldExpiresAt, Valid: true}
+	}
 	_, err = tx.ExecContext(ctx,
-		"INSERT INTO public.withdrawals(order_num, user_id, amount, processed_at) VALUES ($1,$2,$3,$4)",
-		order.Order, order.UserID, order.Sum, order.ProcessedAt)
+		"INSERT INTO public.withdrawals(order_num, user_id, amount, status, processed_at, hold_expires_at) VALUES ($1,$2,$3,$4,$5,$6)",
+		order.Order, order.UserID, order.Sum, order.Status, order.ProcessedAt, holdExpiresAt)
+
+	if err != nil {
+		return err
+	}
 
+	// неподтвержденное списание только удерживает баллы до ответа магазина
+	if order.Status == model.WithdrawalPending {
+		_, err = postLedger(ctx, tx, move(model.LedgerHold, order.Order, order.Sum,
+			posting{account: accountUser, userID: order.UserID}, posting{account: accountHold, userID: order.UserID}))
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE users SET current = current - $1 WHERE id = $2", order.Sum, order.UserID)
+	} else {
+		_, err = postLedger(ctx, tx, debit(model.LedgerWithdrawal, order.Order, order.UserID, accountRedemption, order.Sum))
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE users SET current = current - $1, withdrawal = withdrawal + $1 WHERE id = $2", order.Sum, order.UserID)
+	}
 	if err != nil {
 		return err
 	}
-	_, err = tx.ExecContext(ctx, "UPDATE users SET current = current - $1, withdrawal = withdrawal + $1 WHERE id = $2", order.Sum, order.UserID)
+	err = enqueueEvent(ctx, tx, order.UserID, model.WebhookWithdrawalCreated, model.WithdrawalCreatedEvent{
+		UserID: order.UserID, Order: order.Order, Sum: order.Sum, Status: order.Status, ProcessedAt: order.ProcessedAt,
+	})
 	if err != nil {
 		return err
 	}
@@ -102,7 +111,7 @@ func (w *WithdrawOrderRepository) DeductPoints(ctx context.Context, order *model
 }
 
 func (w *WithdrawOrderRepository) GetWithdrawalOfPoints(ctx context.Context, userID int) ([]model.WithdrawOrder, error) {
-	rows, err := w.db.QueryContext(ctx, "SELECT order_num, amount, processed_at FROM public.withdrawals WHERE user_id =$1 ORDER BY processed_at", userID)
+	rows, err := w.db.QueryContext(ctx, "SELECT order_num, amount, status, processed_at, hold_expires_at, refunded_at FROM public.withdrawals WHERE user_id =$1 ORDER BY processed_at", userID)
 	if err != nil {
 		return nil, err
 	}
@@ -111,10 +120,17 @@ func (w *WithdrawOrderRepository) GetWithdrawalOfPoints(ctx context.Context, use
 	var orders []model.WithdrawOrder
 	for rows.Next() {
 		var order model.WithdrawOrder
-		err = rows.Scan(&order.Order, &order.Sum, &order.ProcessedAt)
+		var holdExpiresAt, refundedAt sql.NullTime
+		err = rows.Scan(&order.Order, &order.Sum, &order.Status, &order.ProcessedAt, &holdExpiresAt, &refundedAt)
 		if err != nil {
 			return nil, err
 		}
+		if holdExpiresAt.Valid && order.Status == model.WithdrawalPending {
+			order.HoldExpiresAt = &holdExpiresAt.Time
+		}
+		if refundedAt.Valid {
+			order.RefundedAt = &refundedAt.Time
+		}
 		orders = append(orders, order)
 	}
 	if err = rows.Err(); err != nil {
@@ -123,3 +139,165 @@ func (w *WithdrawOrderRepository) GetWithdrawalOfPoints(ctx context.Context, use
 
 	return orders, nil
 }
+
+// RefundWithdrawal отменяет списание: возврат проводится по журналу и восстанавливает баланс в той же транзакции
+func (w *WithdrawOrderRepository) RefundWithdrawal(ctx context.Context, refund *model.WithdrawalRefund) (err error) {
+	tx, err := w.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if txError := tx.Rollback(); txError != nil {
+				err = fmt.Errorf("balance RefundWithdrawal rollback error %s: %s", txError.Error(), err.Error())
+			}
+		}
+	}()
+
+	var userID int
+	var amount model.Money
+	var status string
+	var processedAt time.Time
+	err = tx.QueryRowContext(ctx,
+		"SELECT user_id, amount, status, processed_at FROM public.withdrawals WHERE order_num = $1 FOR UPDATE", refund.Order).
+		Scan(&userID, &amount, &status, &processedAt)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && refund.UserID != 0 && userID != refund.UserID) {
+		return errs.WithdrawalNotFoundError{}
+	}
+	if err != nil {
+		return err
+	}
+	switch status {
+	case model.WithdrawalRefunded:
+		return errs.WithdrawalAlreadyRefundedError{}
+	case model.WithdrawalRejected:
+		return errs.WithdrawalStatusError{Status: status}
+	case model.WithdrawalPending:
+		// удержание по неподтвержденному списанию просто снимается
+		reason := refund.Reason
+		if reason == "" {
+			reason = "cancelled"
+		}
+		if err = w.resolve(ctx, tx, refund.Order, userID, amount, model.WithdrawalRejected, reason); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+	if !refund.NotBefore.IsZero() && processedAt.Before(refund.NotBefore) {
+		return errs.CancellationWindowExpiredError{}
+	}
+
+	var reason sql.NullString
+	if refund.Reason != "" {
+		reason = sql.NullString{String: refund.Reason, Valid: true}
+	}
+	_, err = tx.ExecContext(ctx,
+		"UPDATE public.withdrawals SET status = $1, refunded_at = NOW(), refunded_by = $2, refund_reason = $3 WHERE order_num = $4",
+		model.WithdrawalRefunded, refund.RefundedBy, reason, refund.Order)
+	if err != nil {
+		return err
+	}
+	_, err = postLedger(ctx, tx, credit(model.LedgerRefund, refund.Order, userID, accountRedemption, amount))
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE users SET current = current + $1, withdrawal = withdrawal - $1 WHERE id = $2", amount, userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ResolveWithdrawal подтверждает или отклоняет списание в статусе PENDING.
+// Повторный ответ с тем же статусом ничего не меняет.
+func (w *WithdrawOrderRepository) ResolveWithdrawal(ctx context.Context, order uint64, status, reason string) (err error) {
+	tx, err := w.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if txError := tx.Rollback(); txError != nil {
+				err = fmt.Errorf("balance ResolveWithdrawal rollback error %s: %s", txError.Error(), err.Error())
+			}
+		}
+	}()
+
+	var userID int
+	var amount model.Money
+	var current string
+	err = tx.QueryRowContext(ctx,
+		"SELECT user_id, amount, status FROM public.withdrawals WHERE order_num = $1 FOR UPDATE", order).
+		Scan(&userID, &amount, &current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errs.WithdrawalNotFoundError{}
+	}
+	if err != nil {
+		return err
+	}
+	if current == status {
+		return tx.Commit()
+	}
+	if current != model.WithdrawalPending {
+		return errs.WithdrawalStatusError{Status: current}
+	}
+
+	if err = w.resolve(ctx, tx, order, userID, amount, status, reason); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// resolve снимает удержание: при подтверждении баллы уходят в redemption, при отказе возвращаются пользователю
+func (w *WithdrawOrderRepository) resolve(ctx context.Context, tx *sql.Tx, order uint64, userID int, amount model.Money, status, reason string) error {
+	hold := posting{account: accountHold, userID: userID}
+	var lt ledgerTransaction
+	var legacy string
+	if status == model.WithdrawalConfirmed {
+		lt = move(model.LedgerWithdrawal, order, amount, hold, posting{account: accountRedemption})
+		legacy = "UPDATE users SET withdrawal = withdrawal + $1 WHERE id = $2"
+	} else {
+		lt = move(model.LedgerRelease, order, amount, hold, posting{account: accountUser, userID: userID})
+		legacy = "UPDATE users SET current = current + $1 WHERE id = $2"
+	}
+
+	var resolutionReason sql.NullString
+	if reason != "" {
+		resolutionReason = sql.NullString{String: reason, Valid: true}
+	}
+	_, err := tx.ExecContext(ctx,
+		"UPDATE public.withdrawals SET status = $1, resolved_at = NOW(), resolution_reason = $2 WHERE order_num = $3",
+		status, resolutionReason, order)
+	if err != nil {
+		return err
+	}
+	if _, err = postLedger(ctx, tx, lt); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, legacy, amount, userID)
+	return err
+}
+
+// GetExpiredHolds - неподтвержденные списания, удержание по которым истекло к моменту now
+func (w *WithdrawOrderRepository) GetExpiredHolds(ctx context.Context, now time.Time, limit int) ([]uint64, error) {
+	rows, err := w.db.QueryContext(ctx,
+		"SELECT order_num FROM public.withdrawals WHERE status = $1 AND hold_expires_at < $2 ORDER BY hold_expires_at LIMIT $3",
+		model.WithdrawalPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []uint64
+	for rows.Next() {
+		var order uint64
+		if err = rows.Scan(&order); err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
@@ -3,40 +3,132 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"time"
+
 	"go.uber.org/zap"
 
 	"github.com/SversusN/gophermart/internal/model"
+	"github.com/SversusN/gophermart/internal/repository/memory"
 	"github.com/SversusN/gophermart/internal/repository/psql"
 )
 
 type AuthRepoInterface interface {
 	CreateUser(ctx context.Context, user *model.User) (int, error)
-	GetUserID(ctx context.Context, user *model.User) (int, error)
+	GetUserByLogin(ctx context.Context, login string) (*model.User, error)
+	GetUserByID(ctx context.Context, userID int) (*model.User, error)
+	UpdatePassword(ctx context.Context, userID int, passwordHash string) error
+	ChangePassword(ctx context.Context, userID int, passwordHash string) error
+	DeleteUser(ctx context.Context, userID int, force bool) error
+}
+
+type TokenRepoInterface interface {
+	CreateSession(ctx context.Context, session *model.Session, tokenHash string, expiresAt time.Time) error
+	RotateRefreshToken(ctx context.Context, oldHash, newHash string, expiresAt time.Time) (*model.Session, error)
+	RevokeSession(ctx context.Context, sessionID string) error
+	IsSessionRevoked(ctx context.Context, sessionID string) (bool, error)
+}
+
+type LoginAttemptRepoInterface interface {
+	Get(ctx context.Context, key string) (model.LoginAttempts, error)
+	RegisterFailure(ctx context.Context, key string, now time.Time, limit model.AttemptLimit) (model.LoginAttempts, bool, error)
+	Reset(ctx context.Context, key string) error
+}
+
+type LockoutRepoInterface interface {
+	RecordLockout(ctx context.Context, lockout *model.Lockout) error
+	GetActiveLockouts(ctx context.Context) ([]model.Lockout, error)
+	MarkUnlocked(ctx context.Context, login string, unlockedBy int) error
+	MarkIPUnlocked(ctx context.Context, ip string, unlockedBy int) error
+}
+
+type AdminRepoInterface interface {
+	GetUserInfo(ctx context.Context, userID int) (*model.UserInfo, error)
+	GetUserInfoByLogin(ctx context.Context, login string) (*model.UserInfo, error)
+	RequeueOrder(ctx context.Context, number uint64) error
+	AdjustBalance(ctx context.Context, adjustment *model.BalanceAdjustment) error
+}
+
+type LedgerRepoInterface interface {
+	GetBalance(ctx context.Context, userID int) (*model.Balance, error)
+	Reconcile(ctx context.Context) ([]model.BalanceDrift, error)
+	GetExpiringLots(ctx context.Context, userID int, earnedBefore time.Time) ([]model.PointLot, error)
+	GetExpiredLots(ctx context.Context, earnedBefore time.Time, limit int) ([]model.PointLot, error)
+	ExpireLot(ctx context.Context, lot *model.PointLot) (model.Money, error)
+	GetTransactions(ctx context.Context, filter model.TransactionFilter) ([]model.Transaction, error)
+}
+
+type IdempotencyRepoInterface interface {
+	Reserve(ctx context.Context, record *model.IdempotencyRecord) (*model.IdempotencyRecord, error)
+	Complete(ctx context.Context, record *model.IdempotencyRecord) error
+	Release(ctx context.Context, userID int, key string) error
+	DeleteExpired(ctx context.Context) (int64, error)
 }
 
 type AccrualOrderRepoInterface interface {
 	SaveOrder(ctx context.Context, order *model.AccrualOrder) error
+	SaveOrders(ctx context.Context, userID int, numbers []uint64) ([]string, error)
 	GetUserIDByNumberOrder(ctx context.Context, number uint64) int
 	GetUploadedOrders(ctx context.Context, userID int) ([]model.AccrualOrder, error)
+	GetOrders(ctx context.Context, filter model.OrderFilter) ([]model.AccrualOrder, error)
+	GetOrder(ctx context.Context, userID int, number uint64) (*model.OrderDetail, error)
 }
 
 type WithdrawOrderRepoInterface interface {
-	GetAccruals(ctx context.Context, UserID int) float32
-	GetWithdrawals(ctx context.Context, UserID int) float32
 	DeductPoints(ctx context.Context, order *model.WithdrawOrder) error
 	GetWithdrawalOfPoints(ctx context.Context, userID int) ([]model.WithdrawOrder, error)
+	RefundWithdrawal(ctx context.Context, refund *model.WithdrawalRefund) error
+	ResolveWithdrawal(ctx context.Context, order uint64, status, reason string) error
+	GetExpiredHolds(ctx context.Context, now time.Time, limit int) ([]uint64, error)
+}
+
+type TransferRepoInterface interface {
+	CreateTransfer(ctx context.Context, transfer *model.Transfer, limit model.TransferLimit) error
+	GetTransfers(ctx context.Context, userID int) ([]model.Transfer, error)
+}
+
+type OrderEventRepoInterface interface {
+	Listen(ctx context.Context, handle func(model.OrderEvent)) error
+	GetOrderEvents(ctx context.Context, userID int, sinceID, afterID int64, limit int) ([]model.OrderEvent, error)
+}
+
+type WebhookRepoInterface interface {
+	CreateWebhook(ctx context.Context, webhook *model.Webhook) error
+	GetWebhooks(ctx context.Context, userID int) ([]model.Webhook, error)
+	DeleteWebhook(ctx context.Context, userID int, id int64) error
+	ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]model.WebhookDelivery, error)
+	UpdateDelivery(ctx context.Context, delivery *model.WebhookDelivery) error
+	GetDeliveries(ctx context.Context, status string, limit int) ([]model.WebhookDelivery, error)
+	ReplayDelivery(ctx context.Context, id int64) error
 }
 
 type Repository struct {
-	Auth     AuthRepoInterface
-	Accrual  AccrualOrderRepoInterface
-	Withdraw WithdrawOrderRepoInterface
+	Auth        AuthRepoInterface
+	Token       TokenRepoInterface
+	Attempts    LoginAttemptRepoInterface
+	Lockout     LockoutRepoInterface
+	Admin       AdminRepoInterface
+	Ledger      LedgerRepoInterface
+	Idempotency IdempotencyRepoInterface
+	Accrual     AccrualOrderRepoInterface
+	Withdraw    WithdrawOrderRepoInterface
+	Transfer    TransferRepoInterface
+	Events      OrderEventRepoInterface
+	Webhook     WebhookRepoInterface
 }
 
 func NewRepository(db *sql.DB, log *zap.Logger) *Repository {
 	return &Repository{
-		Auth:     postgres.NewAuthPostgres(db, log),
-		Accrual:  postgres.NewAccrualOrderPostgres(db, log),
-		Withdraw: postgres.NewWithdrawOrderPostgres(db, log),
+		Auth:        postgres.NewAuthPostgres(db, log),
+		Token:       postgres.NewTokenPostgres(db, log),
+		Attempts:    memory.NewLoginAttempts(),
+		Lockout:     postgres.NewLockoutPostgres(db, log),
+		Admin:       postgres.NewAdminPostgres(db, log),
+		Ledger:      postgres.NewLedgerPostgres(db, log),
+		Idempotency: postgres.NewIdempotencyPostgres(db, log),
+		Accrual:     postgres.NewAccrualOrderPostgres(db, log),
+		Withdraw:    postgres.NewWithdrawOrderPostgres(db, log),
+		Transfer:    postgres.NewTransferPostgres(db, log),
+		Events:      postgres.NewOrderEventsPostgres(db, log),
+		Webhook:     postgres.NewWebhookPostgres(db, log),
 	}
 }
@@ -2,23 +2,33 @@ package service
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
 	"go.uber.org/zap"
 
 	"github.com/SversusN/gophermart/internal/model"
 	storage "github.com/SversusN/gophermart/internal/repository"
+	"github.com/SversusN/gophermart/pkg/cursor"
 	errs "github.com/SversusN/gophermart/pkg/errors"
 	"github.com/SversusN/gophermart/pkg/util"
 )
 
+// MaxOrdersLimit - наибольший размер страницы заказов
+const MaxOrdersLimit = 1000
+
 type AccrualOrderService struct {
-	repo storage.AccrualOrderRepoInterface
-	log  *zap.Logger
+	repo       storage.AccrualOrderRepoInterface
+	batchLimit int
+	log        *zap.Logger
 }
 
-func NewAccrualOrderService(repo storage.AccrualOrderRepoInterface, log *zap.Logger) *AccrualOrderService {
+func NewAccrualOrderService(repo storage.AccrualOrderRepoInterface, batchLimit int, log *zap.Logger) *AccrualOrderService {
 	return &AccrualOrderService{
-		repo: repo,
-		log:  log,
+		repo:       repo,
+		batchLimit: batchLimit,
+		log:        log,
 	}
 }
 
@@ -51,6 +61,44 @@ func (a *AccrualOrderService) LoadOrder(ctx context.Context, numOrder uint64, us
 	return nil
 }
 
+// LoadOrders загружает пачку номеров; неверные номера не мешают загрузке остальных
+func (a *AccrualOrderService) LoadOrders(ctx context.Context, userID int, numbers []string) ([]model.OrderUploadResult, error) {
+	if len(numbers) == 0 {
+		return nil, errs.ValidationError{Violations: []errs.Violation{
+			{Field: "orders", Rule: "required", Message: "at least one order number is required"}}}
+	}
+	if len(numbers) > a.batchLimit {
+		return nil, errs.ValidationError{Violations: []errs.Violation{
+			{Field: "orders", Rule: "max_items", Message: fmt.Sprintf("at most %d order numbers per request", a.batchLimit)}}}
+	}
+
+	results := make([]model.OrderUploadResult, len(numbers))
+	valid := make([]uint64, 0, len(numbers))
+	positions := make([]int, 0, len(numbers))
+	for i, raw := range numbers {
+		results[i] = model.OrderUploadResult{Number: raw, Result: model.OrderInvalid}
+		number, err := strconv.ParseUint(strings.TrimSpace(raw), 10, 64)
+		if err != nil || !util.ValidLuhn(number) {
+			continue
+		}
+		valid = append(valid, number)
+		positions = append(positions, i)
+	}
+	if len(valid) == 0 {
+		return results, nil
+	}
+
+	saved, err := a.repo.SaveOrders(ctx, userID, valid)
+	if err != nil {
+		a.log.Error("AccrualOrderService.LoadOrders: SaveOrders db error")
+		return nil, err
+	}
+	for i, result := range saved {
+		results[positions[i]].Result = result
+	}
+	return results, nil
+}
+
 func (a *AccrualOrderService) GetUploadedOrders(ctx context.Context, userID int) ([]model.AccrualOrder, error) {
 	orders, err := a.repo.GetUploadedOrders(ctx, userID)
 	if err != nil {
@@ -59,3 +107,62 @@ func (a *AccrualOrderService) GetUploadedOrders(ctx context.Context, userID int)
 	}
 	return orders, nil
 }
+
+// GetOrders - страница заказов пользователя. Без limit возвращаются все заказы после курсора,
+// как раньше возвращался весь список.
+func (a *AccrualOrderService) GetOrders(ctx context.Context, filter model.OrderFilter, after string) (*model.OrderPage, error) {
+	var violations []errs.Violation
+	if filter.Limit < 0 || filter.Limit > MaxOrdersLimit {
+		violations = append(violations, errs.Violation{Field: "limit", Rule: "range", Message: "limit must be between 1 and 1000"})
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		violations = append(violations, errs.Violation{Field: "from", Rule: "before_to", Message: "from must be before to"})
+	}
+	if after != "" {
+		filter.After = &model.OrderCursor{}
+		if cursor.Decode(after, filter.After) != nil || filter.After.Number == 0 {
+			violations = append(violations, errs.Violation{Field: "after", Rule: "valid", Message: "cursor is invalid"})
+		} else if filter.After.Descending != filter.Descending {
+			violations = append(violations, errs.Violation{Field: "after", Rule: "order", Message: "cursor was issued for a different order"})
+		}
+	}
+	if len(violations) > 0 {
+		return nil, errs.ValidationError{Violations: violations}
+	}
+	if filter.After == nil && filter.Limit == 0 && len(filter.Statuses) == 0 && filter.From.IsZero() && filter.To.IsZero() && !filter.Descending {
+		orders, err := a.GetUploadedOrders(ctx, filter.UserID)
+		if err != nil {
+			return nil, err
+		}
+		return &model.OrderPage{Orders: orders}, nil
+	}
+
+	// лишняя строка показывает, есть ли следующая страница
+	limit := filter.Limit
+	if limit > 0 {
+		filter.Limit++
+	}
+	orders, err := a.repo.GetOrders(ctx, filter)
+	if err != nil {
+		a.log.Error("AccrualOrderService.GetOrders: GetOrders db error")
+		return nil, err
+	}
+
+	page := &model.OrderPage{Orders: orders}
+	if limit > 0 && len(orders) > limit {
+		page.Orders = orders[:limit]
+		last := page.Orders[limit-1]
+		page.NextCursor = cursor.Encode(model.OrderCursor{UploadedAt: last.UploadedAt, Number: last.Number, Descending: filter.Descending})
+	}
+	return page, nil
+}
+
+func (a *AccrualOrderService) GetOrder(ctx context.Context, userID int, number uint64) (*model.OrderDetail, error) {
+	order, err := a.repo.GetOrder(ctx, userID, number)
+	switch err.(type) {
+	case nil, errs.OrderNotFoundError:
+	default:
+		a.log.Error("AccrualOrderService.GetOrder: GetOrder db error")
+	}
+	return order, err
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/SversusN/gophermart/internal/model"
+	storage "github.com/SversusN/gophermart/internal/repository"
+	errs "github.com/SversusN/gophermart/pkg/errors"
+)
+
+type AdminService struct {
+	repo storage.AdminRepoInterface
+	log  *zap.Logger
+}
+
+func NewAdminService(repo storage.AdminRepoInterface, log *zap.Logger) *AdminService {
+	return &AdminService{
+		repo: repo,
+		log:  log,
+	}
+}
+
+func (a *AdminService) GetUser(ctx context.Context, userID int) (*model.UserInfo, error) {
+	info, err := a.repo.GetUserInfo(ctx, userID)
+	if err != nil && !errors.As(err, &errs.UserNotFoundError{}) {
+		a.log.Error("AdminService.GetUser: GetUserInfo db error")
+	}
+	return info, err
+}
+
+func (a *AdminService) GetUserByLogin(ctx context.Context, login string) (*model.UserInfo, error) {
+	info, err := a.repo.GetUserInfoByLogin(ctx, login)
+	if err != nil && !errors.As(err, &errs.UserNotFoundError{}) {
+		a.log.Error("AdminService.GetUserByLogin: GetUserInfoByLogin db error")
+	}
+	return info, err
+}
+
+// RequeueOrder возвращает заказ агенту начислений в статусе NEW
+func (a *AdminService) RequeueOrder(ctx context.Context, number uint64, adminID int) error {
+	err := a.repo.RequeueOrder(ctx, number)
+	switch err.(type) {
+	case nil:
+		a.log.Info("AdminService.RequeueOrder: order requeued", zap.Uint64("order", number), zap.Int("admin_id", adminID))
+	case errs.OrderNotFoundError, errs.OrderAlreadyProcessedError:
+	default:
+		a.log.Error("AdminService.RequeueOrder: RequeueOrder db error")
+	}
+	return err
+}
+
+func (a *AdminService) AdjustBalance(ctx context.Context, adjustment *model.BalanceAdjustment) error {
+	adjustment.Reason = strings.TrimSpace(adjustment.Reason)
+	var violations []errs.Violation
+	if adjustment.Amount == 0 {
+		violations = append(violations, errs.Violation{Field: "amount", Rule: "non_zero", Message: "amount must not be zero"})
+	}
+	if adjustment.Reason == "" {
+		violations = append(violations, errs.Violation{Field: "reason", Rule: "required", Message: "reason is required"})
+	}
+	if len(violations) > 0 {
+		return errs.ValidationError{Violations: violations}
+	}
+
+	err := a.repo.AdjustBalance(ctx, adjustment)
+	switch err.(type) {
+	case nil:
+		a.log.Info("AdminService.AdjustBalance: balance adjusted",
+			zap.Int("user_id", adjustment.UserID), zap.Int("admin_id", adjustment.AdminID),
+			zap.Stringer("amount", adjustment.Amount), zap.String("reason", adjustment.Reason))
+	case errs.UserNotFoundError, errs.ShowMeTheMoney:
+	default:
+		a.log.Error("AdminService.AdjustBalance: AdjustBalance db error")
+	}
+	return err
+}
@@ -2,62 +2,174 @@ package service
 
 import (
 	"context"
-	"crypto/sha1"
-	"fmt"
-	"github.com/go-chi/jwtauth/v5"
+	"errors"
+	"sync"
+
 	"go.uber.org/zap"
 
 	"github.com/SversusN/gophermart/internal/model"
-)
-
-const (
-	secretKey = "be55d1079e6c6167118ac91318fe"
+	errs "github.com/SversusN/gophermart/pkg/errors"
+	"github.com/SversusN/gophermart/pkg/hasher"
 )
 
 type AuthRepoContract interface {
 	CreateUser(ctx context.Context, user *model.User) (int, error)
-	GetUserID(ctx context.Context, user *model.User) (int, error)
+	GetUserByLogin(ctx context.Context, login string) (*model.User, error)
+	GetUserByID(ctx context.Context, userID int) (*model.User, error)
+	UpdatePassword(ctx context.Context, userID int, passwordHash string) error
+	ChangePassword(ctx context.Context, userID int, passwordHash string) error
+	DeleteUser(ctx context.Context, userID int, force bool) error
 }
 
+// dummyPassword - пароль хеша, с которым сверяется вход под неизвестным логином
+const dummyPassword = "gophermart-dummy-password"
+
 type AuthService struct {
-	repo AuthRepoContract
-	log  *zap.Logger
+	repo   AuthRepoContract
+	hasher hasher.PasswordHasher
+	policy CredentialsPolicy
+	log    *zap.Logger
+	// dummyHash считается при первом входе под неизвестным логином, а не при старте
+	dummyOnce sync.Once
+	dummyHash string
 }
 
-func NewAuthService(repo AuthRepoContract, log *zap.Logger) *AuthService {
+func NewAuthService(repo AuthRepoContract, hasher hasher.PasswordHasher, policy CredentialsPolicy, log *zap.Logger) *AuthService {
 	return &AuthService{
-		repo: repo,
-		log:  log,
+		repo:   repo,
+		hasher: hasher,
+		policy: policy,
+		log:    log,
 	}
 }
 
+func (auth *AuthService) NormalizeLogin(login string) string {
+	return auth.policy.NormalizeLogin(login)
+}
+
 func (auth *AuthService) CreateUser(ctx context.Context, user *model.User) error {
-	user.Password = auth.generatePasswordHash(user.Password)
+	user.Login = auth.policy.NormalizeLogin(user.Login)
+	if err := auth.policy.Validate(user); err != nil {
+		return err
+	}
+
+	hash, err := auth.hasher.Hash(user.Password)
+	if err != nil {
+		return err
+	}
+	user.Password = hash
 	userID, err := auth.repo.CreateUser(ctx, user)
 	if err != nil {
 		return err
 	}
 	user.ID = userID
+	user.Role = model.RoleUser
 	return nil
 }
 
+// AuthenticationUser не применяет политику паролей: пользователи, зарегистрированные
+// до ее введения, должны входить как раньше
 func (auth *AuthService) AuthenticationUser(ctx context.Context, user *model.User) error {
-	user.Password = auth.generatePasswordHash(user.Password)
-	userID, err := auth.repo.GetUserID(ctx, user)
+	stored, err := auth.findUser(ctx, user.Login)
 	if err != nil {
+		if errors.As(err, &errs.AuthenticationError{}) {
+			// неизвестный логин проверяется так же долго, как известный: по времени ответа не узнать, есть ли аккаунт
+			_, _ = auth.hasher.Verify(user.Password, auth.dummy())
+		}
 		return err
 	}
-	user.ID = userID
+
+	ok, err := auth.hasher.Verify(user.Password, stored.Password)
+	if err != nil {
+		auth.log.Error("AuthService.AuthenticationUser: stored password hash error", zap.Int("user_id", stored.ID), zap.Error(err))
+		return errs.AuthenticationError{}
+	}
+	if !ok {
+		return errs.AuthenticationError{}
+	}
+
+	//пароль верный - самое время перехешировать устаревший хеш
+	if auth.hasher.NeedsRehash(stored.Password) {
+		auth.rehash(ctx, stored.ID, user.Password)
+	}
+
+	user.ID = stored.ID
+	user.Role = stored.Role
+	user.Password = ""
 	return nil
 }
 
-func (auth *AuthService) GenerateToken(user *model.User, tokenAuth *jwtauth.JWTAuth) (string, error) {
-	_, tokenString, err := tokenAuth.Encode(map[string]interface{}{"user_id": user.ID})
-	return tokenString, err
+// ChangePassword проверяет текущий пароль, применяет политику к новому
+// и отзывает все сессии пользователя
+func (auth *AuthService) ChangePassword(ctx context.Context, userID int, current, newPassword string) error {
+	stored, err := auth.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	ok, err := auth.hasher.Verify(current, stored.Password)
+	if err != nil || !ok {
+		return errs.AuthenticationError{}
+	}
+
+	if err = auth.policy.Validate(&model.User{Login: stored.Login, Password: newPassword}); err != nil {
+		return err
+	}
+	hash, err := auth.hasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+	if err = auth.repo.ChangePassword(ctx, userID, hash); err != nil {
+		auth.log.Error("AuthService.ChangePassword: ChangePassword db error")
+		return err
+	}
+	return nil
 }
 
-func (auth *AuthService) generatePasswordHash(password string) string {
-	hash := sha1.New()
-	hash.Write([]byte(password))
-	return fmt.Sprintf("%x", hash.Sum([]byte(secretKey)))
+// DeleteUser обезличивает аккаунт; при положительном балансе без force отказывает
+func (auth *AuthService) DeleteUser(ctx context.Context, userID int, force bool) error {
+	err := auth.repo.DeleteUser(ctx, userID, force)
+	if err != nil {
+		if !errors.As(err, &errs.PositiveBalanceError{}) {
+			auth.log.Error("AuthService.DeleteUser: DeleteUser db error")
+		}
+		return err
+	}
+	auth.log.Info("AuthService.DeleteUser: account deleted", zap.Int("user_id", userID), zap.Bool("force", force))
+	return nil
+}
+
+// findUser ищет по нормализованному логину, а для старых аккаунтов,
+// зарегистрированных до нормализации, - по логину как есть
+func (auth *AuthService) findUser(ctx context.Context, login string) (*model.User, error) {
+	normalized := auth.policy.NormalizeLogin(login)
+	stored, err := auth.repo.GetUserByLogin(ctx, normalized)
+	if errors.As(err, &errs.AuthenticationError{}) && normalized != login {
+		return auth.repo.GetUserByLogin(ctx, login)
+	}
+	return stored, err
+}
+
+// dummy - хеш текущего алгоритма для сверки при неизвестном логине
+func (auth *AuthService) dummy() string {
+	auth.dummyOnce.Do(func() {
+		hash, err := auth.hasher.Hash(dummyPassword)
+		if err != nil {
+			auth.log.Error("AuthService.dummy: hash error", zap.Error(err))
+			return
+		}
+		auth.dummyHash = hash
+	})
+	return auth.dummyHash
+}
+
+// rehash failures must not block the login, the user is migrated next time.
+func (auth *AuthService) rehash(ctx context.Context, userID int, password string) {
+	hash, err := auth.hasher.Hash(password)
+	if err != nil {
+		auth.log.Error("AuthService.rehash: hash error", zap.Int("user_id", userID), zap.Error(err))
+		return
+	}
+	if err = auth.repo.UpdatePassword(ctx, userID, hash); err != nil {
+		auth.log.Error("AuthService.rehash: UpdatePassword db error", zap.Int("user_id", userID), zap.Error(err))
+	}
 }
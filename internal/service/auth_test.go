@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/SversusN/gophermart/internal/model"
+	errs "github.com/SversusN/gophermart/pkg/errors"
+	"github.com/SversusN/gophermart/pkg/hasher"
+)
+
+// fakeUsers - пользователи в памяти по логину
+type fakeUsers struct {
+	AuthRepoContract
+	users map[string]model.User
+}
+
+func (f *fakeUsers) GetUserByLogin(_ context.Context, login string) (*model.User, error) {
+	user, ok := f.users[login]
+	if !ok {
+		return nil, errs.AuthenticationError{}
+	}
+	return &user, nil
+}
+
+// countingHasher считает хеширования и сверки паролей
+type countingHasher struct {
+	hasher.PasswordHasher
+	hashes   int
+	verified []string
+}
+
+func (h *countingHasher) Hash(password string) (string, error) {
+	h.hashes++
+	return h.PasswordHasher.Hash(password)
+}
+
+func (h *countingHasher) Verify(password, encoded string) (bool, error) {
+	h.verified = append(h.verified, encoded)
+	return h.PasswordHasher.Verify(password, encoded)
+}
+
+func TestAuthenticationUnknownLogin(t *testing.T) {
+	hashes := &countingHasher{PasswordHasher: hasher.NewBcrypt(bcrypt.MinCost)}
+	stored, err := hashes.PasswordHasher.Hash("secret")
+	require.NoError(t, err)
+	repo := &fakeUsers{users: map[string]model.User{"gopher": {ID: 1, Login: "gopher", Password: stored}}}
+	auth := NewAuthService(repo, hashes, CredentialsPolicy{}, zap.NewNop())
+
+	// неизвестный логин сверяется с хешем того же алгоритма, что и настоящий пароль
+	for i := 0; i < 2; i++ {
+		err = auth.AuthenticationUser(context.Background(), &model.User{Login: "stranger", Password: "secret"})
+		assert.ErrorIs(t, err, errs.AuthenticationError{})
+	}
+	require.Len(t, hashes.verified, 2)
+	assert.False(t, hashes.NeedsRehash(hashes.verified[0]))
+	assert.Equal(t, hashes.verified[0], hashes.verified[1])
+	assert.Equal(t, 1, hashes.hashes, "dummy hash is computed once")
+
+	user := &model.User{Login: "gopher", Password: "secret"}
+	require.NoError(t, auth.AuthenticationUser(context.Background(), user))
+	assert.Equal(t, 1, user.ID)
+	assert.Equal(t, stored, hashes.verified[2])
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/SversusN/gophermart/internal/model"
+	storage "github.com/SversusN/gophermart/internal/repository"
+)
+
+const (
+	// orderEventBuffer - сколько событий может ждать медленный подписчик, прежде чем его отключат
+	orderEventBuffer = 16
+	// orderEventReplayPage - сколько пропущенных событий читается из истории за один запрос
+	orderEventReplayPage = 500
+	// orderListenRetry - пауза перед повторной подпиской после обрыва соединения с базой
+	orderListenRetry = 5 * time.Second
+)
+
+// OrderEventHub держит одну подписку LISTEN на реплику и раздаёт события подключённым пользователям.
+// Подписчик, который не успевает читать или пропустил события из-за обрыва подписки, отключается:
+// клиент переподключится с Last-Event-ID и дочитает пропущенное из истории
+type OrderEventHub struct {
+	repo        storage.OrderEventRepoInterface
+	log         *zap.Logger
+	mu          sync.Mutex
+	subscribers map[int]map[chan model.OrderEvent]struct{}
+}
+
+func NewOrderEventHub(repo storage.OrderEventRepoInterface, log *zap.Logger) *OrderEventHub {
+	return &OrderEventHub{
+		repo:        repo,
+		log:         log,
+		subscribers: make(map[int]map[chan model.OrderEvent]struct{}),
+	}
+}
+
+func (h *OrderEventHub) Start(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			err := h.repo.Listen(ctx, h.publish)
+			h.disconnectAll()
+			if ctx.Err() != nil {
+				return
+			}
+			h.log.Error("OrderEventHub.Start: listen error", zap.Error(err))
+			select {
+			case <-time.After(orderListenRetry):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Subscribe возвращает канал событий пользователя и функцию отписки; канал закрывается при отключении
+func (h *OrderEventHub) Subscribe(userID int) (<-chan model.OrderEvent, func()) {
+	ch := make(chan model.OrderEvent, orderEventBuffer)
+	h.mu.Lock()
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = make(map[chan model.OrderEvent]struct{})
+	}
+	h.subscribers[userID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.remove(userID, ch)
+	}
+}
+
+// Replay - страница событий пользователя, пропущенных после lastEventID, с id больше cursor;
+// more сообщает, что за страницей есть ещё события
+func (h *OrderEventHub) Replay(ctx context.Context, userID int, lastEventID, cursor int64) (events []model.OrderEvent, more bool, err error) {
+	events, err = h.repo.GetOrderEvents(ctx, userID, lastEventID, cursor, orderEventReplayPage)
+	if err != nil {
+		h.log.Error("OrderEventHub.Replay: GetOrderEvents db error")
+		return nil, false, err
+	}
+	return events, len(events) == orderEventReplayPage, nil
+}
+
+func (h *OrderEventHub) publish(event model.OrderEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers[event.UserID] {
+		select {
+		case ch <- event:
+		default:
+			h.remove(event.UserID, ch)
+		}
+	}
+}
+
+func (h *OrderEventHub) disconnectAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for userID, channels := range h.subscribers {
+		for ch := range channels {
+			h.remove(userID, ch)
+		}
+	}
+}
+
+// remove отключает подписчика; вызывается под мьютексом
+func (h *OrderEventHub) remove(userID int, ch chan model.OrderEvent) {
+	channels, ok := h.subscribers[userID]
+	if !ok {
+		return
+	}
+	if _, ok = channels[ch]; !ok {
+		return
+	}
+	delete(channels, ch)
+	close(ch)
+	if len(channels) == 0 {
+		delete(h.subscribers, userID)
+	}
+}
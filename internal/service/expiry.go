@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/SversusN/gophermart/internal/model"
+	storage "github.com/SversusN/gophermart/internal/repository"
+)
+
+// expiryBatchSize - сколько партий сгорает за один проход
+const expiryBatchSize = 100
+
+// PointExpirer списывает партии баллов, срок жизни которых истек
+type PointExpirer struct {
+	repo     storage.LedgerRepoInterface
+	policy   PointsPolicy
+	interval time.Duration
+	log      *zap.Logger
+}
+
+func NewPointExpirer(repo storage.LedgerRepoInterface, policy PointsPolicy, interval time.Duration, log *zap.Logger) *PointExpirer {
+	return &PointExpirer{
+		repo:     repo,
+		policy:   policy,
+		interval: interval,
+		log:      log,
+	}
+}
+
+func (e *PointExpirer) Start(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				e.ExpirePoints(ctx, time.Now())
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// ExpirePoints списывает партии, срок которых истек к моменту now, и возвращает сгоревшую сумму
+func (e *PointExpirer) ExpirePoints(ctx context.Context, now time.Time) model.Money {
+	if e.policy.LifetimeMonths == 0 {
+		return 0
+	}
+	var total model.Money
+	for {
+		lots, err := e.repo.GetExpiredLots(ctx, e.policy.earnedBefore(now), expiryBatchSize)
+		if err != nil {
+			e.log.Error("PointExpirer.ExpirePoints: GetExpiredLots db error")
+			break
+		}
+		due := 0
+		for i := range lots {
+			// граница по месяцам не обратима точно: в выборку попадают партии конца месяца, которым сгорать
+			// на днях. Партии идут по дате, поэтому дальше в выборке только такие
+			if e.policy.expiresAt(lots[i].EarnedAt).After(now) {
+				break
+			}
+			due++
+			expired, err := e.repo.ExpireLot(ctx, &lots[i])
+			if err != nil {
+				e.log.Error("PointExpirer.ExpirePoints: ExpireLot db error", zap.Int64("lot", lots[i].ID))
+				return total
+			}
+			total += expired
+		}
+		if due < expiryBatchSize {
+			break
+		}
+	}
+	if total > 0 {
+		e.log.Info("PointExpirer.ExpirePoints: points expired", zap.Stringer("amount", total))
+	}
+	return total
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/SversusN/gophermart/internal/model"
+	storage "github.com/SversusN/gophermart/internal/repository"
+)
+
+// fakeLots - партии в памяти вместо базы; остальные методы журнала не нужны
+type fakeLots struct {
+	storage.LedgerRepoInterface
+	lots      []model.PointLot
+	expired   map[int64]bool
+	queries   int
+	failOnLot int64
+}
+
+func newFakeLots(earnedAt ...time.Time) *fakeLots {
+	f := &fakeLots{expired: make(map[int64]bool)}
+	for i, at := range earnedAt {
+		f.lots = append(f.lots, model.PointLot{ID: int64(i + 1), UserID: 1, Remaining: model.Point, EarnedAt: at})
+	}
+	sort.SliceStable(f.lots, func(i, j int) bool { return f.lots[i].EarnedAt.Before(f.lots[j].EarnedAt) })
+	return f
+}
+
+func (f *fakeLots) GetExpiredLots(_ context.Context, earnedBefore time.Time, limit int) ([]model.PointLot, error) {
+	f.queries++
+	var lots []model.PointLot
+	for _, lot := range f.lots {
+		if !f.expired[lot.ID] && lot.EarnedAt.Before(earnedBefore) && len(lots) < limit {
+			lots = append(lots, lot)
+		}
+	}
+	return lots, nil
+}
+
+func (f *fakeLots) ExpireLot(_ context.Context, lot *model.PointLot) (model.Money, error) {
+	if lot.ID == f.failOnLot {
+		return 0, errors.New("db is down")
+	}
+	if f.expired[lot.ID] {
+		return 0, nil
+	}
+	f.expired[lot.ID] = true
+	return lot.Remaining, nil
+}
+
+func repeatTime(at time.Time, n int) []time.Time {
+	times := make([]time.Time, n)
+	for i := range times {
+		times[i] = at
+	}
+	return times
+}
+
+func TestExpirePointsBatches(t *testing.T) {
+	now := time.Date(2024, time.June, 15, 12, 0, 0, 0, time.UTC)
+	policy := PointsPolicy{LifetimeMonths: 12}
+	old := now.AddDate(-2, 0, 0)
+
+	tests := []struct {
+		name    string
+		lots    []time.Time
+		expired model.Money
+		queries int
+	}{
+		{name: "Nothing to expire", queries: 1},
+		{name: "Partial batch", lots: repeatTime(old, 30), expired: 30 * model.Point, queries: 1},
+		// полная пачка может быть не последней: нужен еще один запрос
+		{name: "Exactly one batch", lots: repeatTime(old, expiryBatchSize), expired: expiryBatchSize * model.Point, queries: 2},
+		{name: "Several batches", lots: repeatTime(old, 2*expiryBatchSize+50), expired: (2*expiryBatchSize + 50) * model.Point, queries: 3},
+		{
+			name:    "Fresh lots stay",
+			lots:    append(repeatTime(old, 10), repeatTime(now.AddDate(0, -6, 0), 10)...),
+			expired: 10 * model.Point, queries: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeLots(tt.lots...)
+			expirer := NewPointExpirer(repo, policy, time.Hour, zap.NewNop())
+			assert.Equal(t, tt.expired, expirer.ExpirePoints(context.Background(), now))
+			assert.Equal(t, tt.queries, repo.queries)
+		})
+	}
+}
+
+func TestExpirePointsMonthEnd(t *testing.T) {
+	// 30 января + месяц = 2 марта, а выборка за 1 марта берет все полученное до 1 февраля
+	now := time.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC)
+	due := time.Date(2023, time.January, 28, 12, 0, 0, 0, time.UTC)
+	notYet := time.Date(2023, time.January, 30, 12, 0, 0, 0, time.UTC)
+	// полная пачка партий, которым сгорать завтра, не зацикливает проход
+	repo := newFakeLots(append([]time.Time{due}, repeatTime(notYet, expiryBatchSize)...)...)
+	expirer := NewPointExpirer(repo, PointsPolicy{LifetimeMonths: 1}, time.Hour, zap.NewNop())
+
+	assert.Equal(t, model.Point, expirer.ExpirePoints(context.Background(), now))
+	assert.Equal(t, 1, repo.queries)
+	assert.Len(t, repo.expired, 1)
+
+	// на следующий день после срока сгорают и они
+	assert.Equal(t, expiryBatchSize*model.Point, expirer.ExpirePoints(context.Background(), notYet.AddDate(0, 1, 1)))
+}
+
+func TestExpirePointsStopsOnError(t *testing.T) {
+	now := time.Date(2024, time.June, 15, 12, 0, 0, 0, time.UTC)
+	repo := newFakeLots(repeatTime(now.AddDate(-2, 0, 0), 5)...)
+	repo.failOnLot = 3
+	expirer := NewPointExpirer(repo, PointsPolicy{LifetimeMonths: 12}, time.Hour, zap.NewNop())
+
+	assert.Equal(t, 2*model.Point, expirer.ExpirePoints(context.Background(), now))
+	assert.Equal(t, 1, repo.queries)
+
+	// без срока жизни баллы не сгорают и база не опрашивается
+	expirer = NewPointExpirer(repo, PointsPolicy{}, time.Hour, zap.NewNop())
+	assert.Zero(t, expirer.ExpirePoints(context.Background(), now))
+	assert.Equal(t, 1, repo.queries)
+}
+
+func TestPointsPolicyMonths(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 10, 30, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name     string
+		months   int
+		earnedAt time.Time
+		expires  time.Time
+	}{
+		{name: "Same day a year later", months: 12, earnedAt: date(2023, time.May, 15), expires: date(2024, time.May, 15)},
+		{name: "Across the year end", months: 3, earnedAt: date(2023, time.November, 20), expires: date(2024, time.February, 20)},
+		// несуществующий день переносится вперед, как в time.AddDate
+		{name: "Month end", months: 1, earnedAt: date(2023, time.January, 31), expires: date(2023, time.March, 3)},
+		{name: "Leap day", months: 12, earnedAt: date(2024, time.February, 29), expires: date(2025, time.March, 1)},
+		{name: "Into a leap February", months: 1, earnedAt: date(2024, time.January, 29), expires: date(2024, time.February, 29)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := PointsPolicy{LifetimeMonths: tt.months}
+			assert.Equal(t, tt.expires, policy.expiresAt(tt.earnedAt))
+		})
+	}
+
+	// выборка по earnedBefore не пропускает ни одной сгоревшей партии
+	for _, months := range []int{1, 3, 12} {
+		policy := PointsPolicy{LifetimeMonths: months}
+		start := date(2023, time.January, 1)
+		for earned := start; earned.Before(start.AddDate(2, 0, 0)); earned = earned.AddDate(0, 0, 1) {
+			expires := policy.expiresAt(earned)
+			require.True(t, earned.Before(policy.earnedBefore(expires.Add(time.Second))),
+				"lot earned %s expires %s but is not selected", earned, expires)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/SversusN/gophermart/internal/model"
+	storage "github.com/SversusN/gophermart/internal/repository"
+	errs "github.com/SversusN/gophermart/pkg/errors"
+)
+
+const (
+	loginKeyPrefix = "login:"
+	ipKeyPrefix    = "ip:"
+)
+
+type LoginGuardPolicy struct {
+	// после DelayAfter неудач каждая следующая попытка ждет BaseDelay*2^n
+	DelayAfter int
+	BaseDelay  time.Duration
+	// начиная с MaxFailures (по логину) или MaxIPFailures (по IP) неудач вход блокируется на Lockout
+	MaxFailures   int
+	MaxIPFailures int
+	Lockout       time.Duration
+	// счетчик сбрасывается, если неудач не было дольше Window
+	Window time.Duration
+}
+
+// LoginGuard защищает вход от перебора паролей
+type LoginGuard struct {
+	attempts storage.LoginAttemptRepoInterface
+	lockouts storage.LockoutRepoInterface
+	policy   LoginGuardPolicy
+	log      *zap.Logger
+}
+
+func NewLoginGuard(attempts storage.LoginAttemptRepoInterface, lockouts storage.LockoutRepoInterface, policy LoginGuardPolicy, log *zap.Logger) *LoginGuard {
+	return &LoginGuard{
+		attempts: attempts,
+		lockouts: lockouts,
+		policy:   policy,
+		log:      log,
+	}
+}
+
+// Check возвращает TooManyAttemptsError, если попытку входа надо отклонить не проверяя пароль
+func (g *LoginGuard) Check(ctx context.Context, login, ip string) error {
+	now := time.Now()
+	var wait time.Duration
+	for _, key := range []string{loginKeyPrefix + login, ipKeyPrefix + ip} {
+		a, err := g.attempts.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		if d := g.retryAfter(a, now); d > wait {
+			wait = d
+		}
+	}
+	if wait > 0 {
+		return errs.TooManyAttemptsError{RetryAfter: wait}
+	}
+	return nil
+}
+
+func (g *LoginGuard) Fail(ctx context.Context, login, ip string) error {
+	now := time.Now()
+	if err := g.fail(ctx, loginKeyPrefix+login, g.policy.MaxFailures, now, &model.Lockout{Login: login, IP: ip}); err != nil {
+		return err
+	}
+	return g.fail(ctx, ipKeyPrefix+ip, g.policy.MaxIPFailures, now, &model.Lockout{IP: ip})
+}
+
+// Succeed сбрасывает счетчик логина; счетчик IP не сбрасывается,
+// иначе вход в свой аккаунт обнулял бы перебор чужих
+func (g *LoginGuard) Succeed(ctx context.Context, login string) error {
+	return g.attempts.Reset(ctx, loginKeyPrefix+login)
+}
+
+// Unlock снимает блокировку логина; блокировка IP, с которого шел перебор, остается
+func (g *LoginGuard) Unlock(ctx context.Context, login string, unlockedBy int) error {
+	if err := g.attempts.Reset(ctx, loginKeyPrefix+login); err != nil {
+		return err
+	}
+	return g.lockouts.MarkUnlocked(ctx, login, unlockedBy)
+}
+
+// UnlockIP снимает блокировку IP, например общего адреса офиса за NAT
+func (g *LoginGuard) UnlockIP(ctx context.Context, ip string, unlockedBy int) error {
+	if err := g.attempts.Reset(ctx, ipKeyPrefix+ip); err != nil {
+		return err
+	}
+	return g.lockouts.MarkIPUnlocked(ctx, ip, unlockedBy)
+}
+
+func (g *LoginGuard) GetActiveLockouts(ctx context.Context) ([]model.Lockout, error) {
+	return g.lockouts.GetActiveLockouts(ctx)
+}
+
+func (g *LoginGuard) fail(ctx context.Context, key string, maxFailures int, now time.Time, lockout *model.Lockout) error {
+	a, locked, err := g.attempts.RegisterFailure(ctx, key, now,
+		model.AttemptLimit{Window: g.policy.Window, MaxFailures: maxFailures, Lockout: g.policy.Lockout})
+	if err != nil || !locked {
+		return err
+	}
+
+	lockout.Failures = a.Failures
+	lockout.LockedUntil = a.LockedUntil
+	g.log.Warn("LoginGuard: login locked", zap.String("login", lockout.Login), zap.String("ip", lockout.IP))
+	if err = g.lockouts.RecordLockout(ctx, lockout); err != nil {
+		g.log.Error("LoginGuard.fail: RecordLockout db error")
+	}
+	return nil
+}
+
+func (g *LoginGuard) retryAfter(a model.LoginAttempts, now time.Time) time.Duration {
+	if now.Before(a.LockedUntil) {
+		return a.LockedUntil.Sub(now)
+	}
+	if g.policy.DelayAfter <= 0 || a.Failures < g.policy.DelayAfter || now.Sub(a.LastFailure) > g.policy.Window {
+		return 0
+	}
+	delay := g.policy.BaseDelay
+	for i := g.policy.DelayAfter; i < a.Failures && delay < g.policy.Lockout; i++ {
+		delay *= 2
+	}
+	if delay > g.policy.Lockout {
+		delay = g.policy.Lockout
+	}
+	return a.LastFailure.Add(delay).Sub(now)
+}
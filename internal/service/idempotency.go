@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/SversusN/gophermart/internal/model"
+	storage "github.com/SversusN/gophermart/internal/repository"
+	errs "github.com/SversusN/gophermart/pkg/errors"
+)
+
+// idempotencyPurgeInterval - как часто удалять просроченные ключи
+const idempotencyPurgeInterval = time.Minute
+
+type IdempotencyService struct {
+	repo storage.IdempotencyRepoInterface
+	ttl  time.Duration
+	log  *zap.Logger
+
+	mu        sync.Mutex
+	lastPurge time.Time
+}
+
+func NewIdempotencyService(repo storage.IdempotencyRepoInterface, ttl time.Duration, log *zap.Logger) *IdempotencyService {
+	return &IdempotencyService{
+		repo: repo,
+		ttl:  ttl,
+		log:  log,
+	}
+}
+
+// Begin занимает ключ за запросом. Если по ключу уже есть готовый ответ, он возвращается для повтора.
+// Тот же ключ с другим телом запроса - errs.IdempotencyKeyReusedError,
+// ключ, запрос по которому еще выполняется, - errs.IdempotencyKeyInProgressError.
+func (i *IdempotencyService) Begin(ctx context.Context, userID int, key, requestHash string) (*model.IdempotencyRecord, error) {
+	i.purgeExpired(ctx)
+
+	existing, err := i.repo.Reserve(ctx, &model.IdempotencyRecord{
+		UserID:      userID,
+		Key:         key,
+		RequestHash: requestHash,
+		ExpiresAt:   time.Now().Add(i.ttl),
+	})
+	if err != nil {
+		i.log.Error("IdempotencyService.Begin: Reserve db error")
+		return nil, err
+	}
+	if existing == nil {
+		return nil, nil
+	}
+	if existing.RequestHash != requestHash {
+		return nil, errs.IdempotencyKeyReusedError{}
+	}
+	if !existing.Completed() {
+		return nil, errs.IdempotencyKeyInProgressError{}
+	}
+	return existing, nil
+}
+
+func (i *IdempotencyService) Complete(ctx context.Context, record *model.IdempotencyRecord) error {
+	err := i.repo.Complete(ctx, record)
+	if err != nil {
+		i.log.Error("IdempotencyService.Complete: Complete db error")
+	}
+	return err
+}
+
+func (i *IdempotencyService) Release(ctx context.Context, userID int, key string) error {
+	err := i.repo.Release(ctx, userID, key)
+	if err != nil {
+		i.log.Error("IdempotencyService.Release: Release db error")
+	}
+	return err
+}
+
+func (i *IdempotencyService) purgeExpired(ctx context.Context) {
+	i.mu.Lock()
+	if time.Since(i.lastPurge) < idempotencyPurgeInterval {
+		i.mu.Unlock()
+		return
+	}
+	i.lastPurge = time.Now()
+	i.mu.Unlock()
+
+	deleted, err := i.repo.DeleteExpired(ctx)
+	if err != nil {
+		i.log.Error("IdempotencyService.purgeExpired: DeleteExpired db error")
+		return
+	}
+	if deleted > 0 {
+		i.log.Debug("IdempotencyService.purgeExpired: expired keys deleted", zap.Int64("count", deleted))
+	}
+}
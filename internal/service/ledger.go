@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/SversusN/gophermart/internal/model"
+	storage "github.com/SversusN/gophermart/internal/repository"
+	"github.com/SversusN/gophermart/pkg/cursor"
+	errs "github.com/SversusN/gophermart/pkg/errors"
+)
+
+// Размер страницы истории операций
+const (
+	DefaultTransactionsLimit = 50
+	MaxTransactionsLimit     = 200
+)
+
+// PointsPolicy - срок жизни начисленных баллов
+type PointsPolicy struct {
+	// LifetimeMonths - через сколько месяцев сгорает партия, 0 - баллы не сгорают
+	LifetimeMonths int
+	// ExpiryNotice - за сколько до сгорания баллы попадают в expiring_soon
+	ExpiryNotice time.Duration
+}
+
+// expiresAt - когда сгорит партия, полученная в earnedAt
+func (p PointsPolicy) expiresAt(earnedAt time.Time) time.Time {
+	return earnedAt.AddDate(0, p.LifetimeMonths, 0)
+}
+
+// earnedBefore - партии, полученные раньше этого момента, к моменту t уже сгорели
+func (p PointsPolicy) earnedBefore(t time.Time) time.Time {
+	return t.AddDate(0, -p.LifetimeMonths, 0)
+}
+
+type LedgerService struct {
+	repo   storage.LedgerRepoInterface
+	policy PointsPolicy
+	log    *zap.Logger
+}
+
+func NewLedgerService(repo storage.LedgerRepoInterface, policy PointsPolicy, log *zap.Logger) *LedgerService {
+	return &LedgerService{
+		repo:   repo,
+		policy: policy,
+		log:    log,
+	}
+}
+
+// GetBalance - баланс пользователя по журналу
+func (l *LedgerService) GetBalance(ctx context.Context, userID int) (*model.Balance, error) {
+	balance, err := l.repo.GetBalance(ctx, userID)
+	if err != nil {
+		l.log.Error("LedgerService.GetBalance: GetBalance db error")
+		return nil, err
+	}
+	if l.policy.LifetimeMonths == 0 || balance.Current <= 0 {
+		return balance, nil
+	}
+
+	until := time.Now().Add(l.policy.ExpiryNotice)
+	// с запасом в сутки: граница по месяцам не обратима точно, поэтому проверяется по каждой партии
+	lots, err := l.repo.GetExpiringLots(ctx, userID, l.policy.earnedBefore(until).AddDate(0, 0, 1))
+	if err != nil {
+		l.log.Error("LedgerService.GetBalance: GetExpiringLots db error")
+		return nil, err
+	}
+	for _, lot := range lots {
+		expiresAt := l.policy.expiresAt(lot.EarnedAt)
+		if expiresAt.After(until) {
+			continue
+		}
+		balance.ExpiringSoon = append(balance.ExpiringSoon, model.ExpiringPoints{Amount: lot.Remaining, ExpiresAt: expiresAt})
+	}
+	return balance, nil
+}
+
+// Reconcile сверяет журнал с устаревшими колонками баланса в users
+func (l *LedgerService) Reconcile(ctx context.Context) ([]model.BalanceDrift, error) {
+	drifts, err := l.repo.Reconcile(ctx)
+	if err != nil {
+		l.log.Error("LedgerService.Reconcile: Reconcile db error")
+		return nil, err
+	}
+	if len(drifts) > 0 {
+		l.log.Warn("LedgerService.Reconcile: ledger drift detected", zap.Int("users", len(drifts)))
+	}
+	return drifts, nil
+}
+
+// GetTransactions - страница истории операций. Курсор - позиция, выданная предыдущей страницей;
+// с ним фильтры нужно передавать те же, что и для первой страницы.
+func (l *LedgerService) GetTransactions(ctx context.Context, filter model.TransactionFilter, after string) (*model.TransactionPage, error) {
+	var violations []errs.Violation
+	if filter.Limit == 0 {
+		filter.Limit = DefaultTransactionsLimit
+	}
+	if filter.Limit < 0 || filter.Limit > MaxTransactionsLimit {
+		violations = append(violations, errs.Violation{Field: "limit", Rule: "range", Message: "limit must be between 1 and 200"})
+	}
+	for _, kind := range filter.Types {
+		if !slices.Contains(model.LedgerKinds, kind) {
+			violations = append(violations, errs.Violation{Field: "type", Rule: "one_of", Message: "unknown transaction type " + kind})
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		violations = append(violations, errs.Violation{Field: "from", Rule: "before_to", Message: "from must be before to"})
+	}
+	if after != "" && cursor.Decode(after, &filter.BeforeID) != nil {
+		violations = append(violations, errs.Violation{Field: "cursor", Rule: "valid", Message: "cursor is invalid"})
+	}
+	if len(violations) > 0 {
+		return nil, errs.ValidationError{Violations: violations}
+	}
+
+	// лишняя строка показывает, есть ли следующая страница
+	limit := filter.Limit
+	filter.Limit++
+	transactions, err := l.repo.GetTransactions(ctx, filter)
+	if err != nil {
+		l.log.Error("LedgerService.GetTransactions: GetTransactions db error")
+		return nil, err
+	}
+
+	page := &model.TransactionPage{Transactions: transactions}
+	if len(transactions) > limit {
+		page.Transactions = transactions[:limit]
+		page.NextCursor = cursor.Encode(page.Transactions[limit-1].ID)
+	}
+	if page.Transactions == nil {
+		page.Transactions = []model.Transaction{}
+	}
+	return page, nil
+}
@@ -2,40 +2,168 @@ package service
 
 import (
 	"context"
-	"github.com/go-chi/jwtauth/v5"
+	"regexp"
+	"sync"
+
 	"go.uber.org/zap"
 
+	"github.com/SversusN/gophermart/config"
 	"github.com/SversusN/gophermart/internal/model"
 	"github.com/SversusN/gophermart/internal/repository"
+	"github.com/SversusN/gophermart/pkg/hasher"
+	"github.com/SversusN/gophermart/pkg/keyring"
 )
 
 type AuthServiceInterface interface {
+	NormalizeLogin(login string) string
 	CreateUser(ctx context.Context, user *model.User) error
 	AuthenticationUser(ctx context.Context, user *model.User) error
-	GenerateToken(user *model.User, tokenAuth *jwtauth.JWTAuth) (string, error)
+	ChangePassword(ctx context.Context, userID int, current, newPassword string) error
+	DeleteUser(ctx context.Context, userID int, force bool) error
+}
+
+type TokenServiceInterface interface {
+	IssueTokens(ctx context.Context, user *model.User, tokenAuth *keyring.KeyRing) (*model.TokenPair, error)
+	RefreshTokens(ctx context.Context, refreshToken string, tokenAuth *keyring.KeyRing) (*model.TokenPair, error)
+	GenerateToken(user *model.User, sessionID string, tokenAuth *keyring.KeyRing) (string, error)
+	Logout(ctx context.Context, sessionID string) error
+	IsSessionRevoked(ctx context.Context, sessionID string) (bool, error)
+}
+
+type LoginGuardInterface interface {
+	Check(ctx context.Context, login, ip string) error
+	Fail(ctx context.Context, login, ip string) error
+	Succeed(ctx context.Context, login string) error
+	Unlock(ctx context.Context, login string, unlockedBy int) error
+	UnlockIP(ctx context.Context, ip string, unlockedBy int) error
+	GetActiveLockouts(ctx context.Context) ([]model.Lockout, error)
+}
+
+type AdminServiceInterface interface {
+	GetUser(ctx context.Context, userID int) (*model.UserInfo, error)
+	GetUserByLogin(ctx context.Context, login string) (*model.UserInfo, error)
+	RequeueOrder(ctx context.Context, number uint64, adminID int) error
+	AdjustBalance(ctx context.Context, adjustment *model.BalanceAdjustment) error
+}
+
+type LedgerServiceInterface interface {
+	GetBalance(ctx context.Context, userID int) (*model.Balance, error)
+	Reconcile(ctx context.Context) ([]model.BalanceDrift, error)
+	GetTransactions(ctx context.Context, filter model.TransactionFilter, after string) (*model.TransactionPage, error)
+}
+
+type IdempotencyServiceInterface interface {
+	Begin(ctx context.Context, userID int, key, requestHash string) (*model.IdempotencyRecord, error)
+	Complete(ctx context.Context, record *model.IdempotencyRecord) error
+	Release(ctx context.Context, userID int, key string) error
 }
 
 type AccrualOrderServiceInterface interface {
 	LoadOrder(ctx context.Context, numOrder uint64, userID int) error
+	LoadOrders(ctx context.Context, userID int, numbers []string) ([]model.OrderUploadResult, error)
 	GetUploadedOrders(ctx context.Context, userID int) ([]model.AccrualOrder, error)
+	GetOrders(ctx context.Context, filter model.OrderFilter, after string) (*model.OrderPage, error)
+	GetOrder(ctx context.Context, userID int, number uint64) (*model.OrderDetail, error)
 }
 
 type WithdrawOrderServiceInterface interface {
 	DeductionOfPoints(ctx context.Context, order *model.WithdrawOrder) error
-	GetBalance(ctx context.Context, userID int) (float32, float32)
 	GetWithdrawalOfPoints(ctx context.Context, userID int) ([]model.WithdrawOrder, error)
+	CancelWithdrawal(ctx context.Context, userID int, order uint64) error
+	RefundWithdrawal(ctx context.Context, order uint64, adminID int, reason string) error
+	ConfirmWithdrawal(ctx context.Context, order uint64) error
+	RejectWithdrawal(ctx context.Context, order uint64, reason string) error
+}
+
+type TransferServiceInterface interface {
+	Transfer(ctx context.Context, transfer *model.Transfer) error
+	GetTransfers(ctx context.Context, userID int) ([]model.Transfer, error)
+}
+
+type OrderEventServiceInterface interface {
+	Start(ctx context.Context, wg *sync.WaitGroup)
+	Subscribe(userID int) (<-chan model.OrderEvent, func())
+	Replay(ctx context.Context, userID int, lastEventID, cursor int64) ([]model.OrderEvent, bool, error)
+}
+
+type WebhookServiceInterface interface {
+	Register(ctx context.Context, webhook *model.Webhook) error
+	GetWebhooks(ctx context.Context, userID int) ([]model.Webhook, error)
+	DeleteWebhook(ctx context.Context, userID int, id int64) error
+	GetDeadLetters(ctx context.Context) ([]model.WebhookDelivery, error)
+	ReplayDelivery(ctx context.Context, id int64, adminID int) error
 }
 
 type ServiceCollection struct {
-	Auth     AuthServiceInterface
-	Accrual  AccrualOrderServiceInterface
-	Withdraw WithdrawOrderServiceInterface
+	Auth        AuthServiceInterface
+	Token       TokenServiceInterface
+	Guard       LoginGuardInterface
+	Admin       AdminServiceInterface
+	Ledger      LedgerServiceInterface
+	Idempotency IdempotencyServiceInterface
+	Accrual     AccrualOrderServiceInterface
+	Withdraw    WithdrawOrderServiceInterface
+	Transfer    TransferServiceInterface
+	Events      OrderEventServiceInterface
+	Webhook     WebhookServiceInterface
 }
 
-func NewService(r *storage.Repository, log *zap.Logger) *ServiceCollection {
+func NewService(r *storage.Repository, conf *config.Config, log *zap.Logger) *ServiceCollection {
 	return &ServiceCollection{
-		Auth:     NewAuthService(r.Auth, log),
-		Accrual:  NewAccrualOrderService(r.Accrual, log),
-		Withdraw: NewWithdrawOrderService(r.Withdraw, log),
+		Auth:        NewAuthService(r.Auth, hasher.MustNew(conf.PasswordHashAlgorithm), credentialsPolicy(conf), log),
+		Token:       NewTokenService(r.Token, conf.AccessTokenTTL, conf.RefreshTokenTTL, log),
+		Guard:       NewLoginGuard(r.Attempts, r.Lockout, loginGuardPolicy(conf), log),
+		Admin:       NewAdminService(r.Admin, log),
+		Ledger:      NewLedgerService(r.Ledger, pointsPolicy(conf), log),
+		Idempotency: NewIdempotencyService(r.Idempotency, conf.IdempotencyKeyTTL, log),
+		Accrual:     NewAccrualOrderService(r.Accrual, conf.OrdersBatchLimit, log),
+		Withdraw:    NewWithdrawOrderService(r.Withdraw, withdrawalPolicy(conf), log),
+		Transfer:    NewTransferService(r.Transfer, conf.TransferDailyLimit, log),
+		Events:      NewOrderEventHub(r.Events, log),
+		Webhook:     NewWebhookService(r.Webhook, conf.WebhookGuard(), log),
+	}
+}
+
+func loginGuardPolicy(conf *config.Config) LoginGuardPolicy {
+	return LoginGuardPolicy{
+		DelayAfter:    conf.LoginDelayAfter,
+		BaseDelay:     conf.LoginBaseDelay,
+		MaxFailures:   conf.LoginMaxFailures,
+		MaxIPFailures: conf.LoginMaxIPFailures,
+		Lockout:       conf.LoginLockout,
+		Window:        conf.LoginFailureWindow,
+	}
+}
+
+func pointsPolicy(conf *config.Config) PointsPolicy {
+	return PointsPolicy{
+		LifetimeMonths: conf.PointsLifetimeMonths,
+		ExpiryNotice:   conf.PointsExpiryNotice,
+	}
+}
+
+func withdrawalPolicy(conf *config.Config) WithdrawalPolicy {
+	return WithdrawalPolicy{
+		CancelWindow: conf.WithdrawalCancelWindow,
+		Confirmation: conf.WithdrawalConfirmation,
+		HoldTimeout:  conf.WithdrawalHoldTimeout,
+	}
+}
+
+func credentialsPolicy(conf *config.Config) CredentialsPolicy {
+	policy := CredentialsPolicy{
+		MinLoginLength:    conf.LoginMinLength,
+		MaxLoginLength:    conf.LoginMaxLength,
+		FoldLoginCase:     conf.LoginCaseFold,
+		MinPasswordLength: conf.PasswordMinLength,
+		MaxPasswordLength: conf.PasswordMaxLength,
+		RequireUpper:      conf.PasswordRequireUpper,
+		RequireLower:      conf.PasswordRequireLower,
+		RequireDigit:      conf.PasswordRequireDigit,
+		RequireSymbol:     conf.PasswordRequireSymbol,
+	}
+	if conf.LoginPattern != "" {
+		policy.LoginPattern = regexp.MustCompile(conf.LoginPattern)
 	}
+	return policy
 }
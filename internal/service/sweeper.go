@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/SversusN/gophermart/internal/model"
+	storage "github.com/SversusN/gophermart/internal/repository"
+	errs "github.com/SversusN/gophermart/pkg/errors"
+)
+
+// sweepBatchSize - сколько просроченных удержаний снимается за один проход
+const sweepBatchSize = 100
+
+// HoldSweeper снимает удержания по списаниям, которые магазин не подтвердил вовремя
+type HoldSweeper struct {
+	repo     storage.WithdrawOrderRepoInterface
+	interval time.Duration
+	log      *zap.Logger
+}
+
+func NewHoldSweeper(repo storage.WithdrawOrderRepoInterface, interval time.Duration, log *zap.Logger) *HoldSweeper {
+	return &HoldSweeper{
+		repo:     repo,
+		interval: interval,
+		log:      log,
+	}
+}
+
+func (s *HoldSweeper) Start(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.Sweep(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Sweep отклоняет просроченные удержания и возвращает, сколько снято
+func (s *HoldSweeper) Sweep(ctx context.Context) int {
+	released := 0
+	for {
+		orders, err := s.repo.GetExpiredHolds(ctx, time.Now(), sweepBatchSize)
+		if err != nil {
+			s.log.Error("HoldSweeper.Sweep: GetExpiredHolds db error")
+			return released
+		}
+		for _, order := range orders {
+			err = s.repo.ResolveWithdrawal(ctx, order, model.WithdrawalRejected, "hold expired")
+			switch err.(type) {
+			case nil:
+				released++
+			case errs.WithdrawalStatusError:
+				// магазин успел ответить между выборкой и снятием
+			default:
+				s.log.Error("HoldSweeper.Sweep: ResolveWithdrawal db error", zap.Uint64("order", order))
+				return released
+			}
+		}
+		if len(orders) < sweepBatchSize {
+			break
+		}
+	}
+	if released > 0 {
+		s.log.Info("HoldSweeper.Sweep: expired holds released", zap.Int("count", released))
+	}
+	return released
+}
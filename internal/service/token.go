@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/SversusN/gophermart/internal/model"
+	storage "github.com/SversusN/gophermart/internal/repository"
+	errs "github.com/SversusN/gophermart/pkg/errors"
+	"github.com/SversusN/gophermart/pkg/keyring"
+)
+
+const (
+	tokenType      = "Bearer"
+	claimUserID    = "user_id"
+	claimSessionID = "sid"
+	claimRole      = "role"
+)
+
+type TokenService struct {
+	repo       storage.TokenRepoInterface
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	log        *zap.Logger
+}
+
+func NewTokenService(repo storage.TokenRepoInterface, accessTTL, refreshTTL time.Duration, log *zap.Logger) *TokenService {
+	return &TokenService{
+		repo:       repo,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+		log:        log,
+	}
+}
+
+// IssueTokens открывает новую сессию и выдает для нее пару токенов
+func (t *TokenService) IssueTokens(ctx context.Context, user *model.User, tokenAuth *keyring.KeyRing) (*model.TokenPair, error) {
+	sessionID, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &model.Session{ID: sessionID, UserID: user.ID, Role: user.Role}
+	err = t.repo.CreateSession(ctx, session, hashToken(refreshToken), time.Now().Add(t.refreshTTL))
+	if err != nil {
+		t.log.Error("TokenService.IssueTokens: CreateSession db error")
+		return nil, err
+	}
+	return t.tokenPair(session, refreshToken, tokenAuth)
+}
+
+func (t *TokenService) RefreshTokens(ctx context.Context, refreshToken string, tokenAuth *keyring.KeyRing) (*model.TokenPair, error) {
+	newRefreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := t.repo.RotateRefreshToken(ctx, hashToken(refreshToken), hashToken(newRefreshToken), time.Now().Add(t.refreshTTL))
+	var reused errs.RefreshTokenReusedError
+	if errors.As(err, &reused) {
+		t.log.Warn("TokenService.RefreshTokens: refresh token reuse, session revoked", zap.String("session", reused.SessionID))
+		return nil, errs.InvalidTokenError{}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t.tokenPair(session, newRefreshToken, tokenAuth)
+}
+
+// GenerateToken подписывает access токен сессии, срок жизни токена ограничен accessTTL
+func (t *TokenService) GenerateToken(user *model.User, sessionID string, tokenAuth *keyring.KeyRing) (string, error) {
+	role := user.Role
+	if role == "" {
+		role = model.RoleUser
+	}
+	now := time.Now()
+	_, tokenString, err := tokenAuth.Encode(map[string]interface{}{
+		claimUserID:    user.ID,
+		claimSessionID: sessionID,
+		claimRole:      role,
+		"iat":          now.Unix(),
+		"exp":          now.Add(t.accessTTL).Unix(),
+	})
+	return tokenString, err
+}
+
+func (t *TokenService) Logout(ctx context.Context, sessionID string) error {
+	err := t.repo.RevokeSession(ctx, sessionID)
+	if err != nil {
+		t.log.Error("TokenService.Logout: RevokeSession db error")
+	}
+	return err
+}
+
+func (t *TokenService) IsSessionRevoked(ctx context.Context, sessionID string) (bool, error) {
+	return t.repo.IsSessionRevoked(ctx, sessionID)
+}
+
+func (t *TokenService) tokenPair(session *model.Session, refreshToken string, tokenAuth *keyring.KeyRing) (*model.TokenPair, error) {
+	accessToken, err := t.GenerateToken(&model.User{ID: session.UserID, Role: session.Role}, session.ID, tokenAuth)
+	if err != nil {
+		return nil, err
+	}
+	return &model.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    tokenType,
+		ExpiresIn:    int(t.accessTTL.Seconds()),
+	}, nil
+}
+
+func randomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// в базе храним только хеш refresh токена
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
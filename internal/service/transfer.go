@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/SversusN/gophermart/internal/model"
+	storage "github.com/SversusN/gophermart/internal/repository"
+	errs "github.com/SversusN/gophermart/pkg/errors"
+)
+
+type TransferService struct {
+	repo       storage.TransferRepoInterface
+	dailyLimit model.Money
+	log        *zap.Logger
+}
+
+func NewTransferService(repo storage.TransferRepoInterface, dailyLimit model.Money, log *zap.Logger) *TransferService {
+	return &TransferService{
+		repo:       repo,
+		dailyLimit: dailyLimit,
+		log:        log,
+	}
+}
+
+// Transfer переводит баллы пользователю с логином transfer.RecipientLogin.
+// Суточный лимит считается с начала текущих суток.
+func (t *TransferService) Transfer(ctx context.Context, transfer *model.Transfer) error {
+	transfer.RecipientLogin = strings.TrimSpace(transfer.RecipientLogin)
+	var violations []errs.Violation
+	if transfer.RecipientLogin == "" {
+		violations = append(violations, errs.Violation{Field: "recipient", Rule: "required", Message: "recipient is required"})
+	}
+	if transfer.Sum <= 0 {
+		violations = append(violations, errs.Violation{Field: "sum", Rule: "positive", Message: "sum must be positive"})
+	}
+	if len(violations) > 0 {
+		return errs.ValidationError{Violations: violations}
+	}
+
+	now := time.Now()
+	year, month, day := now.Date()
+	limit := model.TransferLimit{Amount: t.dailyLimit, Since: time.Date(year, month, day, 0, 0, 0, 0, now.Location())}
+
+	err := t.repo.CreateTransfer(ctx, transfer, limit)
+	switch err.(type) {
+	case nil:
+		t.log.Info("TransferService.Transfer: points transferred",
+			zap.Int64("transfer", transfer.ID), zap.Int("sender_id", transfer.SenderID),
+			zap.Int("recipient_id", transfer.RecipientID), zap.Stringer("amount", transfer.Sum))
+	case errs.UserNotFoundError, errs.SelfTransferError, errs.TransferLimitExceededError, errs.ShowMeTheMoney:
+	default:
+		t.log.Error("TransferService.Transfer: CreateTransfer db error")
+	}
+	return err
+}
+
+func (t *TransferService) GetTransfers(ctx context.Context, userID int) ([]model.Transfer, error) {
+	transfers, err := t.repo.GetTransfers(ctx, userID)
+	if err != nil {
+		t.log.Error("TransferService.GetTransfers: GetTransfers db error")
+		return nil, err
+	}
+	return transfers, nil
+}
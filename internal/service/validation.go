@@ -0,0 +1,94 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/SversusN/gophermart/internal/model"
+	errs "github.com/SversusN/gophermart/pkg/errors"
+)
+
+// CredentialsPolicy - правила для логина и пароля при регистрации.
+// Нулевое значение правила его отключает.
+type CredentialsPolicy struct {
+	MinLoginLength int
+	MaxLoginLength int
+	LoginPattern   *regexp.Regexp
+	FoldLoginCase  bool
+
+	MinPasswordLength int
+	// MaxPasswordLength считается в байтах: bcrypt учитывает только первые 72 байта
+	MaxPasswordLength int
+	RequireUpper      bool
+	RequireLower      bool
+	RequireDigit      bool
+	RequireSymbol     bool
+}
+
+// NormalizeLogin обрезает пробелы и, если включено, приводит логин к нижнему регистру
+func (p CredentialsPolicy) NormalizeLogin(login string) string {
+	login = strings.TrimSpace(login)
+	if p.FoldLoginCase {
+		login = strings.ToLower(login)
+	}
+	return login
+}
+
+// Validate проверяет уже нормализованный логин и пароль и возвращает все нарушенные правила сразу
+func (p CredentialsPolicy) Validate(user *model.User) error {
+	var violations []errs.Violation
+	add := func(field, rule, format string, args ...interface{}) {
+		violations = append(violations, errs.Violation{Field: field, Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	loginLength := utf8.RuneCountInString(user.Login)
+	if loginLength == 0 {
+		add("login", "required", "login is required")
+	}
+	if p.MinLoginLength > 0 && loginLength > 0 && loginLength < p.MinLoginLength {
+		add("login", "min_length", "login must be at least %d characters", p.MinLoginLength)
+	}
+	if p.MaxLoginLength > 0 && loginLength > p.MaxLoginLength {
+		add("login", "max_length", "login must be at most %d characters", p.MaxLoginLength)
+	}
+	if p.LoginPattern != nil && loginLength > 0 && !p.LoginPattern.MatchString(user.Login) {
+		add("login", "charset", "login contains characters that are not allowed")
+	}
+
+	if user.Password == "" {
+		add("password", "required", "password is required")
+	}
+	if p.MinPasswordLength > 0 && user.Password != "" && utf8.RuneCountInString(user.Password) < p.MinPasswordLength {
+		add("password", "min_length", "password must be at least %d characters", p.MinPasswordLength)
+	}
+	if p.MaxPasswordLength > 0 && len(user.Password) > p.MaxPasswordLength {
+		add("password", "max_length", "password must be at most %d bytes", p.MaxPasswordLength)
+	}
+	if p.RequireUpper && !strings.ContainsFunc(user.Password, unicode.IsUpper) {
+		add("password", "upper", "password must contain an upper-case letter")
+	}
+	if p.RequireLower && !strings.ContainsFunc(user.Password, unicode.IsLower) {
+		add("password", "lower", "password must contain a lower-case letter")
+	}
+	if p.RequireDigit && !strings.ContainsFunc(user.Password, unicode.IsDigit) {
+		add("password", "digit", "password must contain a digit")
+	}
+	if p.RequireSymbol && !strings.ContainsFunc(user.Password, isSymbol) {
+		add("password", "symbol", "password must contain a symbol")
+	}
+	if user.Password != "" && strings.EqualFold(user.Password, user.Login) {
+		add("password", "not_login", "password must differ from login")
+	}
+
+	if len(violations) > 0 {
+		return errs.ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+func isSymbol(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
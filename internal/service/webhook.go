@@ -0,0 +1,274 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/SversusN/gophermart/internal/model"
+	storage "github.com/SversusN/gophermart/internal/repository"
+	errs "github.com/SversusN/gophermart/pkg/errors"
+	"github.com/SversusN/gophermart/pkg/webhook"
+)
+
+const (
+	// webhookBatchSize - сколько доставок отправитель берёт за один проход
+	webhookBatchSize = 50
+	// maxDeadLetters - сколько недоставленных событий отдаётся администратору за раз
+	maxDeadLetters      = 200
+	webhookSecretPrefix = "whsec_"
+)
+
+// WebhookPolicy - повторы доставки: пауза растёт вдвое от Backoff до MaxBackoff,
+// после MaxAttempts неудач доставка уходит в dead letter
+type WebhookPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	Timeout     time.Duration
+	Guard       webhook.Guard
+}
+
+// retryDelay - пауза перед следующей попыткой после attempts неудачных
+func (p WebhookPolicy) retryDelay(attempts int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < attempts && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	return delay
+}
+
+type WebhookService struct {
+	repo  storage.WebhookRepoInterface
+	guard webhook.Guard
+	log   *zap.Logger
+}
+
+func NewWebhookService(repo storage.WebhookRepoInterface, guard webhook.Guard, log *zap.Logger) *WebhookService {
+	return &WebhookService{
+		repo:  repo,
+		guard: guard,
+		log:   log,
+	}
+}
+
+// Register проверяет адрес и события, выдаёт секрет для подписи и сохраняет вебхук.
+// Без списка событий вебхук подписывается на все
+func (s *WebhookService) Register(ctx context.Context, hook *model.Webhook) error {
+	var violations []errs.Violation
+	target, err := url.Parse(hook.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Hostname() == "" {
+		violations = append(violations, errs.Violation{Field: "url", Rule: "url", Message: "url must be an absolute http or https address"})
+	} else if err = s.guard.CheckHost(ctx, target.Hostname()); errors.Is(err, webhook.ErrForbiddenAddress) {
+		violations = append(violations, errs.Violation{Field: "url", Rule: "public", Message: "url must point to a public address"})
+	} else if err != nil {
+		violations = append(violations, errs.Violation{Field: "url", Rule: "resolve", Message: "url host cannot be resolved"})
+	}
+	if len(hook.Events) == 0 {
+		hook.Events = model.WebhookEvents
+	}
+	for _, event := range hook.Events {
+		if !slices.Contains(model.WebhookEvents, event) {
+			violations = append(violations, errs.Violation{Field: "events", Rule: "enum", Message: fmt.Sprintf("unknown event %q", event)})
+		}
+	}
+	if len(violations) > 0 {
+		return errs.ValidationError{Violations: violations}
+	}
+
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return err
+	}
+	hook.Secret = webhookSecretPrefix + hex.EncodeToString(secret)
+
+	if err = s.repo.CreateWebhook(ctx, hook); err != nil {
+		s.log.Error("WebhookService.Register: CreateWebhook db error")
+		return err
+	}
+	return nil
+}
+
+func (s *WebhookService) GetWebhooks(ctx context.Context, userID int) ([]model.Webhook, error) {
+	hooks, err := s.repo.GetWebhooks(ctx, userID)
+	if err != nil {
+		s.log.Error("WebhookService.GetWebhooks: GetWebhooks db error")
+		return nil, err
+	}
+	return hooks, nil
+}
+
+func (s *WebhookService) DeleteWebhook(ctx context.Context, userID int, id int64) error {
+	err := s.repo.DeleteWebhook(ctx, userID, id)
+	switch err.(type) {
+	case nil, errs.WebhookNotFoundError:
+	default:
+		s.log.Error("WebhookService.DeleteWebhook: DeleteWebhook db error")
+	}
+	return err
+}
+
+func (s *WebhookService) GetDeadLetters(ctx context.Context) ([]model.WebhookDelivery, error) {
+	deliveries, err := s.repo.GetDeliveries(ctx, model.DeliveryDead, maxDeadLetters)
+	if err != nil {
+		s.log.Error("WebhookService.GetDeadLetters: GetDeliveries db error")
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (s *WebhookService) ReplayDelivery(ctx context.Context, id int64, adminID int) error {
+	err := s.repo.ReplayDelivery(ctx, id)
+	switch err.(type) {
+	case nil:
+		s.log.Info("WebhookService.ReplayDelivery: delivery requeued", zap.Int64("delivery", id), zap.Int("admin_id", adminID))
+	case errs.WebhookDeliveryNotFoundError:
+	default:
+		s.log.Error("WebhookService.ReplayDelivery: ReplayDelivery db error")
+	}
+	return err
+}
+
+// WebhookDispatcher отправляет события из outbox на вебхуки
+type WebhookDispatcher struct {
+	repo     storage.WebhookRepoInterface
+	client   *http.Client
+	policy   WebhookPolicy
+	interval time.Duration
+	log      *zap.Logger
+}
+
+func NewWebhookDispatcher(repo storage.WebhookRepoInterface, policy WebhookPolicy, interval time.Duration, log *zap.Logger) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		repo:     repo,
+		client:   policy.Guard.Client(policy.Timeout),
+		policy:   policy,
+		interval: interval,
+		log:      log,
+	}
+}
+
+func (d *WebhookDispatcher) Start(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.Dispatch(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Dispatch отправляет все доставки, которым пора уходить, и возвращает, сколько принято получателями
+func (d *WebhookDispatcher) Dispatch(ctx context.Context) int {
+	delivered := 0
+	for ctx.Err() == nil {
+		// аренда покрывает отправку всей пачки, чтобы другая реплика не взяла те же доставки
+		lease := d.policy.Timeout*webhookBatchSize + d.interval
+		deliveries, err := d.repo.ClaimDeliveries(ctx, time.Now(), lease, webhookBatchSize)
+		if err != nil {
+			d.log.Error("WebhookDispatcher.Dispatch: ClaimDeliveries db error")
+			return delivered
+		}
+		for i := range deliveries {
+			if ctx.Err() != nil {
+				// остаток пачки вернется в очередь, когда истечет аренда
+				return delivered
+			}
+			if d.deliver(ctx, &deliveries[i]) {
+				delivered++
+			}
+		}
+		if len(deliveries) < webhookBatchSize {
+			break
+		}
+	}
+	return delivered
+}
+
+func (d *WebhookDispatcher) deliver(ctx context.Context, delivery *model.WebhookDelivery) bool {
+	statusCode, err := d.send(ctx, delivery)
+	if ctx.Err() != nil {
+		// отправку прервала остановка сервиса, а не получатель: попытка не считается
+		return false
+	}
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+	if err == nil {
+		delivery.Status = model.DeliveryDelivered
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = now
+		delivery.LastError = ""
+	} else {
+		delivery.Status = model.DeliveryPending
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = now.Add(d.policy.retryDelay(delivery.Attempts))
+		if delivery.Attempts >= d.policy.MaxAttempts {
+			delivery.Status = model.DeliveryDead
+			d.log.Warn("WebhookDispatcher.deliver: delivery moved to dead letters",
+				zap.Int64("delivery", delivery.ID), zap.String("url", delivery.URL), zap.Error(err))
+		}
+	}
+	// начатая запись результата не обрывается остановкой сервиса
+	if err = d.repo.UpdateDelivery(context.WithoutCancel(ctx), delivery); err != nil {
+		d.log.Error("WebhookDispatcher.deliver: UpdateDelivery db error", zap.Int64("delivery", delivery.ID))
+	}
+	return delivery.Status == model.DeliveryDelivered
+}
+
+// send отправляет подписанное событие; успехом считается любой ответ 2xx
+func (d *WebhookDispatcher) send(ctx context.Context, delivery *model.WebhookDelivery) (int, error) {
+	body, err := json.Marshal(struct {
+		ID        int64           `json:"id"`
+		Type      string          `json:"type"`
+		CreatedAt time.Time       `json:"created_at"`
+		Data      json.RawMessage `json:"data"`
+	}{delivery.EventID, delivery.EventType, delivery.EventCreatedAt, delivery.Payload})
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhook.EventHeader, delivery.EventType)
+	req.Header.Set(webhook.DeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(webhook.TimestampHeader, strconv.FormatInt(timestamp.Unix(), 10))
+	req.Header.Set(webhook.SignatureHeader, webhook.Sign(delivery.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,267 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/SversusN/gophermart/internal/model"
+	storage "github.com/SversusN/gophermart/internal/repository"
+	errs "github.com/SversusN/gophermart/pkg/errors"
+	"github.com/SversusN/gophermart/pkg/webhook"
+)
+
+// fakeDeliveries - очередь доставок в памяти; аренда работает как в ClaimDeliveries
+type fakeDeliveries struct {
+	storage.WebhookRepoInterface
+	mu         sync.Mutex
+	deliveries map[int64]model.WebhookDelivery
+	leases     []time.Duration
+}
+
+func newFakeDeliveries(deliveries ...model.WebhookDelivery) *fakeDeliveries {
+	f := &fakeDeliveries{deliveries: make(map[int64]model.WebhookDelivery)}
+	for _, delivery := range deliveries {
+		f.deliveries[delivery.ID] = delivery
+	}
+	return f
+}
+
+func (f *fakeDeliveries) ClaimDeliveries(_ context.Context, now time.Time, lease time.Duration, limit int) ([]model.WebhookDelivery, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.leases = append(f.leases, lease)
+	var claimed []model.WebhookDelivery
+	for id, delivery := range f.deliveries {
+		if delivery.Status != model.DeliveryPending || delivery.NextAttemptAt.After(now) || len(claimed) == limit {
+			continue
+		}
+		delivery.NextAttemptAt = now.Add(lease)
+		f.deliveries[id] = delivery
+		claimed = append(claimed, delivery)
+	}
+	return claimed, nil
+}
+
+func (f *fakeDeliveries) UpdateDelivery(_ context.Context, delivery *model.WebhookDelivery) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deliveries[delivery.ID] = *delivery
+	return nil
+}
+
+func (f *fakeDeliveries) ReplayDelivery(_ context.Context, id int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delivery, ok := f.deliveries[id]
+	if !ok {
+		return errs.WebhookDeliveryNotFoundError{}
+	}
+	delivery.Status, delivery.Attempts, delivery.NextAttemptAt = model.DeliveryPending, 0, time.Now()
+	delivery.LastError, delivery.LastStatusCode, delivery.DeliveredAt = "", 0, nil
+	f.deliveries[id] = delivery
+	return nil
+}
+
+func (f *fakeDeliveries) get(id int64) model.WebhookDelivery {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.deliveries[id]
+}
+
+// due переносит следующую попытку в прошлое, чтобы не ждать паузу
+func (f *fakeDeliveries) due(id int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delivery := f.deliveries[id]
+	delivery.NextAttemptAt = time.Now().Add(-time.Second)
+	f.deliveries[id] = delivery
+}
+
+const testWebhookSecret = "whsec_test"
+
+// testReceiver - получатель вебхуков, который отвечает статусом из status и проверяет подпись
+func testReceiver(t *testing.T, status *atomic.Int32, calls *atomic.Int32) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		unix, err := strconv.ParseInt(r.Header.Get(webhook.TimestampHeader), 10, 64)
+		require.NoError(t, err)
+		assert.True(t, webhook.Verify(testWebhookSecret, r.Header.Get(webhook.SignatureHeader), time.Unix(unix, 0), body, time.Minute))
+		assert.Equal(t, model.WebhookOrderProcessed, r.Header.Get(webhook.EventHeader))
+		var event struct {
+			ID   int64           `json:"id"`
+			Data json.RawMessage `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(body, &event))
+		assert.Equal(t, int64(7), event.ID)
+		assert.JSONEq(t, `{"number":"12345678903"}`, string(event.Data))
+		if code := int(status.Load()); code == http.StatusFound {
+			http.Redirect(w, r, "http://169.254.169.254/latest/meta-data", code)
+			return
+		}
+		w.WriteHeader(int(status.Load()))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func testDispatcher(repo storage.WebhookRepoInterface) *WebhookDispatcher {
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	return NewWebhookDispatcher(repo, WebhookPolicy{
+		MaxAttempts: 3,
+		Backoff:     time.Second,
+		MaxBackoff:  90 * time.Second,
+		Timeout:     time.Second,
+		// тестовый получатель слушает loopback
+		Guard: webhook.Guard{Allowed: []*net.IPNet{loopback}},
+	}, time.Minute, zap.NewNop())
+}
+
+func testDelivery(url string) model.WebhookDelivery {
+	return model.WebhookDelivery{
+		ID: 1, WebhookID: 2, URL: url, Secret: testWebhookSecret,
+		EventID: 7, EventType: model.WebhookOrderProcessed, Payload: json.RawMessage(`{"number":"12345678903"}`),
+		Status: model.DeliveryPending, NextAttemptAt: time.Now().Add(-time.Second),
+	}
+}
+
+func TestDispatcherDelivers(t *testing.T) {
+	var status, calls atomic.Int32
+	status.Store(http.StatusNoContent)
+	server := testReceiver(t, &status, &calls)
+	repo := newFakeDeliveries(testDelivery(server.URL))
+	dispatcher := testDispatcher(repo)
+
+	assert.Equal(t, 1, dispatcher.Dispatch(context.Background()))
+	delivery := repo.get(1)
+	assert.Equal(t, model.DeliveryDelivered, delivery.Status)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Equal(t, http.StatusNoContent, delivery.LastStatusCode)
+	assert.NotNil(t, delivery.DeliveredAt)
+	// аренда покрывает отправку всей пачки
+	assert.Equal(t, []time.Duration{webhookBatchSize*time.Second + time.Minute}, repo.leases)
+
+	// доставленное повторно не отправляется
+	assert.Zero(t, dispatcher.Dispatch(context.Background()))
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestDispatcherRetriesAndDeadLetters(t *testing.T) {
+	var status, calls atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	server := testReceiver(t, &status, &calls)
+	repo := newFakeDeliveries(testDelivery(server.URL))
+	dispatcher := testDispatcher(repo)
+	ctx := context.Background()
+
+	for attempt, delay := range []time.Duration{time.Second, 2 * time.Second} {
+		start := time.Now()
+		assert.Zero(t, dispatcher.Dispatch(ctx))
+		delivery := repo.get(1)
+		assert.Equal(t, model.DeliveryPending, delivery.Status)
+		assert.Equal(t, attempt+1, delivery.Attempts)
+		assert.Equal(t, http.StatusServiceUnavailable, delivery.LastStatusCode)
+		assert.Equal(t, "unexpected status 503", delivery.LastError)
+		assert.WithinRange(t, delivery.NextAttemptAt, start.Add(delay), time.Now().Add(delay))
+
+		// до следующей попытки доставка не отправляется
+		assert.Zero(t, dispatcher.Dispatch(ctx))
+		assert.Equal(t, int32(attempt+1), calls.Load())
+		repo.due(1)
+	}
+
+	// редирект не выполняется и считается неудачей; третья неудача отправляет в dead letter
+	status.Store(http.StatusFound)
+	assert.Zero(t, dispatcher.Dispatch(ctx))
+	delivery := repo.get(1)
+	assert.Equal(t, model.DeliveryDead, delivery.Status)
+	assert.Equal(t, 3, delivery.Attempts)
+	assert.Equal(t, http.StatusFound, delivery.LastStatusCode)
+	assert.Equal(t, int32(3), calls.Load())
+
+	repo.due(1)
+	assert.Zero(t, dispatcher.Dispatch(ctx))
+	assert.Equal(t, int32(3), calls.Load())
+
+	// повтор администратором возвращает доставку в очередь с новым счетчиком
+	status.Store(http.StatusOK)
+	webhooks := NewWebhookService(repo, webhook.Guard{}, zap.NewNop())
+	require.NoError(t, webhooks.ReplayDelivery(ctx, 1, 99))
+	assert.ErrorIs(t, webhooks.ReplayDelivery(ctx, 2, 99), errs.WebhookDeliveryNotFoundError{})
+	assert.Equal(t, 1, dispatcher.Dispatch(ctx))
+	delivery = repo.get(1)
+	assert.Equal(t, model.DeliveryDelivered, delivery.Status)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Empty(t, delivery.LastError)
+}
+
+func TestDispatcherRefusesInternalTargets(t *testing.T) {
+	var status, calls atomic.Int32
+	status.Store(http.StatusOK)
+	server := testReceiver(t, &status, &calls)
+	repo := newFakeDeliveries(testDelivery(server.URL))
+	// адрес мог смениться после регистрации: проверка повторяется при соединении
+	dispatcher := NewWebhookDispatcher(repo, WebhookPolicy{MaxAttempts: 3, Backoff: time.Second, MaxBackoff: time.Minute, Timeout: time.Second},
+		time.Minute, zap.NewNop())
+
+	assert.Zero(t, dispatcher.Dispatch(context.Background()))
+	assert.Zero(t, calls.Load())
+	delivery := repo.get(1)
+	assert.Equal(t, model.DeliveryPending, delivery.Status)
+	assert.Contains(t, delivery.LastError, webhook.ErrForbiddenAddress.Error())
+}
+
+func TestDispatcherStopsOnShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var calls atomic.Int32
+	// сервис останавливается, пока получатель обрабатывает первую доставку пачки
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		_, _ = io.Copy(io.Discard, r.Body)
+		cancel()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	first, second := testDelivery(server.URL), testDelivery(server.URL)
+	first.Attempts = 2
+	second.ID = 2
+	repo := newFakeDeliveries(first, second)
+
+	assert.Zero(t, testDispatcher(repo).Dispatch(ctx))
+	assert.Equal(t, int32(1), calls.Load())
+	// прерванная отправка не расходует попытку: доставка не уходит в dead letter и вернется после аренды
+	for id, attempts := range map[int64]int{1: 2, 2: 0} {
+		delivery := repo.get(id)
+		assert.Equal(t, model.DeliveryPending, delivery.Status)
+		assert.Equal(t, attempts, delivery.Attempts)
+		assert.Empty(t, delivery.LastError)
+	}
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	policy := WebhookPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	for attempts, want := range map[int]time.Duration{
+		1:   time.Second,
+		2:   2 * time.Second,
+		3:   4 * time.Second,
+		4:   5 * time.Second,
+		100: 5 * time.Second,
+	} {
+		assert.Equal(t, want, policy.retryDelay(attempts), "attempts %d", attempts)
+	}
+}
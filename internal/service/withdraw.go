@@ -3,6 +3,8 @@ package service
 import (
 	"context"
 	"errors"
+	"strings"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -11,25 +13,35 @@ import (
 	errs "github.com/SversusN/gophermart/pkg/errors"
 )
 
+// WithdrawalPolicy - правила жизненного цикла списания
+type WithdrawalPolicy struct {
+	// CancelWindow - сколько пользователь может сам отменить подтвержденное списание
+	CancelWindow time.Duration
+	// Confirmation - списание ждет подтверждения магазина, баллы до тех пор удерживаются
+	Confirmation bool
+	// HoldTimeout - через сколько неподтвержденное удержание снимается
+	HoldTimeout time.Duration
+}
+
 type WithdrawOrderService struct {
-	rep storage.WithdrawOrderRepoInterface
-	log *zap.Logger
+	rep    storage.WithdrawOrderRepoInterface
+	policy WithdrawalPolicy
+	log    *zap.Logger
 }
 
-func NewWithdrawOrderService(rep storage.WithdrawOrderRepoInterface, log *zap.Logger) *WithdrawOrderService {
+func NewWithdrawOrderService(rep storage.WithdrawOrderRepoInterface, policy WithdrawalPolicy, log *zap.Logger) *WithdrawOrderService {
 	return &WithdrawOrderService{
-		rep: rep,
-		log: log,
+		rep:    rep,
+		policy: policy,
+		log:    log,
 	}
 }
 
-func (w WithdrawOrderService) GetBalance(ctx context.Context, userID int) (float32, float32) {
-	accruals := w.rep.GetAccruals(ctx, userID)
-	withdrawn := w.rep.GetWithdrawals(ctx, userID)
-	return accruals, withdrawn
-}
-
 func (w WithdrawOrderService) DeductionOfPoints(ctx context.Context, order *model.WithdrawOrder) error {
+	if w.policy.Confirmation {
+		holdExpiresAt := time.Now().Add(w.policy.HoldTimeout)
+		order.Status, order.HoldExpiresAt = model.WithdrawalPending, &holdExpiresAt
+	}
 	err := w.rep.DeductPoints(ctx, order)
 	if errors.Is(err, errs.ShowMeTheMoney{}) {
 		w.log.Error("no more money")
@@ -51,3 +63,67 @@ func (w *WithdrawOrderService) GetWithdrawalOfPoints(ctx context.Context, userID
 	}
 	return orders, nil
 }
+
+// CancelWithdrawal - отмена списания пользователем в пределах окна отмены.
+// Нулевое окно запрещает пользователям отменять списания самостоятельно.
+func (w *WithdrawOrderService) CancelWithdrawal(ctx context.Context, userID int, order uint64) error {
+	if w.policy.CancelWindow <= 0 {
+		return errs.CancellationWindowExpiredError{}
+	}
+	return w.refund(ctx, &model.WithdrawalRefund{
+		Order:      order,
+		UserID:     userID,
+		RefundedBy: userID,
+		NotBefore:  time.Now().Add(-w.policy.CancelWindow),
+	})
+}
+
+// RefundWithdrawal - возврат по решению поддержки: окно отмены не действует, причина обязательна
+func (w *WithdrawOrderService) RefundWithdrawal(ctx context.Context, order uint64, adminID int, reason string) error {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return errs.ValidationError{Violations: []errs.Violation{
+			{Field: "reason", Rule: "required", Message: "reason is required"},
+		}}
+	}
+	return w.refund(ctx, &model.WithdrawalRefund{
+		Order:      order,
+		RefundedBy: adminID,
+		Reason:     reason,
+	})
+}
+
+func (w *WithdrawOrderService) refund(ctx context.Context, refund *model.WithdrawalRefund) error {
+	err := w.rep.RefundWithdrawal(ctx, refund)
+	switch err.(type) {
+	case nil:
+		w.log.Info("WithdrawOrderService.refund: withdrawal refunded",
+			zap.Uint64("order", refund.Order), zap.Int("refunded_by", refund.RefundedBy))
+	case errs.WithdrawalNotFoundError, errs.WithdrawalAlreadyRefundedError, errs.WithdrawalStatusError, errs.CancellationWindowExpiredError:
+	default:
+		w.log.Error("WithdrawOrderService.refund: RefundWithdrawal db error")
+	}
+	return err
+}
+
+// ConfirmWithdrawal - магазин подтвердил заказ, удержанные баллы списываются
+func (w *WithdrawOrderService) ConfirmWithdrawal(ctx context.Context, order uint64) error {
+	return w.resolve(ctx, order, model.WithdrawalConfirmed, "")
+}
+
+// RejectWithdrawal - магазин отклонил заказ, удержанные баллы возвращаются
+func (w *WithdrawOrderService) RejectWithdrawal(ctx context.Context, order uint64, reason string) error {
+	return w.resolve(ctx, order, model.WithdrawalRejected, strings.TrimSpace(reason))
+}
+
+func (w *WithdrawOrderService) resolve(ctx context.Context, order uint64, status, reason string) error {
+	err := w.rep.ResolveWithdrawal(ctx, order, status, reason)
+	switch err.(type) {
+	case nil:
+		w.log.Info("WithdrawOrderService.resolve: withdrawal resolved", zap.Uint64("order", order), zap.String("status", status))
+	case errs.WithdrawalNotFoundError, errs.WithdrawalStatusError:
+	default:
+		w.log.Error("WithdrawOrderService.resolve: ResolveWithdrawal db error")
+	}
+	return err
+}
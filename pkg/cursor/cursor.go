@@ -0,0 +1,31 @@
+// Package cursor упаковывает позицию постраничной выдачи в непрозрачную для клиента строку.
+package cursor
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Encode кодирует позицию в строку, пригодную для query-параметра
+func Encode(position interface{}) string {
+	data, err := json.Marshal(position)
+	if err != nil {
+		panic("cursor: position must be JSON-serializable: " + err.Error())
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decode разбирает строку, выданную Encode, в position
+func Decode(value string, position interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+	if err = json.Unmarshal(data, position); err != nil {
+		return ErrInvalidCursor
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package cursor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	type position struct {
+		At time.Time `json:"at"`
+		ID int64     `json:"id"`
+	}
+	in := position{At: time.Date(2024, 11, 10, 16, 9, 57, 123456000, time.UTC), ID: 42}
+
+	var out position
+	require.NoError(t, Decode(Encode(in), &out))
+	assert.True(t, in.At.Equal(out.At))
+	assert.Equal(t, in.ID, out.ID)
+}
+
+func TestDecodeRejectsGarbage(t *testing.T) {
+	var id int64
+	assert.ErrorIs(t, Decode("not base64!", &id), ErrInvalidCursor)
+	assert.ErrorIs(t, Decode(Encode("text"), &id), ErrInvalidCursor)
+}
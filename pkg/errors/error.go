@@ -2,6 +2,8 @@ package errors
 
 import (
 	"fmt"
+	"strings"
+	"time"
 )
 
 const (
@@ -46,3 +48,133 @@ type ShowMeTheMoney struct{}
 func (s ShowMeTheMoney) Error() string {
 	return "not enough points on the account"
 }
+
+type InvalidTokenError struct{}
+
+func (i InvalidTokenError) Error() string {
+	return "invalid or expired token"
+}
+
+type RefreshTokenReusedError struct {
+	SessionID string
+}
+
+func (r RefreshTokenReusedError) Error() string {
+	return fmt.Sprintf("refresh token of session %s was already used", r.SessionID)
+}
+
+type TooManyAttemptsError struct {
+	RetryAfter time.Duration
+}
+
+func (t TooManyAttemptsError) Error() string {
+	return fmt.Sprintf("too many login attempts, retry after %s", t.RetryAfter.Round(time.Second))
+}
+
+type Violation struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+type ValidationError struct {
+	Violations []Violation `json:"violations"`
+}
+
+func (v ValidationError) Error() string {
+	messages := make([]string, 0, len(v.Violations))
+	for _, violation := range v.Violations {
+		messages = append(messages, violation.Message)
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+type PositiveBalanceError struct {
+	Balance string
+}
+
+func (p PositiveBalanceError) Error() string {
+	return fmt.Sprintf("account has a positive balance of %v points", p.Balance)
+}
+
+type UserNotFoundError struct{}
+
+func (u UserNotFoundError) Error() string {
+	return "user not found"
+}
+
+type OrderNotFoundError struct{}
+
+func (o OrderNotFoundError) Error() string {
+	return "order not found"
+}
+
+type OrderAlreadyProcessedError struct{}
+
+func (o OrderAlreadyProcessedError) Error() string {
+	return "the order has already been processed"
+}
+
+type IdempotencyKeyReusedError struct{}
+
+func (i IdempotencyKeyReusedError) Error() string {
+	return "idempotency key was already used with a different request"
+}
+
+type IdempotencyKeyInProgressError struct{}
+
+func (i IdempotencyKeyInProgressError) Error() string {
+	return "a request with this idempotency key is still in progress"
+}
+
+type WithdrawalNotFoundError struct{}
+
+func (w WithdrawalNotFoundError) Error() string {
+	return "withdrawal not found"
+}
+
+type WithdrawalAlreadyRefundedError struct{}
+
+func (w WithdrawalAlreadyRefundedError) Error() string {
+	return "the withdrawal has already been refunded"
+}
+
+type CancellationWindowExpiredError struct{}
+
+func (c CancellationWindowExpiredError) Error() string {
+	return "the cancellation window for this withdrawal has expired"
+}
+
+type WithdrawalStatusError struct {
+	Status string
+}
+
+func (w WithdrawalStatusError) Error() string {
+	return fmt.Sprintf("the withdrawal is already %s", strings.ToLower(w.Status))
+}
+
+type SelfTransferError struct{}
+
+func (s SelfTransferError) Error() string {
+	return "cannot transfer points to yourself"
+}
+
+type TransferLimitExceededError struct {
+	Remaining string
+}
+
+func (t TransferLimitExceededError) Error() string {
+	return fmt.Sprintf("daily transfer limit exceeded, %s points left for today", t.Remaining)
+}
+
+type WebhookNotFoundError struct{}
+
+func (w WebhookNotFoundError) Error() string {
+	return "webhook not found"
+}
+
+type WebhookDeliveryNotFoundError struct{}
+
+func (w WebhookDeliveryNotFoundError) Error() string {
+	return "webhook delivery not found"
+}
@@ -0,0 +1,8 @@
+package hasher
+
+import "errors"
+
+var (
+	ErrUnknownFormat = errors.New("unknown password hash format")
+	ErrInvalidHash   = errors.New("malformed password hash")
+)
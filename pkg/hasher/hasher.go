@@ -0,0 +1,73 @@
+package hasher
+
+import (
+	"fmt"
+)
+
+const (
+	Bcrypt   = "bcrypt"
+	Argon2id = "argon2id"
+)
+
+// PasswordHasher hashes passwords into self-describing strings: algorithm,
+// parameters and the per-user salt are encoded in the stored value.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password, encoded string) (bool, error)
+	NeedsRehash(encoded string) bool
+}
+
+// scheme is a PasswordHasher that can tell its own encoded hashes apart.
+type scheme interface {
+	PasswordHasher
+	recognizes(encoded string) bool
+}
+
+// New returns a hasher that hashes with the given algorithm and still verifies
+// every other supported format, including legacy SHA-1 hashes. NeedsRehash
+// reports true for anything not produced by the current algorithm settings.
+func New(algorithm string) (PasswordHasher, error) {
+	var primary scheme
+	switch algorithm {
+	case Bcrypt, "":
+		primary = NewBcrypt(0)
+	case Argon2id:
+		primary = NewArgon2id()
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm %q", algorithm)
+	}
+	return &upgrading{
+		primary: primary,
+		schemes: []scheme{primary, NewBcrypt(0), NewArgon2id(), legacySHA1{}},
+	}, nil
+}
+
+func MustNew(algorithm string) PasswordHasher {
+	h, err := New(algorithm)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+type upgrading struct {
+	primary scheme
+	schemes []scheme
+}
+
+func (u *upgrading) Hash(password string) (string, error) {
+	return u.primary.Hash(password)
+}
+
+func (u *upgrading) Verify(password, encoded string) (bool, error) {
+	for _, s := range u.schemes {
+		if s.recognizes(encoded) {
+			return s.Verify(password, encoded)
+		}
+	}
+	return false, ErrUnknownFormat
+}
+
+func (u *upgrading) NeedsRehash(encoded string) bool {
+	return !u.primary.recognizes(encoded) || u.primary.NeedsRehash(encoded)
+}
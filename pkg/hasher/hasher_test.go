@@ -0,0 +1,144 @@
+package hasher
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// legacySecret is "secret" hashed the way the first versions of gophermart did.
+const legacySecret = "62653535643130373965366336313637313138616339313331386665e5e9fa1ba31ecd1ae84f75caaa474f3a663f05f4"
+
+func TestRoundTrip(t *testing.T) {
+	for _, algorithm := range []string{Bcrypt, Argon2id} {
+		t.Run(algorithm, func(t *testing.T) {
+			h := MustNew(algorithm)
+			encoded, err := h.Hash("secret")
+			require.NoError(t, err)
+
+			ok, err := h.Verify("secret", encoded)
+			require.NoError(t, err)
+			assert.True(t, ok)
+			ok, err = h.Verify("Secret", encoded)
+			require.NoError(t, err)
+			assert.False(t, ok)
+			assert.False(t, h.NeedsRehash(encoded))
+
+			// every hash gets its own salt
+			again, err := h.Hash("secret")
+			require.NoError(t, err)
+			assert.NotEqual(t, encoded, again)
+		})
+	}
+}
+
+func TestArgon2idFormat(t *testing.T) {
+	encoded, err := NewArgon2id().Hash("secret")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encoded, "$argon2id$v=19$m=65536,t=1,p=4$"), encoded)
+}
+
+func TestVerifyOtherFormats(t *testing.T) {
+	bcryptHash, err := NewBcrypt(bcrypt.MinCost).Hash("secret")
+	require.NoError(t, err)
+	argonHash, err := NewArgon2id().Hash("secret")
+	require.NoError(t, err)
+
+	for _, algorithm := range []string{Bcrypt, Argon2id} {
+		h := MustNew(algorithm)
+		for _, encoded := range []string{bcryptHash, argonHash, legacySecret} {
+			ok, err := h.Verify("secret", encoded)
+			require.NoError(t, err)
+			assert.True(t, ok, "%s verifies %s", algorithm, encoded)
+			ok, err = h.Verify("wrong", encoded)
+			require.NoError(t, err)
+			assert.False(t, ok, "%s rejects a wrong password for %s", algorithm, encoded)
+		}
+	}
+}
+
+func TestLegacySHA1(t *testing.T) {
+	var legacy legacySHA1
+	assert.True(t, legacy.recognizes(legacySecret))
+	assert.False(t, legacy.recognizes(legacySecret[:len(legacySecret)-2]))
+	assert.False(t, legacy.recognizes(strings.Repeat("0", len(legacySecret))))
+
+	// legacy hashes are only verified, never produced
+	_, err := legacy.Hash("secret")
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+	assert.True(t, MustNew(Bcrypt).NeedsRehash(legacySecret))
+	assert.True(t, MustNew(Argon2id).NeedsRehash(legacySecret))
+}
+
+func TestNeedsRehash(t *testing.T) {
+	bcryptDefault, err := NewBcrypt(0).Hash("secret")
+	require.NoError(t, err)
+	bcryptCheap, err := NewBcrypt(bcrypt.MinCost).Hash("secret")
+	require.NoError(t, err)
+	argonDefault, err := NewArgon2id().Hash("secret")
+	require.NoError(t, err)
+	weaker := NewArgon2id()
+	weaker.memory, weaker.time = 32*1024, 2
+	argonWeaker, err := weaker.Hash("secret")
+	require.NoError(t, err)
+	shorter := NewArgon2id()
+	shorter.keyLen, shorter.saltLen = 16, 8
+	argonShorter, err := shorter.Hash("secret")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		algorithm string
+		encoded   string
+		rehash    bool
+	}{
+		{name: "Current bcrypt", algorithm: Bcrypt, encoded: bcryptDefault},
+		{name: "Bcrypt cost changed", algorithm: Bcrypt, encoded: bcryptCheap, rehash: true},
+		{name: "Bcrypt to argon2id", algorithm: Argon2id, encoded: bcryptDefault, rehash: true},
+		{name: "Current argon2id", algorithm: Argon2id, encoded: argonDefault},
+		{name: "Argon2id parameters changed", algorithm: Argon2id, encoded: argonWeaker, rehash: true},
+		{name: "Argon2id key and salt length changed", algorithm: Argon2id, encoded: argonShorter, rehash: true},
+		{name: "Argon2id to bcrypt", algorithm: Bcrypt, encoded: argonDefault, rehash: true},
+		{name: "Unknown format", algorithm: Bcrypt, encoded: "plain", rehash: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.rehash, MustNew(tt.algorithm).NeedsRehash(tt.encoded))
+		})
+	}
+
+	// the hasher compares against its own cost, not the default one
+	assert.False(t, NewBcrypt(bcrypt.MinCost).NeedsRehash(bcryptCheap))
+	assert.True(t, NewBcrypt(bcrypt.MinCost).NeedsRehash(bcryptDefault))
+}
+
+func TestMalformedHash(t *testing.T) {
+	h := MustNew(Argon2id)
+	for _, encoded := range []string{
+		"$argon2id$v=19$m=65536,t=1,p=4$c2FsdA",
+		"$argon2id$v=18$m=65536,t=1,p=4$c2FsdHNhbHRzYWx0$a2V5",
+		"$argon2id$v=19$m=lots,t=1,p=4$c2FsdHNhbHRzYWx0$a2V5",
+		"$argon2id$v=19$m=65536,t=1,p=4$!!!$a2V5",
+		"$argon2id$v=19$m=65536,t=1,p=4$c2FsdHNhbHRzYWx0$",
+	} {
+		ok, err := h.Verify("secret", encoded)
+		assert.ErrorIs(t, err, ErrInvalidHash, encoded)
+		assert.False(t, ok)
+		assert.True(t, h.NeedsRehash(encoded))
+	}
+
+	ok, err := h.Verify("secret", "$2a$10$short")
+	assert.Error(t, err)
+	assert.False(t, ok)
+
+	ok, err = h.Verify("secret", "plain")
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+	assert.False(t, ok)
+
+	_, err = New("md5")
+	assert.Error(t, err)
+	assert.Panics(t, func() { MustNew("md5") })
+}
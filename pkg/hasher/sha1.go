@@ -0,0 +1,36 @@
+package hasher
+
+import (
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+)
+
+// legacySecretKey is the global "salt" the first versions of gophermart
+// prepended to every SHA-1 digest. Kept only to verify and upgrade old hashes.
+const legacySecretKey = "be55d1079e6c6167118ac91318fe"
+
+// legacySHA1 verifies hashes stored before per-user salts existed.
+// It must never be used to produce new hashes.
+type legacySHA1 struct{}
+
+func (legacySHA1) Hash(string) (string, error) {
+	return "", ErrUnknownFormat
+}
+
+func (legacySHA1) Verify(password, encoded string) (bool, error) {
+	hash := sha1.New()
+	hash.Write([]byte(password))
+	expected := hex.EncodeToString(hash.Sum([]byte(legacySecretKey)))
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(encoded)) == 1, nil
+}
+
+func (legacySHA1) NeedsRehash(string) bool {
+	return true
+}
+
+func (legacySHA1) recognizes(encoded string) bool {
+	return len(encoded) == 2*(len(legacySecretKey)+sha1.Size) &&
+		strings.HasPrefix(encoded, hex.EncodeToString([]byte(legacySecretKey)))
+}
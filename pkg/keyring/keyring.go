@@ -0,0 +1,190 @@
+package keyring
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+var (
+	ErrNoSigningKey = errors.New("keyring: active signing key is not configured")
+	ErrUnknownKey   = errors.New("keyring: unknown key id")
+)
+
+// KeyConfig describes one key of the ring. HS256 keys carry a shared secret,
+// RS256/EdDSA keys are PEM files: a private key can sign and verify, a public key only verifies.
+type KeyConfig struct {
+	ID             string `json:"kid"`
+	Algorithm      string `json:"alg"`
+	Secret         string `json:"secret,omitempty"`
+	PrivateKeyFile string `json:"private_key_file,omitempty"`
+	PublicKeyFile  string `json:"public_key_file,omitempty"`
+}
+
+// FileConfig is the layout of the JWT_KEYS_FILE document.
+type FileConfig struct {
+	Active string      `json:"active"`
+	Keys   []KeyConfig `json:"keys"`
+}
+
+// KeyRing signs tokens with the active key and verifies tokens signed by any
+// key of the ring, selected by the "kid" header. Keeping the previous key in
+// the ring lets issued tokens survive a rotation.
+type KeyRing struct {
+	signAlg jwa.SignatureAlgorithm
+	signKey jwk.Key
+	verify  jwk.Set
+	public  jwk.Set
+}
+
+// Load builds the ring from a keys file if given, otherwise from a single HS256
+// secret. Without either an ephemeral random key is generated: tokens will not
+// survive a restart and are not shared between replicas.
+func Load(keysFile, keyID, secret string) (ring *KeyRing, ephemeral bool, err error) {
+	switch {
+	case keysFile != "":
+		data, err := os.ReadFile(keysFile)
+		if err != nil {
+			return nil, false, fmt.Errorf("keyring: read keys file: %w", err)
+		}
+		var fc FileConfig
+		if err = json.Unmarshal(data, &fc); err != nil {
+			return nil, false, fmt.Errorf("keyring: parse keys file: %w", err)
+		}
+		ring, err = New(fc.Active, fc.Keys...)
+		return ring, false, err
+	case secret != "":
+		ring, err = New(keyID, KeyConfig{ID: keyID, Algorithm: jwa.HS256.String(), Secret: secret})
+		return ring, false, err
+	default:
+		ring, err = Ephemeral()
+		return ring, true, err
+	}
+}
+
+// Ephemeral returns a ring with a random HS256 key.
+func Ephemeral() (*KeyRing, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return New("ephemeral", KeyConfig{ID: "ephemeral", Algorithm: jwa.HS256.String(), Secret: string(secret)})
+}
+
+func New(active string, keys ...KeyConfig) (*KeyRing, error) {
+	ring := &KeyRing{
+		verify: jwk.NewSet(),
+		public: jwk.NewSet(),
+	}
+	for _, kc := range keys {
+		key, signer, err := kc.load()
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := ring.verify.LookupKeyID(kc.ID); exists {
+			return nil, fmt.Errorf("keyring: duplicate kid %q", kc.ID)
+		}
+
+		verifyKey := key
+		if signer && kc.Algorithm != jwa.HS256.String() {
+			if verifyKey, err = jwk.PublicKeyOf(key); err != nil {
+				return nil, fmt.Errorf("keyring: key %q: %w", kc.ID, err)
+			}
+		}
+		if err = ring.verify.AddKey(verifyKey); err != nil {
+			return nil, err
+		}
+		if kc.Algorithm != jwa.HS256.String() {
+			if err = ring.public.AddKey(verifyKey); err != nil {
+				return nil, err
+			}
+		}
+
+		if kc.ID == active {
+			if !signer {
+				return nil, fmt.Errorf("keyring: active key %q has no private part", kc.ID)
+			}
+			ring.signAlg = jwa.SignatureAlgorithm(kc.Algorithm)
+			ring.signKey = key
+		}
+	}
+	if ring.signKey == nil {
+		return nil, ErrNoSigningKey
+	}
+	return ring, nil
+}
+
+func (kc KeyConfig) load() (key jwk.Key, signer bool, err error) {
+	if kc.ID == "" {
+		return nil, false, errors.New("keyring: key without kid")
+	}
+	switch jwa.SignatureAlgorithm(kc.Algorithm) {
+	case jwa.HS256:
+		if kc.Secret == "" {
+			return nil, false, fmt.Errorf("keyring: key %q: empty secret", kc.ID)
+		}
+		key, err = jwk.FromRaw([]byte(kc.Secret))
+		signer = true
+	case jwa.RS256, jwa.EdDSA:
+		file := kc.PrivateKeyFile
+		signer = file != ""
+		if !signer {
+			file = kc.PublicKeyFile
+		}
+		if file == "" {
+			return nil, false, fmt.Errorf("keyring: key %q: key file is required", kc.ID)
+		}
+		var data []byte
+		if data, err = os.ReadFile(file); err != nil {
+			return nil, false, fmt.Errorf("keyring: key %q: %w", kc.ID, err)
+		}
+		key, err = jwk.ParseKey(data, jwk.WithPEM(true))
+	default:
+		return nil, false, fmt.Errorf("keyring: key %q: unsupported algorithm %q", kc.ID, kc.Algorithm)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("keyring: key %q: %w", kc.ID, err)
+	}
+	if err = key.Set(jwk.KeyIDKey, kc.ID); err != nil {
+		return nil, false, err
+	}
+	if err = key.Set(jwk.AlgorithmKey, jwa.SignatureAlgorithm(kc.Algorithm)); err != nil {
+		return nil, false, err
+	}
+	return key, signer, nil
+}
+
+// Encode signs the claims with the active key, the "kid" header is set from the key.
+func (k *KeyRing) Encode(claims map[string]interface{}) (jwt.Token, string, error) {
+	t := jwt.New()
+	for name, v := range claims {
+		if err := t.Set(name, v); err != nil {
+			return nil, "", err
+		}
+	}
+	payload, err := jwt.Sign(t, jwt.WithKey(k.signAlg, k.signKey))
+	if err != nil {
+		return nil, "", err
+	}
+	return t, string(payload), nil
+}
+
+// Decode verifies the signature only, claims are validated by the caller.
+func (k *KeyRing) Decode(tokenString string) (jwt.Token, error) {
+	return jwt.Parse([]byte(tokenString),
+		jwt.WithKeySet(k.verify, jws.WithRequireKid(true)),
+		jwt.WithValidate(false))
+}
+
+// PublicKeys returns the asymmetric verification keys as a JWK set, so other
+// services can verify gophermart tokens without sharing a secret.
+func (k *KeyRing) PublicKeys() jwk.Set {
+	return k.public
+}
@@ -0,0 +1,74 @@
+package keyring
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotation(t *testing.T) {
+	previous, err := New("k1", KeyConfig{ID: "k1", Algorithm: "HS256", Secret: "old secret"})
+	require.NoError(t, err)
+	_, oldToken, err := previous.Encode(map[string]interface{}{"user_id": 1})
+	require.NoError(t, err)
+
+	rotated, err := New("k2",
+		KeyConfig{ID: "k1", Algorithm: "HS256", Secret: "old secret"},
+		KeyConfig{ID: "k2", Algorithm: "HS256", Secret: "new secret"},
+	)
+	require.NoError(t, err)
+	_, newToken, err := rotated.Encode(map[string]interface{}{"user_id": 1})
+	require.NoError(t, err)
+
+	_, err = rotated.Decode(oldToken)
+	assert.NoError(t, err, "token signed by the previous key must verify")
+	_, err = rotated.Decode(newToken)
+	assert.NoError(t, err)
+	_, err = previous.Decode(newToken)
+	assert.Error(t, err, "unknown kid must be rejected")
+}
+
+func TestPublicKeyVerifyOnly(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	dir := t.TempDir()
+	privateFile := writePEM(t, dir, "private.pem", "PRIVATE KEY", must(x509.MarshalPKCS8PrivateKey(private)))
+	publicFile := writePEM(t, dir, "public.pem", "PUBLIC KEY", must(x509.MarshalPKIXPublicKey(public)))
+
+	issuer, err := New("ed", KeyConfig{ID: "ed", Algorithm: "EdDSA", PrivateKeyFile: privateFile})
+	require.NoError(t, err)
+	assert.Equal(t, 1, issuer.PublicKeys().Len())
+	_, token, err := issuer.Encode(map[string]interface{}{"user_id": 1})
+	require.NoError(t, err)
+
+	_, err = New("ed", KeyConfig{ID: "ed", Algorithm: "EdDSA", PublicKeyFile: publicFile})
+	assert.Error(t, err, "public key cannot be the active signing key")
+
+	verifier, err := New("hs",
+		KeyConfig{ID: "hs", Algorithm: "HS256", Secret: "secret"},
+		KeyConfig{ID: "ed", Algorithm: "EdDSA", PublicKeyFile: publicFile},
+	)
+	require.NoError(t, err)
+	_, err = verifier.Decode(token)
+	assert.NoError(t, err)
+}
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600))
+	return path
+}
+
+func must(der []byte, err error) []byte {
+	if err != nil {
+		panic(err)
+	}
+	return der
+}
@@ -0,0 +1,80 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubResolver map[string][]string
+
+func (r stubResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	ips, ok := r[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	addrs := make([]net.IPAddr, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return addrs, nil
+}
+
+func TestGuardPermits(t *testing.T) {
+	guard := Guard{}
+	for _, ip := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254",
+		"100.64.0.1", "0.0.0.0", "::1", "fe80::1", "fd00::1", "::ffff:127.0.0.1", "224.0.0.1"} {
+		assert.False(t, guard.Permits(net.ParseIP(ip)), ip)
+	}
+	for _, ip := range []string{"93.184.216.34", "8.8.8.8", "2606:4700::1111"} {
+		assert.True(t, guard.Permits(net.ParseIP(ip)), ip)
+	}
+
+	networks, err := ParseNetworks([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	guard.Allowed = networks
+	assert.True(t, guard.Permits(net.ParseIP("10.1.2.3")))
+	assert.False(t, guard.Permits(net.ParseIP("192.168.1.1")))
+
+	_, err = ParseNetworks([]string{"10.0.0.0"})
+	assert.Error(t, err)
+}
+
+func TestGuardCheckHost(t *testing.T) {
+	guard := Guard{Resolver: stubResolver{
+		"crm.example.com": {"93.184.216.34"},
+		// хотя бы один внутренний адрес - и хост запрещён
+		"mixed.example.com": {"93.184.216.34", "10.0.0.1"},
+	}}
+	ctx := context.Background()
+	assert.NoError(t, guard.CheckHost(ctx, "crm.example.com"))
+	assert.NoError(t, guard.CheckHost(ctx, "8.8.8.8"))
+	assert.ErrorIs(t, guard.CheckHost(ctx, "mixed.example.com"), ErrForbiddenAddress)
+	assert.ErrorIs(t, guard.CheckHost(ctx, "169.254.169.254"), ErrForbiddenAddress)
+	assert.Error(t, guard.CheckHost(ctx, "unknown.example.com"))
+}
+
+func TestGuardClient(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/elsewhere", http.StatusFound)
+	}))
+	defer target.Close()
+
+	// соединение с loopback запрещено, даже если адрес прошёл регистрацию
+	_, err := Guard{}.Client(time.Second).Post(target.URL, "application/json", nil)
+	assert.ErrorIs(t, err, ErrForbiddenAddress)
+
+	loopback, err := ParseNetworks([]string{"127.0.0.0/8"})
+	require.NoError(t, err)
+	resp, err := Guard{Allowed: loopback}.Client(time.Second).Post(target.URL, "application/json", nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+}
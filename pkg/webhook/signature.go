@@ -0,0 +1,36 @@
+// Package webhook подписывает тела вебхуков, чтобы получатель мог проверить отправителя.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+
+	signaturePrefix = "sha256="
+)
+
+// Sign - HMAC-SHA256 от "<timestamp>.<body>"; метка времени входит в подпись, чтобы старый запрос нельзя было повторить
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify проверяет подпись и что она сделана не раньше tolerance назад
+func Verify(secret, signature string, timestamp time.Time, body []byte, tolerance time.Duration) bool {
+	if tolerance > 0 && time.Since(timestamp) > tolerance {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body)))
+}
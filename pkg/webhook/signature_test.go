@@ -0,0 +1,25 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSign(t *testing.T) {
+	timestamp := time.Date(2024, 11, 10, 13, 9, 57, 0, time.UTC)
+	assert.Equal(t, "sha256=a5f2950b5a42d333bf885ea68866b4d22209e9a10cc78c40835784f8c628de31",
+		Sign("whsec_test", timestamp, []byte(`{"id":1}`)))
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	now := time.Now()
+	signature := Sign("whsec_test", now, body)
+
+	assert.True(t, Verify("whsec_test", signature, now, body, time.Minute))
+	assert.False(t, Verify("other", signature, now, body, time.Minute))
+	assert.False(t, Verify("whsec_test", signature, now, []byte(`{"id":2}`), time.Minute))
+	assert.False(t, Verify("whsec_test", Sign("whsec_test", now.Add(-time.Hour), body), now.Add(-time.Hour), body, time.Minute))
+}